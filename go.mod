@@ -5,6 +5,8 @@ go 1.12
 require (
 	github.com/Songmu/axslogparser v1.2.0
 	github.com/hpcloud/tail v1.0.1-0.20180514194441-a1dbeea552b7
+	github.com/klauspost/compress v1.11.13
+	github.com/oschwald/maxminddb-golang v1.3.1
 	github.com/stretchr/testify v1.3.0
 	github.com/wangjia184/sortedset v0.0.0-20160527075905-f5d03557ba30
 	golang.org/x/sys v0.0.0-20190804053845-51ab0e2deafa // indirect
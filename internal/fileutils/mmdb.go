@@ -0,0 +1,125 @@
+package fileutils
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+)
+
+// CreateTestMMDB creates an IPv4 MaxMind DB file mapping the given networks (eg. 1.2.3.0/24) to
+// their records, whose values can be strings, uint32 or maps of them
+func CreateTestMMDB(networks map[string]map[string]interface{}) (*os.File, error) {
+	// Search tree, where the records are either a node, a data offset or empty (-1)
+	type record struct {
+		node int
+		data int
+	}
+	nodes := [][2]record{{{-1, -1}, {-1, -1}}}
+	var data bytes.Buffer
+
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ip := ipNet.IP.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("not an IPv4 network: %s", cidr)
+		}
+		ones, _ := ipNet.Mask.Size()
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> uint(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = record{node: -1, data: data.Len()}
+				break
+			}
+			if nodes[node][bit].node == -1 {
+				nodes = append(nodes, [2]record{{-1, -1}, {-1, -1}})
+				nodes[node][bit].node = len(nodes) - 1
+			}
+			node = nodes[node][bit].node
+		}
+		b, err := encodeMMDB(networks[cidr])
+		if err != nil {
+			return nil, err
+		}
+		data.Write(b)
+	}
+
+	// Search tree with 24 bit records, data section separator, data section and metadata
+	var buf bytes.Buffer
+	nodeCount := len(nodes)
+	for _, n := range nodes {
+		for _, r := range n {
+			v := nodeCount
+			if r.node != -1 {
+				v = r.node
+			} else if r.data != -1 {
+				v = nodeCount + 16 + r.data
+			}
+			buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	metadata, err := encodeMMDB(map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint32(24),
+		"ip_version":                  uint32(4),
+		"binary_format_major_version": uint32(2),
+		"database_type":               "Test",
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(metadata)
+
+	f, err := CreateTestFile()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return f, f.Close()
+}
+
+// encodeMMDB encodes strings, uint32 and maps of them in the MaxMind DB data format
+func encodeMMDB(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		if len(v) >= 29 { // Size in the next byte
+			return append([]byte{2<<5 | 29, byte(len(v) - 29)}, v...), nil
+		}
+		return append([]byte{2<<5 | byte(len(v))}, v...), nil
+	case uint32:
+		return []byte{6<<5 | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := []byte{7<<5 | byte(len(v))}
+		for _, k := range keys {
+			key, _ := encodeMMDB(k)
+			value, err := encodeMMDB(v[k])
+			if err != nil {
+				return nil, err
+			}
+			out = append(append(out, key...), value...)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
@@ -0,0 +1,44 @@
+package fileutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateTestMMDB(t *testing.T) {
+	f, err := CreateTestMMDB(map[string]map[string]interface{}{
+		"1.2.3.0/24": {"name": "a network with a name longer than 29 bytes", "asn": uint32(1)},
+		"1.2.4.0/24": {"nested": map[string]interface{}{"key": "value"}},
+	})
+	assert.NoError(t, err)
+	defer RemoveTestFile(f)
+
+	r, err := maxminddb.Open(f.Name())
+	assert.NoError(t, err)
+	defer r.Close()
+
+	var rec struct {
+		Name   string            `maxminddb:"name"`
+		ASN    uint              `maxminddb:"asn"`
+		Nested map[string]string `maxminddb:"nested"`
+	}
+	assert.NoError(t, r.Lookup(net.ParseIP("1.2.3.4"), &rec))
+	assert.Equal(t, "a network with a name longer than 29 bytes", rec.Name)
+	assert.Equal(t, uint(1), rec.ASN)
+
+	assert.NoError(t, r.Lookup(net.ParseIP("1.2.4.4"), &rec))
+	assert.Equal(t, map[string]string{"key": "value"}, rec.Nested)
+}
+
+func TestCreateTestMMDB_Err(t *testing.T) {
+	f, err := CreateTestMMDB(map[string]map[string]interface{}{"2001:db8::/32": {"name": "v6"}})
+	assert.Error(t, err)
+	assert.Nil(t, f)
+
+	f, err = CreateTestMMDB(map[string]map[string]interface{}{"1.2.3.0/24": {"score": 1.5}})
+	assert.Error(t, err)
+	assert.Nil(t, f)
+}
@@ -0,0 +1,151 @@
+package logparser
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// DefaultSampleSize is the default number of lines used to detect the log format
+const DefaultSampleSize = 100
+
+// Auto is a parser that detects the log format among a set of registered candidates.
+// Each of the first sampleSize lines is parsed by every candidate and the result of the
+// candidate with the highest fraction of parsed lines so far is returned. After that, the
+// candidate with the highest fraction of parsed lines is used for all the following lines.
+// If no candidate parsed any of them, it falls back to the default format, or to the first
+// candidate if that's not among them.
+type Auto struct {
+	mu         sync.Mutex
+	log        *log.Logger
+	names      []string
+	candidates []Parser
+	parsed     []int // Number of sampled lines parsed by each candidate
+	sampled    int
+	sampleSize int
+	detected   int // Index of the detected candidate, -1 while still sampling
+}
+
+// NewAuto returns a parser that detects the log format from the first sampleSize lines.
+// The candidates are the registered formats with the given names, or all the registered ones if
+// no name is provided. Returns an error if sampleSize is not positive or a format doesn't exist
+func NewAuto(sampleSize int, l *log.Logger, names ...string) (*Auto, error) {
+	if sampleSize <= 0 {
+		return nil, fmt.Errorf("cannot detect log format on %d lines", sampleSize)
+	}
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	if len(names) == 0 {
+		for _, name := range Formats() {
+			if name != AutoFormat {
+				names = append(names, name)
+			}
+		}
+	}
+
+	a := &Auto{
+		log:        l,
+		sampleSize: sampleSize,
+		detected:   -1,
+	}
+	for _, name := range names {
+		if name == AutoFormat {
+			return nil, fmt.Errorf("cannot use %s as candidate format", AutoFormat)
+		}
+		p, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		a.names = append(a.names, name)
+		a.candidates = append(a.candidates, p)
+	}
+	a.parsed = make([]int, len(a.candidates))
+	return a, nil
+}
+
+// ParseLine parses the line with the detected format or, while the format is still unknown,
+// with the candidate that parsed the highest fraction of the lines seen so far
+func (a *Auto) ParseLine(line string) (*Line, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.detected >= 0 {
+		return a.candidates[a.detected].ParseLine(line)
+	}
+
+	results := make([]*Line, len(a.candidates))
+	directive := false
+	for i, p := range a.candidates {
+		l, err := p.ParseLine(line)
+		switch {
+		case err == nil:
+			results[i] = l
+			a.parsed[i]++
+		case err == ErrDirective:
+			directive = true
+		}
+	}
+	a.sampled++
+
+	best := a.best()
+	if a.sampled >= a.sampleSize && a.parsed[best] > 0 {
+		a.detected = best
+		a.log.Printf("[INFO] detected log format %s (%d/%d sampled lines parsed)\n",
+			a.names[best], a.parsed[best], a.sampled)
+	} else if a.sampled >= a.sampleSize {
+		a.detected = a.fallback()
+		a.log.Printf("[WARN] cannot detect log format, no sampled line parsed by %v, falling back to %s\n",
+			a.names, a.names[a.detected])
+	}
+
+	// Return the result of the best candidate among the ones that parsed this line
+	out := -1
+	for i, l := range results {
+		if l != nil && (out < 0 || a.parsed[i] > a.parsed[out]) {
+			out = i
+		}
+	}
+	if out < 0 && directive {
+		return nil, ErrDirective
+	}
+	if out < 0 {
+		return nil, fmt.Errorf("line doesn't match any of the formats %v", a.names)
+	}
+	return results[out], nil
+}
+
+// Format returns the name of the detected format or the empty string while still sampling
+func (a *Auto) Format() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.detected < 0 {
+		return ""
+	}
+	return a.names[a.detected]
+}
+
+// best returns the index of the candidate that parsed the most sampled lines.
+// Ties are broken in favour of the candidate that comes first
+func (a *Auto) best() int {
+	best := 0
+	for i, n := range a.parsed {
+		if n > a.parsed[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// fallback returns the index of the candidate used when no sampled line has been parsed, ie. the
+// default format or the first candidate if that's not among them
+func (a *Auto) fallback() int {
+	for i, name := range a.names {
+		if name == DefaultFormat {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package logparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testCommonLine   = `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`
+	testCombinedLine = `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl/7.58.0"`
+)
+
+func TestNewAuto(t *testing.T) {
+	a, err := NewAuto(10, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, a)
+	assert.NotContains(t, a.names, AutoFormat)
+	assert.Len(t, a.candidates, len(Formats())-1)
+	assert.Equal(t, "", a.Format())
+}
+
+func TestNewAuto_Err(t *testing.T) {
+	testCases := []struct {
+		sampleSize int
+		names      []string
+	}{
+		{0, nil},
+		{-1, nil},
+		{10, []string{"asd"}},
+		{10, []string{"common", AutoFormat}},
+	}
+
+	for _, tt := range testCases {
+		a, err := NewAuto(tt.sampleSize, nil, tt.names...)
+		assert.Error(t, err)
+		assert.Nil(t, a)
+	}
+}
+
+func TestAuto_ParseLine(t *testing.T) {
+	a, err := NewAuto(3, nil, "common", "combined")
+	assert.NoError(t, err)
+
+	// Sampling, the line is parsed by the only candidate that can
+	l, err := a.ParseLine(testCommonLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "/report", l.Section)
+	assert.Equal(t, "", a.Format())
+
+	l, err = a.ParseLine(testCombinedLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "curl/7.58.0", l.UserAgent)
+	assert.Equal(t, "", a.Format())
+
+	_, err = a.ParseLine("asd")
+	assert.Error(t, err)
+
+	// Sample complete, but no candidate is better than the other: the first one is chosen
+	assert.Equal(t, "common", a.Format())
+}
+
+func TestAuto_ParseLineDetected(t *testing.T) {
+	a, err := NewAuto(2, nil, "common", "combined")
+	assert.NoError(t, err)
+
+	_, err = a.ParseLine(testCombinedLine)
+	assert.NoError(t, err)
+	_, err = a.ParseLine(testCombinedLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "combined", a.Format())
+
+	// From now on only the detected format is used
+	_, err = a.ParseLine(testCommonLine)
+	assert.Error(t, err)
+}
+
+func TestAuto_ParseLineNoCandidateMatches(t *testing.T) {
+	testCases := []struct {
+		names     []string
+		expFormat string
+	}{
+		{[]string{"common", DefaultFormat}, DefaultFormat},
+		{[]string{"common", "combined"}, "common"},
+	}
+
+	for _, tt := range testCases {
+		a, err := NewAuto(2, nil, tt.names...)
+		assert.NoError(t, err)
+
+		_, err = a.ParseLine("asd")
+		assert.Error(t, err)
+		assert.Equal(t, "", a.Format())
+		// Sample complete with no line parsed: fall back instead of sampling forever
+		_, err = a.ParseLine("asd")
+		assert.Error(t, err)
+		assert.Equal(t, tt.expFormat, a.Format())
+	}
+}
+
+func TestAuto_ParseLineDirective(t *testing.T) {
+	a, err := NewAuto(3, nil, "common", "w3c")
+	assert.NoError(t, err)
+
+	_, err = a.ParseLine("#Fields: date time cs-uri-stem sc-status")
+	assert.Equal(t, ErrDirective, err)
+
+	l, err := a.ParseLine("2018-05-09 16:00:39 /report 200")
+	assert.NoError(t, err)
+	assert.Equal(t, "/report", l.Section)
+
+	l, err = a.ParseLine("2018-05-09 16:00:40 /report/foo 404")
+	assert.NoError(t, err)
+	assert.Equal(t, 404, l.StatusCode)
+	assert.Equal(t, "w3c", a.Format())
+}
@@ -0,0 +1,110 @@
+package logparser
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClientIPResolver resolves the address of the clients of the requests served behind proxies (eg.
+// load balancers), whose remote host is the address of the last proxy rather than the client's
+type ClientIPResolver struct {
+	field   string
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver returns a resolver reading the addresses the requests were forwarded for from
+// the given field of the log lines, as named by their format (eg. '%{X-Forwarded-For}i' or
+// '$http_x_forwarded_for'), and skipping the trusted proxies, given as either IP addresses or
+// networks in CIDR notation. With no field, the client address is the remote host.
+// Returns an error if a trusted proxy is invalid
+func NewClientIPResolver(field string, trustedProxies ...string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{field: field}
+	for _, p := range trustedProxies {
+		n, err := parseNetwork(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %v", err)
+		}
+		r.trusted = append(r.trusted, n)
+	}
+	return r, nil
+}
+
+// Resolve returns the normalized address of the client of the request, ie. the first address that
+// isn't a trusted proxy walking the forwarded addresses right-to-left, starting from the remote
+// host. If all of them are trusted, the leftmost one is the client. The walk stops at the first
+// entry that isn't an IP address, since the ones on its left cannot be trusted, and the last valid
+// address is returned. Nothing is returned if the remote host itself isn't an IP address
+func (r *ClientIPResolver) Resolve(l *Line) string {
+	client := normalizeIP(l.RemoteHost)
+	if client == nil || r.field == "" || !r.isTrusted(client) {
+		return ipString(client)
+	}
+
+	hops := strings.Split(l.Extra[r.field], ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := normalizeIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return ipString(client)
+}
+
+// isTrusted returns whether the address is a trusted proxy
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetwork parses a network in CIDR notation or a single IP address
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := normalizeIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %s", s)
+		}
+		bits := 8 * len(ip)
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// normalizeIP parses an address, with optional port, brackets or IPv6 zone (eg. '[fe80::1%eth0]:80').
+// Returns nil if it isn't an IP address
+func normalizeIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i != -1 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// ipString returns the canonical form of an address (eg. '2001:db8::1' for IPv6 and '192.0.2.1'
+// for IPv4-mapped IPv6 addresses), or an empty string if nil
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,74 @@
+package logparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientIPResolver(t *testing.T) {
+	r, err := NewClientIPResolver("%{X-Forwarded-For}i", "10.0.0.0/8", " 192.0.2.1", "2001:db8::/32", "::1")
+	assert.NoError(t, err)
+	assert.Len(t, r.trusted, 4)
+	assert.Equal(t, "192.0.2.1/32", r.trusted[1].String())
+	assert.Equal(t, "::1/128", r.trusted[3].String())
+}
+
+func TestNewClientIPResolver_Err(t *testing.T) {
+	testCases := []string{"10.0.0.0/33", "10.0.0", "proxy.example.com", ""}
+
+	for _, p := range testCases {
+		r, err := NewClientIPResolver("%{X-Forwarded-For}i", p)
+		assert.Error(t, err, p)
+		assert.Nil(t, r, p)
+	}
+}
+
+func TestClientIPResolver_Resolve(t *testing.T) {
+	testCases := []struct {
+		remoteHost   string
+		forwardedFor string
+		expClientIP  string
+	}{
+		// Client directly connected
+		{"203.0.113.7", "", "203.0.113.7"},
+		{"203.0.113.7", "198.51.100.1", "203.0.113.7"},
+		// Behind trusted proxies
+		{"10.0.0.1", "203.0.113.7", "203.0.113.7"},
+		{"10.0.0.1", "198.51.100.1, 203.0.113.7, 10.0.0.2", "203.0.113.7"},
+		{"10.0.0.1", "203.0.113.7,10.1.2.3", "203.0.113.7"},
+		// All trusted
+		{"10.0.0.1", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1", "", "10.0.0.1"},
+		{"10.0.0.1", "-", "10.0.0.1"},
+		// Invalid entries stop the walk
+		{"10.0.0.1", "203.0.113.7, unknown, 10.0.0.2", "10.0.0.2"},
+		// Normalization
+		{"10.0.0.1", "203.0.113.7:51234", "203.0.113.7"},
+		{"10.0.0.1", "[2001:DB8:0:0::1]:443", "2001:db8::1"},
+		{"10.0.0.1", "::ffff:203.0.113.7", "203.0.113.7"},
+		{"10.0.0.1", "fe80::1%eth0", "fe80::1"},
+		{"::ffff:10.0.0.1", "203.0.113.7", "203.0.113.7"},
+		{"2001:db8:0::1", "", "2001:db8::1"},
+		// Remote host not an IP address
+		{"proxy.example.com", "203.0.113.7", ""},
+	}
+
+	r, err := NewClientIPResolver("%{X-Forwarded-For}i", "10.0.0.0/8")
+	assert.NoError(t, err)
+	for _, tt := range testCases {
+		l := &Line{RemoteHost: tt.remoteHost}
+		if tt.forwardedFor != "" {
+			l.setExtra("%{X-Forwarded-For}i", tt.forwardedFor)
+		}
+		assert.Equal(t, tt.expClientIP, r.Resolve(l), tt.remoteHost+" "+tt.forwardedFor)
+	}
+}
+
+func TestClientIPResolver_ResolveNoField(t *testing.T) {
+	r, err := NewClientIPResolver("")
+	assert.NoError(t, err)
+
+	l := &Line{RemoteHost: "2001:0db8::0001", Extra: map[string]string{"%{X-Forwarded-For}i": "203.0.113.7"}}
+	assert.Equal(t, "2001:db8::1", r.Resolve(l))
+}
@@ -0,0 +1,144 @@
+package logparser
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// albFields are the fields of the AWS Application Load Balancer access logs.
+// See https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+var albFields = []string{
+	"type", "time", "elb", "client:port", "target:port", "request_processing_time",
+	"target_processing_time", "response_processing_time", "elb_status_code", "target_status_code",
+	"received_bytes", "sent_bytes", "request", "user_agent", "ssl_cipher", "ssl_protocol",
+	"target_group_arn", "trace_id", "domain_name", "chosen_cert_arn", "matched_rule_priority",
+	"request_creation_time", "actions_executed", "redirect_url", "error_reason", "target:port_list",
+	"target_status_code_list", "classification", "classification_reason",
+}
+
+// classicELBFields are the fields of the AWS Classic Load Balancer access logs.
+// See https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+var classicELBFields = []string{
+	"time", "elb", "client:port", "backend:port", "request_processing_time",
+	"backend_processing_time", "response_processing_time", "elb_status_code", "backend_status_code",
+	"received_bytes", "sent_bytes", "request", "user_agent", "ssl_cipher", "ssl_protocol",
+}
+
+// ELB the parser for the access logs of the AWS Elastic Load Balancers, either Application
+// (ALB) or Classic ones
+type ELB struct {
+	fields    []string
+	minFields int // Lines may miss the fields after the user agent, added later by AWS
+}
+
+// NewALB returns a parser for the AWS Application Load Balancer access logs. Cannot return nil
+func NewALB() *ELB {
+	return newELB(albFields)
+}
+
+// NewClassicELB returns a parser for the AWS Classic Load Balancer access logs. Cannot return nil
+func NewClassicELB() *ELB {
+	return newELB(classicELBFields)
+}
+
+func newELB(fields []string) *ELB {
+	p := &ELB{fields: fields}
+	for i, name := range fields {
+		if name == "user_agent" {
+			p.minFields = i + 1
+		}
+	}
+	return p
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// The duration is the sum of the load balancer and the target processing times, while the
+// target (or backend) status code and processing time are the backend ones.
+// Values of fields that have no counterpart in Line are stored in Line.Extra, while values
+// following the known fields are ignored
+func (p *ELB) ParseLine(line string) (*Line, error) {
+	values, err := splitFields(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid load balancer log line: %v", err)
+	}
+	if len(values) < p.minFields {
+		return nil, fmt.Errorf("line has %d fields, expected at least %d: %s", len(values), p.minFields, line)
+	}
+
+	l := &Line{}
+	var request string
+	var times [3]time.Duration // Request, target and response processing times
+	hasTimes := true
+	for i, name := range p.fields {
+		if i >= len(values) {
+			break
+		}
+		v := values[i]
+		switch name {
+		case "time":
+			l.Date, err = parseTime(time.RFC3339Nano, v)
+		case "client:port":
+			l.RemoteHost = hostFromHostPort(v)
+		case "elb_status_code":
+			l.StatusCode, err = parseStatusCode(v)
+		case "target_status_code", "backend_status_code":
+			if v != "-" {
+				l.BackendStatusCode, err = parseStatusCode(v)
+			}
+		case "sent_bytes":
+			l.ContentLength, err = parseSize(v)
+		case "request":
+			request = v
+		case "user_agent":
+			l.UserAgent = v
+		case "request_processing_time", "target_processing_time", "backend_processing_time", "response_processing_time":
+			// -1 means the request couldn't be dispatched to (or had no response from) the target
+			if v == "-1" {
+				hasTimes = false
+				continue
+			}
+			t := 0
+			switch name {
+			case "target_processing_time", "backend_processing_time":
+				t = 1
+			case "response_processing_time":
+				t = 2
+			}
+			times[t], err = parseDuration(v, time.Second)
+		default:
+			l.setExtra(name, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if hasTimes {
+		l.Duration = times[0] + times[1] + times[2]
+		l.HasDuration = true
+		l.BackendDuration = times[1]
+		l.HasBackendDuration = true
+	}
+
+	var resource string
+	if l.Method, resource, l.Protocol, err = parseRequest(request); err != nil {
+		return nil, err
+	}
+	if err = l.setResource(resource); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// hostFromHostPort returns the host of the host:port pair (eg. '[::1]:80') or the pair itself
+// if it has no port
+func hostFromHostPort(hostPort string) string {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return strings.Trim(hostPort, "[]")
+	}
+	return host
+}
@@ -0,0 +1,209 @@
+package logparser
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewALB(t *testing.T) {
+	p := NewALB()
+	assert.NotNil(t, p)
+	assert.Equal(t, 14, p.minFields)
+}
+
+func TestNewClassicELB(t *testing.T) {
+	p := NewClassicELB()
+	assert.NotNil(t, p)
+	assert.Equal(t, 13, p.minFields)
+}
+
+func TestALB_ParseLine(t *testing.T) {
+	dateTime := time.Date(2018, time.July, 2, 22, 23, 0, 186641000, time.UTC)
+
+	testCases := []struct {
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/report/foo HTTP/1.1" "curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`,
+			&Line{
+				RemoteHost:         "192.168.131.39",
+				Date:               dateTime,
+				Method:             "GET",
+				Path:               "/report/foo",
+				Route:              "/report/foo",
+				Section:            "/report",
+				Protocol:           "HTTP/1.1",
+				StatusCode:         200,
+				ContentLength:      366,
+				UserAgent:          "curl/7.46.0",
+				Duration:           time.Millisecond,
+				HasDuration:        true,
+				BackendStatusCode:  200,
+				BackendDuration:    time.Millisecond,
+				HasBackendDuration: true,
+				Extra: map[string]string{
+					"type":                    "http",
+					"elb":                     "app/my-loadbalancer/50dc6c495c0c9188",
+					"target:port":             "10.0.0.1:80",
+					"received_bytes":          "34",
+					"ssl_cipher":              "-",
+					"ssl_protocol":            "-",
+					"target_group_arn":        "arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067",
+					"trace_id":                "Root=1-58337262-36d228ad5d99923122bbe354",
+					"domain_name":             "-",
+					"chosen_cert_arn":         "-",
+					"matched_rule_priority":   "0",
+					"request_creation_time":   "2018-07-02T22:22:48.364000Z",
+					"actions_executed":        "forward",
+					"redirect_url":            "-",
+					"error_reason":            "-",
+					"target:port_list":        "10.0.0.1:80",
+					"target_status_code_list": "200",
+					"classification":          "-",
+					"classification_reason":   "-",
+				},
+			},
+			false,
+		},
+		{
+			// Target unreachable, older log without the trailing fields
+			`https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 [2001:db8::1]:2817 - -1 -1 -1 502 - 34 366 "GET https://www.example.com:443/api/v1/users?id=1 HTTP/2.0" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			&Line{
+				RemoteHost:    "2001:db8::1",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/api/v1/users",
+				Route:         "/api/v1/users",
+				Section:       "/api",
+				Query:         url.Values{"id": {"1"}},
+				Protocol:      "HTTP/2.0",
+				StatusCode:    502,
+				ContentLength: 366,
+				UserAgent:     "Mozilla/5.0 (X11; Linux x86_64)",
+				Extra: map[string]string{
+					"type":           "https",
+					"elb":            "app/my-loadbalancer/50dc6c495c0c9188",
+					"target:port":    "-",
+					"received_bytes": "34",
+				},
+			},
+			false,
+		},
+		{
+			// Missing fields
+			`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366`,
+			nil,
+			true,
+		},
+		{
+			// Invalid date
+			`http 2018-07-02 app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid processing time
+			`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 abc 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid request
+			`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "- - - " "-"`,
+			nil,
+			true,
+		},
+		{
+			// Unterminated quoted field
+			`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0`,
+			nil,
+			true,
+		},
+		{
+			testCommonLine,
+			nil,
+			true,
+		},
+	}
+
+	p := NewALB()
+	for _, tt := range testCases {
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.Equal(t, tt.expLine, parsed, tt.line)
+	}
+}
+
+func TestClassicELB_ParseLine(t *testing.T) {
+	dateTime := time.Date(2015, time.May, 13, 23, 39, 43, 945958000, time.UTC)
+
+	testCases := []struct {
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 404 404 0 29 "GET http://www.example.com:80/report HTTP/1.1" "curl/7.38.0" - -`,
+			&Line{
+				RemoteHost:         "192.168.131.39",
+				Date:               dateTime,
+				Method:             "GET",
+				Path:               "/report",
+				Route:              "/report",
+				Section:            "/report",
+				Protocol:           "HTTP/1.1",
+				StatusCode:         404,
+				ContentLength:      29,
+				UserAgent:          "curl/7.38.0",
+				Duration:           1178 * time.Microsecond,
+				HasDuration:        true,
+				BackendStatusCode:  404,
+				BackendDuration:    1048 * time.Microsecond,
+				HasBackendDuration: true,
+				Extra: map[string]string{
+					"elb":            "my-loadbalancer",
+					"backend:port":   "10.0.0.1:80",
+					"received_bytes": "0",
+					"ssl_cipher":     "-",
+					"ssl_protocol":   "-",
+				},
+			},
+			false,
+		},
+		{
+			// TCP listener
+			`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.001069 0.000028 0.000041 - - 82 305 "- - - " "-" - -`,
+			nil,
+			true,
+		},
+	}
+
+	p := NewClassicELB()
+	for _, tt := range testCases {
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.Equal(t, tt.expLine, parsed, tt.line)
+	}
+}
+
+func TestHostFromHostPort(t *testing.T) {
+	testCases := []struct {
+		hostPort string
+		expHost  string
+	}{
+		{"192.168.131.39:2817", "192.168.131.39"},
+		{"[2001:db8::1]:2817", "2001:db8::1"},
+		{"192.168.131.39", "192.168.131.39"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"-", "-"},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expHost, hostFromHostPort(tt.hostPort))
+	}
+}
@@ -0,0 +1,251 @@
+package logparser
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// clfTimeLength is the length of a timestamp with the fixed-width clfTimeLayout
+const clfTimeLength = len("02/Jan/2006:15:04:05 -0700")
+
+// Fast the hand-written parser for the Common and Combined Log Formats.
+// It slices the fields straight out of the line, so a parsed line costs a single allocation
+// unless its resource needs url.Parse (eg. because it has a query string).
+// Lines it cannot handle (eg. with escaped quotes) are parsed by the HTTPd parser instead
+type Fast struct {
+	fallback *HTTPd
+}
+
+var (
+	// zonesMu protects zones, the time zones of the parsed dates keyed by their offset in seconds.
+	// Caching them avoids one allocation per line
+	zonesMu sync.RWMutex
+	zones   = make(map[int]*time.Location)
+)
+
+// NewFast returns a fast log parser for the Common and Combined Log Formats. Cannot return nil
+func NewFast() *Fast {
+	return &Fast{fallback: New()}
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// The result is the same of the HTTPd parser, which is used for the lines the fast path rejects
+func (p *Fast) ParseLine(line string) (*Line, error) {
+	if l := parseFast(line); l != nil {
+		return l, nil
+	}
+	return p.fallback.ParseLine(line)
+}
+
+// parseFast parses a line in the Common or Combined Log Format.
+// Returns nil if the line doesn't strictly follow the format, contains escape sequences or has an
+// invalid field
+func parseFast(line string) *Line {
+	l := &Line{}
+	var ok bool
+	rest := line
+
+	if l.RemoteHost, rest, ok = cutField(rest); !ok {
+		return nil
+	}
+	if l.RemoteLogName, rest, ok = cutField(rest); !ok {
+		return nil
+	}
+	if l.User, rest, ok = cutField(rest); !ok {
+		return nil
+	}
+
+	// [02/Jan/2006:15:04:05 -0700]
+	if len(rest) < clfTimeLength+3 || rest[0] != '[' || rest[clfTimeLength+1] != ']' || rest[clfTimeLength+2] != ' ' {
+		return nil
+	}
+	if l.Date, ok = parseCLFTime(rest[1 : clfTimeLength+1]); !ok {
+		return nil
+	}
+	rest = rest[clfTimeLength+3:]
+
+	var request string
+	if request, rest, ok = cutQuoted(rest); !ok || !strings.HasPrefix(rest, " ") {
+		return nil
+	}
+	var resource string
+	if l.Method, resource, l.Protocol, ok = splitRequest(request); !ok {
+		return nil
+	}
+
+	var status, size string
+	if status, rest, ok = cutField(rest[1:]); !ok {
+		return nil
+	}
+	if l.StatusCode, ok = atoi(status); !ok || l.StatusCode < 100 || l.StatusCode > 599 {
+		return nil
+	}
+
+	if i := strings.IndexByte(rest, ' '); i >= 0 {
+		size, rest = rest[:i], rest[i+1:]
+		// Combined Log Format: "referer" "user agent"
+		if l.Referer, rest, ok = cutQuoted(rest); !ok || !strings.HasPrefix(rest, " ") {
+			return nil
+		}
+		if l.UserAgent, rest, ok = cutQuoted(rest[1:]); !ok || rest != "" {
+			return nil
+		}
+	} else {
+		size, rest = rest, ""
+	}
+	if size != "-" {
+		if l.ContentLength, ok = atoi(size); !ok {
+			return nil
+		}
+	}
+
+	if err := l.setResource(resource); err != nil {
+		return nil
+	}
+	return l
+}
+
+// cutField returns the non-empty field before the first space and the rest of the line after it
+func cutField(s string) (string, string, bool) {
+	i := strings.IndexByte(s, ' ')
+	if i <= 0 {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// cutQuoted returns the content of the double-quoted field at the beginning of s and the rest of
+// s after the closing quote. Fields with escape sequences are rejected
+func cutQuoted(s string) (string, string, bool) {
+	if len(s) < 2 || s[0] != '"' {
+		return "", "", false
+	}
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return "", "", false
+	}
+	field := s[1 : end+1]
+	if strings.IndexByte(field, '\\') >= 0 {
+		return "", "", false
+	}
+	return field, s[end+2:], true
+}
+
+// splitRequest splits the request line in its method, resource and protocol
+func splitRequest(request string) (string, string, string, bool) {
+	i := strings.IndexByte(request, ' ')
+	if i <= 0 {
+		return "", "", "", false
+	}
+	j := strings.IndexByte(request[i+1:], ' ')
+	if j <= 0 {
+		return "", "", "", false
+	}
+	j += i + 1
+	if j+1 >= len(request) || strings.IndexByte(request[j+1:], ' ') >= 0 {
+		return "", "", "", false
+	}
+	return request[:i], request[i+1 : j], request[j+1:], true
+}
+
+// atoi converts a non-empty string of decimal digits to an int without allocating
+func atoi(s string) (int, bool) {
+	if s == "" || len(s) > 18 { // Longer numbers may overflow
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// parseCLFTime decodes a timestamp with the fixed-width clfTimeLayout
+// (eg. '09/May/2018:16:00:39 +0000'), which is much faster than time.Parse.
+// Values out of range are rejected
+func parseCLFTime(s string) (time.Time, bool) {
+	if len(s) != clfTimeLength || s[2] != '/' || s[6] != '/' || s[11] != ':' || s[14] != ':' ||
+		s[17] != ':' || s[20] != ' ' || (s[21] != '+' && s[21] != '-') {
+		return time.Time{}, false
+	}
+	day, ok1 := atoi(s[0:2])
+	year, ok2 := atoi(s[7:11])
+	hour, ok3 := atoi(s[12:14])
+	minute, ok4 := atoi(s[15:17])
+	sec, ok5 := atoi(s[18:20])
+	zoneHour, ok6 := atoi(s[22:24])
+	zoneMin, ok7 := atoi(s[24:26])
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7) {
+		return time.Time{}, false
+	}
+	month := parseMonth(s[3:6])
+	if month == 0 || day < 1 || day > daysIn(month, year) || hour > 23 || minute > 59 || sec > 59 ||
+		zoneHour > 23 || zoneMin > 59 {
+		return time.Time{}, false
+	}
+
+	offset := (zoneHour*60 + zoneMin) * 60
+	if s[21] == '-' {
+		offset = -offset
+	}
+	return time.Date(year, month, day, hour, minute, sec, 0, fixedZone(offset)), true
+}
+
+// parseMonth returns the month of its three-letter abbreviation or 0 if there's no such month
+func parseMonth(s string) time.Month {
+	switch s {
+	case "Jan":
+		return time.January
+	case "Feb":
+		return time.February
+	case "Mar":
+		return time.March
+	case "Apr":
+		return time.April
+	case "May":
+		return time.May
+	case "Jun":
+		return time.June
+	case "Jul":
+		return time.July
+	case "Aug":
+		return time.August
+	case "Sep":
+		return time.September
+	case "Oct":
+		return time.October
+	case "Nov":
+		return time.November
+	case "Dec":
+		return time.December
+	}
+	return 0
+}
+
+// daysIn returns the number of days of the month in the year
+func daysIn(m time.Month, year int) int {
+	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// fixedZone returns the cached time zone with the offset in seconds east of UTC
+func fixedZone(offset int) *time.Location {
+	zonesMu.RLock()
+	loc, ok := zones[offset]
+	zonesMu.RUnlock()
+	if ok {
+		return loc
+	}
+
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	if loc, ok = zones[offset]; !ok {
+		loc = time.FixedZone("", offset)
+		zones[offset] = loc
+	}
+	return loc
+}
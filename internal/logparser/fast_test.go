@@ -0,0 +1,158 @@
+package logparser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fastTestLines = []string{
+	`127.0.0.1 asd james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+	`127.0.0.1 - james [09/May/2018:16:00:39 +0200] "GET /report/foo/bar HTTP/1.0" 200 123`,
+	`127.0.0.1 - james [09/May/2018:16:00:39 -0530] "POST http://example.com/report/foo/bar HTTP/1.1" 201 -`,
+	`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /users/42/orders?id=1&q=a%20b HTTP/1.1" 200 0`,
+	`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "http://example.com/start" "Mozilla/5.0 (X11; Linux x86_64)"`,
+	`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl \"7.58.0\""`,
+	`127.0.0.1 - james [29/Feb/2016:23:59:59 +0000] "GET /report HTTP/1.0" 404 0`,
+	`www.example.com:443 127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+}
+
+func TestFast_ParseLine(t *testing.T) {
+	fast := NewFast()
+	httpd := New()
+
+	for _, line := range fastTestLines {
+		exp, expErr := httpd.ParseLine(line)
+		assert.NoError(t, expErr, line)
+		parsed, err := fast.ParseLine(line)
+		assert.NoError(t, err, line)
+
+		// Same instant, but the time zones may be different instances
+		assert.True(t, exp.Date.Equal(parsed.Date), line)
+		exp.Date, parsed.Date = time.Time{}, time.Time{}
+		assert.Equal(t, exp, parsed, line)
+	}
+}
+
+func TestFast_ParseLine_Err(t *testing.T) {
+	testCases := []string{
+		"asd",
+		"",
+		`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET report HTTP/1.0" 200 123`,
+		`127.0.0.1 - james "GET /report HTTP/1.0" 200 123`,
+		`127.0.0.1 - james [09/May/2018:16:00:39] "GET /report HTTP/1.0" 200 123`,
+		`127.0.0.1 - james [09/May/2018] "GET /report HTTP/1.0" 200 123`,
+		string([]byte("0x1")),
+	}
+
+	p := NewFast()
+	for _, line := range testCases {
+		parsed, err := p.ParseLine(line)
+		assert.Error(t, err, line)
+		assert.Nil(t, parsed)
+	}
+}
+
+func TestParseFast(t *testing.T) {
+	testCases := []struct {
+		line   string
+		expNil bool
+	}{
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`, false},
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl/7.58.0"`, false},
+		// Escaped quotes are left to the fallback
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl \"7.58.0\""`, true},
+		// Missing protocol
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report" 200 123`, true},
+		// Invalid status code
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 999 123`, true},
+		// Invalid size
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 12a`, true},
+		// Trailing data
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl" extra`, true},
+		// Missing user agent
+		{`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-"`, true},
+		// Virtual host is left to the fallback
+		{`www.example.com:443 127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`, true},
+		// Double space between fields
+		{`127.0.0.1  - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`, true},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expNil, parseFast(tt.line) == nil, tt.line)
+	}
+}
+
+func TestParseCLFTime(t *testing.T) {
+	testCases := []struct {
+		value     string
+		shouldErr bool
+	}{
+		{"09/May/2018:16:00:39 +0000", false},
+		{"09/May/2018:16:00:39 +0230", false},
+		{"31/Dec/1999:23:59:59 -1200", false},
+		{"29/Feb/2016:00:00:00 +0000", false},
+		{"29/Feb/2018:00:00:00 +0000", true},
+		{"00/May/2018:16:00:39 +0000", true},
+		{"09/Foo/2018:16:00:39 +0000", true},
+		{"09/may/2018:16:00:39 +0000", true},
+		{"09/May/2018:24:00:39 +0000", true},
+		{"09/May/2018:16:60:39 +0000", true},
+		{"09/May/2018:16:00:60 +0000", true},
+		{"09/May/2018:16:00:39 0000", true},
+		{"09/May/2018:16:00:39 *0000", true},
+		{"09/May/2018 16:00:39 +0000", true},
+		{"9/May/2018:16:00:39 +0000", true},
+		{"09/May/2018:16:00:39 +00:00", true},
+	}
+
+	for _, tt := range testCases {
+		parsed, ok := parseCLFTime(tt.value)
+		assert.Equal(t, tt.shouldErr, !ok, tt.value)
+		if ok {
+			exp, err := time.Parse(clfTimeLayout, tt.value)
+			assert.NoError(t, err)
+			assert.True(t, exp.Equal(parsed), tt.value)
+			_, expOffset := exp.Zone()
+			_, offset := parsed.Zone()
+			assert.Equal(t, expOffset, offset, tt.value)
+		}
+	}
+}
+
+func TestFixedZone(t *testing.T) {
+	loc := fixedZone(3600)
+	assert.True(t, loc == fixedZone(3600))
+	_, offset := time.Date(2018, time.May, 9, 0, 0, 0, 0, loc).Zone()
+	assert.Equal(t, 3600, offset)
+}
+
+func benchmarkParseLine(b *testing.B, p Parser, line string) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ParseLine(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHTTPd_ParseLine_Common(b *testing.B) {
+	benchmarkParseLine(b, New(), fastTestLines[1])
+}
+
+func BenchmarkFast_ParseLine_Common(b *testing.B) {
+	benchmarkParseLine(b, NewFast(), fastTestLines[1])
+}
+
+func BenchmarkHTTPd_ParseLine_Combined(b *testing.B) {
+	benchmarkParseLine(b, New(), fastTestLines[4])
+}
+
+func BenchmarkFast_ParseLine_Combined(b *testing.B) {
+	benchmarkParseLine(b, NewFast(), fastTestLines[4])
+}
+
+func BenchmarkFast_ParseLine_Fallback(b *testing.B) {
+	benchmarkParseLine(b, NewFast(), fastTestLines[5])
+}
@@ -0,0 +1,263 @@
+package logparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatToken is a single element of a compiled log format. It is either a literal string
+// that must appear as is in the log line or a named field whose value is extracted from it
+type formatToken struct {
+	literal   string
+	field     string // Name of the field, empty for literals
+	quoted    bool   // Whether the field is enclosed in double quotes (and escaped)
+	bracketed bool   // Whether the field value is enclosed in square brackets (eg. [date])
+}
+
+func (t formatToken) isField() bool {
+	return t.field != ""
+}
+
+// appendLiteral appends the literal s to tokens, merging it with the previous literal (if any)
+func appendLiteral(tokens []formatToken, s string) []formatToken {
+	if s == "" {
+		return tokens
+	}
+	if n := len(tokens); n > 0 && !tokens[n-1].isField() {
+		tokens[n-1].literal += s
+		return tokens
+	}
+	return append(tokens, formatToken{literal: s})
+}
+
+// appendField appends the field named name to tokens. The field is considered quoted if the
+// literal before it ends with a double quote.
+// Bracketed fields are written by the web server itself within square brackets, which are
+// stripped from the field value
+func appendField(tokens []formatToken, name string, bracketed bool) []formatToken {
+	quoted := false
+	if n := len(tokens); n > 0 && !tokens[n-1].isField() {
+		quoted = strings.HasSuffix(tokens[n-1].literal, `"`)
+	}
+	return append(tokens, formatToken{field: name, quoted: quoted, bracketed: bracketed})
+}
+
+// matchTokens matches line against the compiled format tokens and returns the values of the
+// fields in the same order they appear in tokens.
+// A field spans up to the next occurrence of the literal following it (or up to the first
+// space if it's followed by another field) and the last field spans up to the end of the line.
+// Returns an error if the line doesn't match the format
+func matchTokens(tokens []formatToken, line string) ([]string, error) {
+	var values []string
+	pos := 0
+	for i, t := range tokens {
+		if !t.isField() {
+			if !strings.HasPrefix(line[pos:], t.literal) {
+				return nil, fmt.Errorf("expected %q at position %d", t.literal, pos)
+			}
+			pos += len(t.literal)
+			continue
+		}
+
+		if t.bracketed {
+			end := strings.IndexByte(line[pos:], ']')
+			if !strings.HasPrefix(line[pos:], "[") || end < 0 {
+				return nil, fmt.Errorf("expected field %s within square brackets at position %d", t.field, pos)
+			}
+			values = append(values, line[pos+1:pos+end])
+			pos += end + 1
+			continue
+		}
+
+		end := len(line)
+		if i+1 < len(tokens) {
+			next := tokens[i+1]
+			if next.isField() {
+				end = strings.IndexByte(line[pos:], ' ')
+			} else {
+				end = indexLiteral(line[pos:], next.literal, t.quoted)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("cannot find the end of field %s", t.field)
+			}
+			end += pos
+		}
+
+		value := line[pos:end]
+		if t.quoted {
+			value = unescape(value)
+		}
+		values = append(values, value)
+		pos = end
+	}
+	if pos != len(line) {
+		return nil, fmt.Errorf("unexpected trailing data at position %d", pos)
+	}
+	return values, nil
+}
+
+// indexLiteral returns the index of the first occurrence of literal in s or -1 if not found.
+// Backslash-escaped characters are skipped if escaped is true
+func indexLiteral(s, literal string, escaped bool) int {
+	if !escaped {
+		return strings.Index(s, literal)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], literal) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape reverts the escaping applied to quoted fields by the web server (eg. \" and \xhh)
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			if i+2 < len(s) {
+				if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 2
+					continue
+				}
+			}
+			b.WriteString(`\x`)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitFields splits a line in its space-separated fields, where double-quoted fields may contain
+// spaces and escaped quotes. Quotes are removed and escape sequences decoded
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ':
+			i++
+		case '"':
+			end := indexLiteral(line[i+1:], `"`, true)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted field at position %d", i)
+			}
+			fields = append(fields, unescape(line[i+1:i+1+end]))
+			i += end + 2
+			if i < len(line) && line[i] != ' ' {
+				return nil, fmt.Errorf("unexpected character after quoted field at position %d", i)
+			}
+		default:
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				end = len(line) - i
+			}
+			fields = append(fields, line[i:i+end])
+			i += end
+		}
+	}
+	return fields, nil
+}
+
+// parseRequest splits the first line of the request (eg. "GET /report HTTP/1.0") into its
+// method, resource and protocol
+func parseRequest(request string) (string, string, string, error) {
+	split := strings.Fields(request)
+	if len(split) != 3 {
+		return "", "", "", fmt.Errorf("invalid request: %s", request)
+	}
+	return split[0], split[1], split[2], nil
+}
+
+// parseSize parses a response size in bytes. The "-" value (no content) is considered as 0
+func parseSize(s string) (int, error) {
+	if s == "-" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return size, nil
+}
+
+// parseStatusCode parses an HTTP status code
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code >= 600 {
+		return 0, fmt.Errorf("invalid status code: %s", s)
+	}
+	return code, nil
+}
+
+// parseTime parses a date with the given layout. Dates without a time zone are in local time, as
+// written by the web servers
+func parseTime(layout, v string) (time.Time, error) {
+	t, err := time.ParseInLocation(layout, v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %v", err)
+	}
+	return t, nil
+}
+
+// parseEpoch parses a date expressed as a number of units since the epoch, with an optional
+// decimal fraction (eg. "1525881639.250" seconds)
+func parseEpoch(v string, unit time.Duration) (time.Time, error) {
+	ns, err := parseDecimal(v, unit)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %s", v)
+	}
+	return time.Unix(0, ns), nil
+}
+
+// parseDuration parses a duration expressed as a number of units, with an optional decimal
+// fraction (eg. "0.120" seconds)
+func parseDuration(v string, unit time.Duration) (time.Duration, error) {
+	ns, err := parseDecimal(v, unit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", v)
+	}
+	return time.Duration(ns), nil
+}
+
+// parseDecimal converts the non-negative decimal number of units v to nanoseconds.
+// The conversion is exact, as opposed to parsing v as a float
+func parseDecimal(v string, unit time.Duration) (int64, error) {
+	split := strings.SplitN(v, ".", 2)
+	n, err := strconv.ParseInt(split[0], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid decimal number: %s", v)
+	}
+	ns := n * int64(unit)
+	if len(split) == 2 {
+		frac, err := strconv.ParseUint(split[1], 10, 64)
+		if err != nil || len(split[1]) > 9 {
+			return 0, fmt.Errorf("invalid decimal number: %s", v)
+		}
+		for i := len(split[1]); i < 9; i++ {
+			frac *= 10
+		}
+		ns += int64(frac) * int64(unit) / int64(time.Second)
+	}
+	return ns, nil
+}
@@ -0,0 +1,131 @@
+package logparser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTokens(t *testing.T) {
+	var tokens []formatToken
+	tokens = appendField(tokens, "host", false)
+	tokens = appendLiteral(tokens, " ")
+	tokens = appendField(tokens, "time", true)
+	tokens = appendLiteral(tokens, ` "`)
+	tokens = appendField(tokens, "request", false)
+	tokens = appendLiteral(tokens, `" `)
+	tokens = appendField(tokens, "status", false)
+	tokens = appendLiteral(tokens, " ")
+	tokens = appendField(tokens, "size", false)
+
+	assert.Len(t, tokens, 9)
+	assert.False(t, tokens[0].quoted)
+	assert.True(t, tokens[2].bracketed)
+	assert.True(t, tokens[4].quoted)
+
+	testCases := []struct {
+		line      string
+		expValues []string
+		shouldErr bool
+	}{
+		{
+			`127.0.0.1 [right now] "GET / HTTP/1.0" 200 123`,
+			[]string{"127.0.0.1", "right now", "GET / HTTP/1.0", "200", "123"},
+			false,
+		},
+		{
+			`127.0.0.1 [now] "GET /\"quoted\" HTTP/1.0" 200 123`,
+			[]string{"127.0.0.1", "now", `GET /"quoted" HTTP/1.0`, "200", "123"},
+			false,
+		},
+		{
+			`127.0.0.1 now "GET / HTTP/1.0" 200 123`,
+			nil,
+			true,
+		},
+		{
+			`127.0.0.1 [now] "GET / HTTP/1.0 200 123`,
+			nil,
+			true,
+		},
+		{
+			`127.0.0.1 [now] "GET / HTTP/1.0" 200`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range testCases {
+		values, err := matchTokens(tokens, tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil)
+		assert.Equal(t, tt.expValues, values)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	testCases := []struct {
+		s   string
+		exp string
+	}{
+		{"foo", "foo"},
+		{`foo \"bar\"`, `foo "bar"`},
+		{`a\\b`, `a\b`},
+		{`a\tb\nc`, "a\tb\nc"},
+		{`\x41\x42`, "AB"},
+		{`\xZZ`, `\xZZ`},
+		{`trailing\`, `trailing\`},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.exp, unescape(tt.s))
+	}
+}
+
+func TestSplitFields(t *testing.T) {
+	testCases := []struct {
+		line      string
+		exp       []string
+		shouldErr bool
+	}{
+		{"a b c", []string{"a", "b", "c"}, false},
+		{`a "b c" d`, []string{"a", "b c", "d"}, false},
+		{`a "" "- - - " d`, []string{"a", "", "- - - ", "d"}, false},
+		{`"a \"b\" c"`, []string{`a "b" c`}, false},
+		{"a  b ", []string{"a", "b"}, false},
+		{"", nil, false},
+		{`a "b c`, nil, true},
+		{`a "b"c`, nil, true},
+	}
+
+	for _, tt := range testCases {
+		fields, err := splitFields(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.Equal(t, tt.exp, fields, tt.line)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local = time.FixedZone("EDT", -4*3600)
+
+	testCases := []struct {
+		layout    string
+		v         string
+		exp       time.Time
+		shouldErr bool
+	}{
+		// Local time without a zone
+		{"2006-01-02 15:04:05", "2018-05-09 12:00:39", time.Date(2018, 5, 9, 16, 0, 39, 0, time.UTC), false},
+		{clfTimeLayout, "09/May/2018:16:00:39 +0000", time.Date(2018, 5, 9, 16, 0, 39, 0, time.UTC), false},
+		{time.RFC3339, "2018-05-09T18:00:39+02:00", time.Date(2018, 5, 9, 16, 0, 39, 0, time.UTC), false},
+		{time.RFC3339, "asd", time.Time{}, true},
+	}
+
+	for _, tt := range testCases {
+		d, err := parseTime(tt.layout, tt.v)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.v)
+		assert.True(t, tt.exp.Equal(d), tt.v)
+	}
+}
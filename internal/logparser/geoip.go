@@ -0,0 +1,99 @@
+package logparser
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP looks up the location and the autonomous system of IP addresses in local MaxMind DB files
+// (eg. the GeoLite2 City, Country and ASN databases), without any network call
+type GeoIP struct {
+	readers []*maxminddb.Reader
+}
+
+// GeoInfo is the location and the autonomous system of an IP address. Fields are empty if
+// unknown
+type GeoInfo struct {
+	Country string // ISO 3166-1 code, eg. US
+	City    string // English name
+	ASN     uint
+	ASOrg   string
+}
+
+// geoRecord holds the fields decoded from the records of any of the supported databases
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// OpenGeoIP returns the lookups in the given databases, whose fields are merged so that eg. a City
+// and an ASN database can be used together.
+// Returns an error if any of the databases cannot be opened
+func OpenGeoIP(fileNames ...string) (*GeoIP, error) {
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no GeoIP database")
+	}
+	g := &GeoIP{}
+	for _, fileName := range fileNames {
+		r, err := maxminddb.Open(fileName)
+		if err != nil {
+			g.Close()
+			return nil, fmt.Errorf("cannot open GeoIP database %s: %v", fileName, err)
+		}
+		g.readers = append(g.readers, r)
+	}
+	return g, nil
+}
+
+// Lookup returns the location and the autonomous system of the given host. Nothing is returned
+// for hosts that aren't IP addresses (eg. hostnames) or that aren't in the databases
+func (g *GeoIP) Lookup(host string) GeoInfo {
+	var info GeoInfo
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return info
+	}
+
+	for _, r := range g.readers {
+		var rec geoRecord
+		// Addresses not in the database are no error. IPv6 addresses are one for IPv4-only databases
+		if err := r.Lookup(ip, &rec); err != nil {
+			continue
+		}
+		if info.Country == "" {
+			info.Country = rec.Country.ISOCode
+		}
+		if info.Country == "" {
+			info.Country = rec.RegisteredCountry.ISOCode
+		}
+		if info.City == "" {
+			info.City = rec.City.Names["en"]
+		}
+		if info.ASN == 0 {
+			info.ASN, info.ASOrg = rec.ASN, rec.ASOrg
+		}
+	}
+	return info
+}
+
+// Close closes the databases. No lookup can be done afterwards
+func (g *GeoIP) Close() error {
+	var err error
+	for _, r := range g.readers {
+		if cErr := r.Close(); cErr != nil {
+			err = cErr
+		}
+	}
+	return err
+}
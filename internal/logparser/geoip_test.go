@@ -0,0 +1,72 @@
+package logparser
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/fileutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenGeoIP_Err(t *testing.T) {
+	g, err := OpenGeoIP()
+	assert.Error(t, err)
+	assert.Nil(t, g)
+
+	g, err = OpenGeoIP("/non/existent/file.mmdb")
+	assert.Error(t, err)
+	assert.Nil(t, g)
+
+	f, err := ioutil.TempFile("", "geoip")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("not a database")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	g, err = OpenGeoIP(f.Name())
+	assert.Error(t, err)
+	assert.Nil(t, g)
+}
+
+func TestGeoIP_Lookup(t *testing.T) {
+	city, err := fileutils.CreateTestMMDB(map[string]map[string]interface{}{
+		"81.2.69.0/24": {
+			"country": map[string]interface{}{"iso_code": "GB"},
+			"city":    map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+		},
+		"1.2.0.0/16": {
+			"registered_country": map[string]interface{}{"iso_code": "AU"},
+		},
+	})
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(city)
+	asn, err := fileutils.CreateTestMMDB(map[string]map[string]interface{}{
+		"81.2.64.0/20": {
+			"autonomous_system_number":       uint32(20712),
+			"autonomous_system_organization": "Andrews & Arnold Ltd",
+		},
+	})
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(asn)
+
+	g, err := OpenGeoIP(city.Name(), asn.Name())
+	assert.NoError(t, err)
+	defer g.Close()
+
+	testCases := []struct {
+		host    string
+		expInfo GeoInfo
+	}{
+		{"81.2.69.160", GeoInfo{Country: "GB", City: "London", ASN: 20712, ASOrg: "Andrews & Arnold Ltd"}},
+		{"81.2.70.1", GeoInfo{ASN: 20712, ASOrg: "Andrews & Arnold Ltd"}},
+		{"1.2.3.4", GeoInfo{Country: "AU"}},
+		{"127.0.0.1", GeoInfo{}},
+		{"2001:db8::1", GeoInfo{}},
+		{"example.com", GeoInfo{}},
+		{"-", GeoInfo{}},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expInfo, g.Lookup(tt.host), tt.host)
+	}
+}
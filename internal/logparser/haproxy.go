@@ -0,0 +1,195 @@
+package logparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// haproxyDateLayout is the layout of the accept date of the HAProxy logs (eg. 06/Feb/2009:12:14:14.655)
+const haproxyDateLayout = "02/Jan/2006:15:04:05.000"
+
+// haproxyTimers are the names of the timers of the HAProxy HTTP logs, in the order they're logged
+var haproxyTimers = []string{"Tq", "Tw", "Tc", "Tr", "Tt"}
+
+// haproxyConns are the names of the connection counters of the HAProxy HTTP logs, in the order
+// they're logged
+var haproxyConns = []string{"actconn", "feconn", "beconn", "srv_conn", "retries"}
+
+// HAProxy the parser for the HAProxy HTTP logs (ie. 'option httplog').
+// See https://www.haproxy.org/download/1.8/doc/configuration.txt (section 8.2.3)
+type HAProxy struct{}
+
+// NewHAProxy returns a parser for the HAProxy HTTP logs. Cannot return nil
+func NewHAProxy() *HAProxy {
+	return &HAProxy{}
+}
+
+// ParseLine takes a single log line, optionally prefixed by its syslog header, and returns
+// either its parsed version and an error in case the line is malformed or misses some
+// required field (eg. the date).
+// The duration is the total time (Tt) and the backend duration is the time taken by the
+// server to send the response headers (Tr), both meaningful only if not aborted (ie. -1).
+// The frontend name, the timers, the termination state and the other fields that have no
+// counterpart in Line are stored in Line.Extra.
+// If a single block of captured headers is present, it's considered as the request one
+func (p *HAProxy) ParseLine(line string) (*Line, error) {
+	if _, msg, ok := parseSyslogHeader(line); ok {
+		line = msg
+	}
+
+	reqStart := strings.IndexByte(line, '"')
+	if reqStart < 0 || !strings.HasSuffix(line, `"`) || reqStart == len(line)-1 {
+		return nil, fmt.Errorf("missing request in HAProxy log line: %s", line)
+	}
+	request := line[reqStart+1 : len(line)-1]
+
+	fields, err := splitHAProxyFields(line[:reqStart])
+	if err != nil {
+		return nil, fmt.Errorf("invalid HAProxy log line: %v", err)
+	}
+	// Up to two blocks of captured headers may follow the queues
+	headers := 0
+	for i := len(fields) - 1; i >= 0 && headers < 2 && strings.HasPrefix(fields[i], "{"); i-- {
+		headers++
+	}
+	if len(fields)-headers != 12 {
+		return nil, fmt.Errorf("line has %d fields, expected 12: %s", len(fields)-headers, line)
+	}
+
+	l := &Line{}
+	// IPv6 addresses are not enclosed in square brackets (eg. 2001:db8::1:33317)
+	l.RemoteHost = fields[0]
+	if i := strings.LastIndexByte(fields[0], ':'); i > 0 {
+		l.RemoteHost = fields[0][:i]
+	}
+	if l.Date, err = parseHAProxyDate(fields[1]); err != nil {
+		return nil, err
+	}
+	l.setExtra("frontend_name", fields[2])
+
+	split := strings.Split(fields[3], "/")
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid backend/server: %s", fields[3])
+	}
+	l.Backend, l.Server = split[0], split[1]
+
+	timers, err := parseHAProxyCounters(fields[4], haproxyTimers)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range haproxyTimers {
+		l.setExtra(name, strconv.Itoa(timers[i]))
+	}
+	if tt := timers[4]; tt >= 0 {
+		l.Duration = time.Duration(tt) * time.Millisecond
+		l.HasDuration = true
+	}
+	if tr := timers[3]; tr >= 0 {
+		l.BackendDuration = time.Duration(tr) * time.Millisecond
+		l.HasBackendDuration = true
+	}
+
+	if l.StatusCode, err = parseStatusCode(fields[5]); err != nil {
+		return nil, err
+	}
+	if l.ContentLength, err = parseSize(strings.TrimPrefix(fields[6], "+")); err != nil {
+		return nil, err
+	}
+	l.setExtra("captured_request_cookie", fields[7])
+	l.setExtra("captured_response_cookie", fields[8])
+	l.setExtra("termination_state", fields[9])
+
+	conns, err := parseHAProxyCounters(fields[10], haproxyConns)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range haproxyConns {
+		l.setExtra(name, strconv.Itoa(conns[i]))
+	}
+	queues, err := parseHAProxyCounters(fields[11], []string{"srv_queue", "backend_queue"})
+	if err != nil {
+		return nil, err
+	}
+	l.setExtra("srv_queue", strconv.Itoa(queues[0]))
+	l.setExtra("backend_queue", strconv.Itoa(queues[1]))
+
+	for i, name := range []string{"captured_request_headers", "captured_response_headers"}[:headers] {
+		h := fields[12+i]
+		l.setExtra(name, h[1:len(h)-1])
+	}
+
+	var resource string
+	if l.Method, resource, l.Protocol, err = parseRequest(request); err != nil {
+		return nil, err
+	}
+	if err = l.setResource(resource); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// splitHAProxyFields splits s in its space-separated fields, where the accept date is enclosed
+// in square brackets and the captured headers in curly braces (both may contain spaces)
+func splitHAProxyFields(s string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(s); {
+		if s[i] == ' ' {
+			i++
+			continue
+		}
+		var end int
+		switch s[i] {
+		case '[', '{':
+			closing := byte(']')
+			if s[i] == '{' {
+				closing = '}'
+			}
+			end = strings.IndexByte(s[i:], closing)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated field at position %d", i)
+			}
+			end++
+		default:
+			end = strings.IndexByte(s[i:], ' ')
+			if end < 0 {
+				end = len(s) - i
+			}
+		}
+		fields = append(fields, s[i:i+end])
+		i += end
+	}
+	return fields, nil
+}
+
+// parseHAProxyDate parses the accept date of the request, enclosed in square brackets
+func parseHAProxyDate(v string) (time.Time, error) {
+	if len(v) < 2 || v[0] != '[' || v[len(v)-1] != ']' {
+		return time.Time{}, fmt.Errorf("invalid date: %s", v)
+	}
+	t, err := time.ParseInLocation(haproxyDateLayout, v[1:len(v)-1], time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %v", err)
+	}
+	return t, nil
+}
+
+// parseHAProxyCounters parses the slash-separated list of integers v (eg. the timers
+// '10/0/30/69/109'), which must have one value for each name.
+// Values may be -1 (eg. aborted timers) or be prefixed by '+' (eg. with 'option logasap')
+func parseHAProxyCounters(v string, names []string) ([]int, error) {
+	split := strings.Split(v, "/")
+	if len(split) != len(names) {
+		return nil, fmt.Errorf("invalid %s: %s", strings.Join(names, "/"), v)
+	}
+	values := make([]int, len(split))
+	for i, s := range split {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "+"))
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("invalid %s: %s", names[i], v)
+		}
+		values[i] = n
+	}
+	return values, nil
+}
@@ -0,0 +1,214 @@
+package logparser
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testHAProxyLine = `10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"`
+
+func TestNewHAProxy(t *testing.T) {
+	assert.NotNil(t, NewHAProxy())
+}
+
+func TestHAProxy_ParseLine(t *testing.T) {
+	dateTime := time.Date(2009, time.February, 6, 12, 14, 14, 655000000, time.Local)
+	extra := func(overrides map[string]string) map[string]string {
+		m := map[string]string{
+			"frontend_name":            "http-in",
+			"Tq":                       "10",
+			"Tw":                       "0",
+			"Tc":                       "30",
+			"Tr":                       "69",
+			"Tt":                       "109",
+			"captured_request_cookie":  "-",
+			"captured_response_cookie": "-",
+			"termination_state":        "----",
+			"actconn":                  "1",
+			"feconn":                   "1",
+			"beconn":                   "1",
+			"srv_conn":                 "1",
+			"retries":                  "0",
+			"srv_queue":                "0",
+			"backend_queue":            "0",
+		}
+		for k, v := range overrides {
+			m[k] = v
+		}
+		return m
+	}
+
+	testCases := []struct {
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			testHAProxyLine,
+			&Line{
+				RemoteHost:         "10.0.1.2",
+				Date:               dateTime,
+				Method:             "GET",
+				Path:               "/index.html",
+				Route:              "/index.html",
+				Section:            "/index.html",
+				Protocol:           "HTTP/1.1",
+				StatusCode:         200,
+				ContentLength:      2750,
+				Duration:           109 * time.Millisecond,
+				HasDuration:        true,
+				BackendDuration:    69 * time.Millisecond,
+				HasBackendDuration: true,
+				Backend:            "static",
+				Server:             "srv1",
+				Extra: extra(map[string]string{
+					"captured_request_headers":  "1wt.eu",
+					"captured_response_headers": "",
+				}),
+			},
+			false,
+		},
+		{
+			// RFC 3164 syslog prefix, no captured headers
+			`Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in~ api/srv2 10/0/30/69/109 503 212 - - SC-- 1/1/1/1/+3 0/0 "POST /api/users/42?debug=1 HTTP/1.1"`,
+			&Line{
+				RemoteHost:         "10.0.1.2",
+				Date:               dateTime,
+				Method:             "POST",
+				Path:               "/api/users/42",
+				Route:              "/api/users/:id",
+				Section:            "/api",
+				Query:              url.Values{"debug": {"1"}},
+				Protocol:           "HTTP/1.1",
+				StatusCode:         503,
+				ContentLength:      212,
+				Duration:           109 * time.Millisecond,
+				HasDuration:        true,
+				BackendDuration:    69 * time.Millisecond,
+				HasBackendDuration: true,
+				Backend:            "api",
+				Server:             "srv2",
+				Extra: extra(map[string]string{
+					"frontend_name":     "http-in~",
+					"termination_state": "SC--",
+					"retries":           "3",
+				}),
+			},
+			false,
+		},
+		{
+			// RFC 3339 syslog prefix, aborted request with 'option logasap' and a single captured header
+			`<134>2009-02-06T12:14:14.655+01:00 lb1 haproxy: 2001:db8::1:33317 [06/Feb/2009:12:14:14.655] http-in static/<NOSRV> -1/-1/-1/-1/+0 400 +187 - - CR-- 1/1/0/0/0 0/0 {Mozilla/5.0 (X11; Linux x86_64)} "GET / HTTP/1.1"`,
+			&Line{
+				RemoteHost:    "2001:db8::1",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/",
+				Route:         "/",
+				Section:       "/",
+				Protocol:      "HTTP/1.1",
+				StatusCode:    400,
+				ContentLength: 187,
+				Duration:      0,
+				HasDuration:   true,
+				Backend:       "static",
+				Server:        "<NOSRV>",
+				Extra: extra(map[string]string{
+					"Tq":                       "-1",
+					"Tw":                       "-1",
+					"Tc":                       "-1",
+					"Tr":                       "-1",
+					"Tt":                       "0",
+					"termination_state":        "CR--",
+					"beconn":                   "0",
+					"srv_conn":                 "0",
+					"captured_request_headers": "Mozilla/5.0 (X11; Linux x86_64)",
+				}),
+			},
+			false,
+		},
+		{
+			// Bad request
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in http-in/<NOSRV> -1/-1/-1/-1/2 400 187 - - PR-- 1/1/0/0/0 0/0 "<BADREQ>"`,
+			nil,
+			true,
+		},
+		{
+			// Missing request
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0`,
+			nil,
+			true,
+		},
+		{
+			// Missing queues
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 "GET / HTTP/1.1"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid date
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid backend/server
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid timers
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69 200 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid status code
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 -1 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+			nil,
+			true,
+		},
+		{
+			// Unterminated captured headers
+			`10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu "GET / HTTP/1.1"`,
+			nil,
+			true,
+		},
+		{
+			testCommonLine,
+			nil,
+			true,
+		},
+	}
+
+	p := NewHAProxy()
+	for _, tt := range testCases {
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.Equal(t, tt.expLine, parsed, tt.line)
+	}
+}
+
+func TestParseHAProxyCounters(t *testing.T) {
+	testCases := []struct {
+		v         string
+		expValues []int
+		shouldErr bool
+	}{
+		{"10/0/30/69/109", []int{10, 0, 30, 69, 109}, false},
+		{"-1/-1/-1/-1/+2", []int{-1, -1, -1, -1, 2}, false},
+		{"10/0/30/69", nil, true},
+		{"10/0/30/69/a", nil, true},
+		{"10/0/30/69/-2", nil, true},
+	}
+
+	for _, tt := range testCases {
+		values, err := parseHAProxyCounters(tt.v, haproxyTimers)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.v)
+		assert.Equal(t, tt.expValues, values, tt.v)
+	}
+}
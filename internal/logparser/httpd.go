@@ -12,72 +12,211 @@ import (
 // HTTPd the apache httpd server log parser
 type HTTPd struct {
 	*axslogparser.Apache
+	format *logFormat // Custom LogFormat, nil for the Common and Combined Log Formats
 }
 
 // Line represents the parsed log line.
 // See https://www.w3.org/Daemon/User/Config/Logging.html#common-logfile-format for
 // more information about the format.
+// VHost is the virtual host that served the request (eg. '%v' in Apache httpd LogFormat strings),
+// empty if the log format doesn't record it.
+// Referer and UserAgent are filled only for lines in the Combined Log Format
+// (see https://httpd.apache.org/docs/2.4/logs.html#combined), otherwise they are empty.
+// Class is the class of the client (eg. human or bot) and BotName the name of the bot or of the
+// monitoring probe, both set by a Classifier from the user agent and empty otherwise.
+// Route is the path with its identifiers (eg. numeric IDs or UUIDs) replaced by placeholders,
+// so that requests to the same endpoint share it (eg. '/users/:id').
+// Query holds the parameters of the query string of the requested resource and it's nil if
+// the resource has no query string.
+// Duration is the time taken to serve the request and it's meaningful only if HasDuration is true.
+// BackendStatusCode and BackendDuration are the status code and the time taken by the backend
+// server, for the lines written by proxies and load balancers. The former is 0 if there was no
+// backend response and the latter is meaningful only if HasBackendDuration is true.
+// Backend and Server are the names of the pool of servers and of the server that handled
+// the request, for the lines written by proxies (eg. HAProxy) and empty otherwise.
+// Extra holds the fields of custom log formats that have no counterpart in Line, keyed by
+// the directive that produced them (eg. "%v" or "%{X-Request-Id}i").
 type Line struct {
+	VHost         string
 	RemoteHost    string
+	ClientIP      string
 	RemoteLogName string
 	User          string
 	Date          time.Time
 	Method        string
+	Path          string
+	Route         string
 	Section       string
+	Query         url.Values
 	Protocol      string
 	StatusCode    int
 	ContentLength int
+	Referer       string
+	UserAgent     string
+	Class         string
+	BotName       string
+	Country       string
+	City          string
+	ASN           uint
+	ASOrg         string
+	Duration      time.Duration
+	HasDuration   bool
+	// Backend (eg. the target of a load balancer) response
+	BackendStatusCode  int
+	BackendDuration    time.Duration
+	HasBackendDuration bool
+	Backend            string
+	Server             string
+	Labels             map[string]string // Business labels by name (eg. team), see LookupTable
+	Source             string            // Log file the line was read from, set by the monitor
+	Extra              map[string]string
+}
+
+// SectionError is the error returned by the parsers for lines whose requested resource has no
+// valid path, hence no section
+type SectionError struct {
+	Resource string
+	msg      string
+}
+
+func (e *SectionError) Error() string {
+	return e.msg
 }
 
 // New returns an httpd log parser. Cannot return nil
 func New() *HTTPd {
-	return &HTTPd{&axslogparser.Apache{}}
+	return &HTTPd{Apache: &axslogparser.Apache{}}
 }
 
-// ParseLine takes a single log line and returns either its parsed version and an error
-// in case the line is malformed or misses some required field (eg. the date)
-func (p *HTTPd) ParseLine(line string) (*Line, error) {
-	l, err := p.Parse(line)
+// NewWithFormat returns an httpd log parser for lines written with a custom LogFormat string
+// (see https://httpd.apache.org/docs/2.4/mod/mod_log_config.html#formats).
+// Returns an error if the format is invalid
+func NewWithFormat(format string) (*HTTPd, error) {
+	f, err := compileLogFormat(format)
 	if err != nil {
 		return nil, err
 	}
+	return &HTTPd{Apache: &axslogparser.Apache{}, format: f}, nil
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// Both the Common and the Combined Log Formats are accepted, unless the parser has a custom format.
+func (p *HTTPd) ParseLine(line string) (*Line, error) {
+	if p.format != nil {
+		return p.format.parse(line)
+	}
 
-	section, err := getSectionFromResource(l.RequestURI)
+	l, err := p.Parse(line)
 	if err != nil {
 		return nil, err
 	}
-	return &Line{
+
+	out := &Line{
+		VHost:         hostFromHostPort(l.VirtualHost), // Eg. www.example.com:80 for vhost_combined
 		RemoteHost:    l.Host,
 		RemoteLogName: l.RemoteLogname,
 		User:          l.User,
 		Date:          l.Time,
 		Method:        l.Method,
-		Section:       section,
 		Protocol:      l.Protocol,
 		StatusCode:    l.Status,
 		ContentLength: int(l.Size),
-	}, nil
+		Referer:       l.Referer,
+		UserAgent:     l.UserAgent,
+	}
+	if err := out.setResource(l.RequestURI); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-// getSectionFromResource returns a section from a resource path.
-// A section is defined as being what's before the second '/' in the resource section.
-// Eg. the section for '/pages/create' is '/pages'.
-// Returns an error if the path is the empty string
-func getSectionFromResource(path string) (string, error) {
-	parsed, err := url.Parse(path)
+// setExtra stores the value of a field that has no counterpart in Line
+func (l *Line) setExtra(key, value string) {
+	if l.Extra == nil {
+		l.Extra = make(map[string]string)
+	}
+	l.Extra[key] = value
+}
+
+// setResource sets the path, the route, the section and the query of the line from the requested
+// resource. Returns an error if the resource has no valid path
+func (l *Line) setResource(resource string) error {
+	path, rawQuery, err := parseResource(resource)
+	if err != nil {
+		return err
+	}
+	l.Path = path
+	l.Route = getRouteFromPath(path)
+	l.Section = getSectionFromPath(path, 1)
+	if rawQuery != "" {
+		// Malformed pairs are dropped, the line is still worth the other fields
+		l.Query, _ = url.ParseQuery(rawQuery)
+	}
+	return nil
+}
+
+// parseResource returns the path and the raw query of a resource, either a path or a full URL.
+// Eg. the path for 'http://example.com/pages/create?id=1' is '/pages/create' and its query 'id=1'.
+// Returns an error if the path is the empty string or doesn't start with '/'
+func parseResource(resource string) (string, string, error) {
+	if isPlainPath(resource) { // Skip url.Parse and its allocations
+		return resource, "", nil
+	}
+
+	parsed, err := url.Parse(resource)
 	if err != nil {
-		return "", fmt.Errorf("cannot parse resource: %v", err)
+		return "", "", &SectionError{Resource: resource, msg: fmt.Sprintf("cannot parse resource: %v", err)}
 	}
 	if parsed.Path == "" {
-		return "", fmt.Errorf("cannot get section on empty string path")
+		return "", "", &SectionError{Resource: resource, msg: "cannot get section on empty string path"}
 	}
 
 	if !strings.HasPrefix(parsed.Path, "/") { // Reject paths that don't start with /
-		return "", fmt.Errorf("cannot get section from path %s", parsed.Path)
+		return "", "", &SectionError{Resource: resource, msg: "cannot get section from path " + parsed.Path}
 	}
+	return parsed.Path, parsed.RawQuery, nil
+}
+
+// isPlainPath returns true if the resource is a path that url.Parse would return unchanged,
+// that is without scheme, host, query, fragment, escapes and control characters
+func isPlainPath(resource string) bool {
+	if !strings.HasPrefix(resource, "/") || strings.HasPrefix(resource, "//") {
+		return false
+	}
+	for i := 0; i < len(resource); i++ {
+		switch c := resource[i]; {
+		case c == '%' || c == '?' || c == '#':
+			return false
+		case c < 0x20 || c == 0x7f:
+			return false
+		}
+	}
+	return true
+}
+
+// getSectionFromPath returns a section from a path.
+// A section is defined as being what's before the (depth+1)-th '/' in the path.
+// Eg. the section for '/pages/create' is '/pages' with depth 1 and '/pages/create' with depth 2.
+// The path must start with '/'
+func getSectionFromPath(path string, depth int) string {
 	// Remove leading "/" since I'm sure it's there
-	stripped := strings.TrimLeft(parsed.Path, "/")
-	// Split on middle "/"s and take the first
-	split := strings.Split(stripped, "/")
-	return "/" + split[0], nil
+	stripped := strings.TrimLeft(path, "/")
+	// Find the end of the first depth segments
+	end := 0
+	for i := 0; i < depth && end < len(stripped); i++ {
+		if i > 0 {
+			end++ // Skip the "/" separating the segments
+		}
+		next := strings.IndexByte(stripped[end:], '/')
+		if next < 0 {
+			end = len(stripped)
+			break
+		}
+		end += next
+	}
+	if len(path)-len(stripped) == 1 {
+		return path[:end+1] // Avoid the allocation when the path has a single leading "/"
+	}
+	return "/" + stripped[:end]
 }
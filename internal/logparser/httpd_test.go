@@ -1,6 +1,7 @@
 package logparser
 
 import (
+	"net/url"
 	"testing"
 	"time"
 
@@ -25,6 +26,8 @@ func TestHTTPd_ParseLine(t *testing.T) {
 				User:          "james",
 				Date:          dateTime,
 				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
 				Section:       "/report",
 				Protocol:      "HTTP/1.0",
 				StatusCode:    200,
@@ -40,6 +43,27 @@ func TestHTTPd_ParseLine(t *testing.T) {
 				User:          "james",
 				Date:          dateTime,
 				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
+				Section:       "/report",
+				Protocol:      "HTTP/1.0",
+				StatusCode:    200,
+				ContentLength: 123,
+			},
+			false,
+		},
+		{
+			// Virtual host, with port as in vhost_combined
+			`www.example.com:443 127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+			&Line{
+				VHost:         "www.example.com",
+				RemoteHost:    "127.0.0.1",
+				RemoteLogName: "-",
+				User:          "james",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
 				Section:       "/report",
 				Protocol:      "HTTP/1.0",
 				StatusCode:    200,
@@ -55,6 +79,8 @@ func TestHTTPd_ParseLine(t *testing.T) {
 				User:          "james",
 				Date:          dateTime,
 				Method:        "GET",
+				Path:          "/report/foo/bar",
+				Route:         "/report/foo/bar",
 				Section:       "/report",
 				Protocol:      "HTTP/1.0",
 				StatusCode:    200,
@@ -70,10 +96,52 @@ func TestHTTPd_ParseLine(t *testing.T) {
 				User:          "james",
 				Date:          dateTime,
 				Method:        "GET",
+				Path:          "/report/foo/bar",
+				Route:         "/report/foo/bar",
+				Section:       "/report",
+				Protocol:      "HTTP/1.0",
+				StatusCode:    200,
+				ContentLength: 123,
+			},
+			false,
+		},
+		{
+			// Combined Log Format
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "http://example.com/start" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			&Line{
+				RemoteHost:    "127.0.0.1",
+				RemoteLogName: "-",
+				User:          "james",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
+				Section:       "/report",
+				Protocol:      "HTTP/1.0",
+				StatusCode:    200,
+				ContentLength: 123,
+				Referer:       "http://example.com/start",
+				UserAgent:     "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+			false,
+		},
+		{
+			// Combined Log Format with empty referer and escaped quotes in the user agent
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl \"7.58.0\""`,
+			&Line{
+				RemoteHost:    "127.0.0.1",
+				RemoteLogName: "-",
+				User:          "james",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
 				Section:       "/report",
 				Protocol:      "HTTP/1.0",
 				StatusCode:    200,
 				ContentLength: 123,
+				Referer:       "-",
+				UserAgent:     `curl "7.58.0"`,
 			},
 			false,
 		},
@@ -122,33 +190,39 @@ func TestHTTPd_ParseLine(t *testing.T) {
 	}
 }
 
-func TestGetSectionFromResource(t *testing.T) {
+func TestLine_SetResource(t *testing.T) {
 	testCases := []struct {
 		resource   string
+		expPath    string
 		expSection string
 		shouldErr  bool
 	}{
 		{
+			"/foo",
 			"/foo",
 			"/foo",
 			false,
 		},
 		{
+			"/foo/bar",
 			"/foo/bar",
 			"/foo",
 			false,
 		},
 		{
+			"/foo/bar/baz",
 			"/foo/bar/baz",
 			"/foo",
 			false,
 		},
 		{
+			"/",
 			"/",
 			"/",
 			false,
 		},
 		{
+			"",
 			"",
 			"",
 			true,
@@ -156,53 +230,118 @@ func TestGetSectionFromResource(t *testing.T) {
 		{
 			"foo",
 			"",
+			"",
 			true,
 		},
 		{
 			"foo/bar",
 			"",
+			"",
 			true,
 		},
 		{
 			"foo/bar/baz",
 			"",
+			"",
 			true,
 		},
 		{
 			"85:asd//asd.asd",
 			"",
+			"",
 			true,
 		},
 		{
 			"http://example.com/foo",
 			"/foo",
+			"/foo",
 			false,
 		},
 		{
 			"http://example.com/foo/bar",
+			"/foo/bar",
 			"/foo",
 			false,
 		},
 		{
 			"http://example.com/foo/bar/baz",
+			"/foo/bar/baz",
 			"/foo",
 			false,
 		},
 		{
 			"http://example.com/",
 			"/",
+			"/",
 			false,
 		},
 		{
 			"http://example.com",
 			"",
+			"",
 			true,
 		},
+		{
+			"/foo/bar?baz=1",
+			"/foo/bar",
+			"/foo",
+			false,
+		},
 	}
 
 	for _, tt := range testCases {
-		section, err := getSectionFromResource(tt.resource)
+		l := &Line{}
+		err := l.setResource(tt.resource)
 		assert.Equal(t, tt.shouldErr, err != nil)
-		assert.Equal(t, tt.expSection, section)
+		if err != nil {
+			assert.IsType(t, &SectionError{}, err)
+		}
+		assert.Equal(t, tt.expPath, l.Path)
+		assert.Equal(t, tt.expSection, l.Section)
+	}
+}
+
+func TestLine_SetResourceQuery(t *testing.T) {
+	testCases := []struct {
+		resource string
+		expQuery url.Values
+	}{
+		{"/foo", nil},
+		{"/foo?", nil},
+		{"/foo?q=bar", url.Values{"q": {"bar"}}},
+		{"/foo?q=bar&q=baz&utm_source=news", url.Values{"q": {"bar", "baz"}, "utm_source": {"news"}}},
+		{"/foo?q=a%20b&empty=", url.Values{"q": {"a b"}, "empty": {""}}},
+		{"/foo?flag", url.Values{"flag": {""}}},
+		{"/foo?bad=%zz&q=bar", url.Values{"q": {"bar"}}}, // Malformed pairs are dropped
+		{"http://example.com/foo?q=bar#top", url.Values{"q": {"bar"}}},
+	}
+
+	for _, tt := range testCases {
+		l := &Line{}
+		assert.NoError(t, l.setResource(tt.resource))
+		assert.Equal(t, tt.expQuery, l.Query, tt.resource)
+	}
+}
+
+func TestGetSectionFromPath(t *testing.T) {
+	testCases := []struct {
+		path       string
+		depth      int
+		expSection string
+	}{
+		{"/", 1, "/"},
+		{"/", 3, "/"},
+		{"/foo", 1, "/foo"},
+		{"/foo", 2, "/foo"},
+		{"/foo/bar/baz", 1, "/foo"},
+		{"/foo/bar/baz", 2, "/foo/bar"},
+		{"/foo/bar/baz", 3, "/foo/bar/baz"},
+		{"/foo/bar/baz", 4, "/foo/bar/baz"},
+		{"//foo/bar", 1, "/foo"},
+		{"/foo/", 2, "/foo/"},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expSection, getSectionFromPath(tt.path, tt.depth))
 	}
 }
@@ -0,0 +1,274 @@
+package logparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UnixTimeLayout is the JSONMapping time layout for seconds since the epoch (fractions allowed)
+	UnixTimeLayout = "unix"
+	// UnixMsTimeLayout is the JSONMapping time layout for milliseconds since the epoch
+	UnixMsTimeLayout = "unix_ms"
+)
+
+// JSONMapping maps the fields of Line to the keys of the JSON object holding their values.
+// Keys of nested objects are expressed as dotted paths (eg. "request.path").
+// TimeLayout is either a Go time layout, UnixTimeLayout or UnixMsTimeLayout.
+// DurationUnit is the unit of numeric durations (eg. "ms"), while string ones may also be
+// written as Go durations (eg. "1.5ms").
+// Empty keys are not looked up, but Time, Path and Status are required
+type JSONMapping struct {
+	Time         string
+	TimeLayout   string
+	VHost        string
+	RemoteHost   string
+	User         string
+	Method       string
+	Path         string
+	Protocol     string
+	Status       string
+	Bytes        string
+	Referer      string
+	UserAgent    string
+	Duration     string
+	DurationUnit string
+}
+
+// DefaultJSONMapping is the mapping used when none is specified
+var DefaultJSONMapping = JSONMapping{
+	Time:         "time",
+	TimeLayout:   time.RFC3339,
+	VHost:        "vhost",
+	RemoteHost:   "remote_addr",
+	User:         "remote_user",
+	Method:       "method",
+	Path:         "path",
+	Protocol:     "protocol",
+	Status:       "status",
+	Bytes:        "bytes",
+	Referer:      "referer",
+	UserAgent:    "user_agent",
+	Duration:     "duration",
+	DurationUnit: "ms",
+}
+
+// GCPLoadBalancerMapping is the mapping for the Google Cloud HTTP(S) Load Balancer request logs
+// exported from Cloud Logging, one JSON entry per line.
+// See https://cloud.google.com/load-balancing/docs/https/https-logging-monitoring
+var GCPLoadBalancerMapping = JSONMapping{
+	Time:         "timestamp",
+	TimeLayout:   time.RFC3339Nano,
+	RemoteHost:   "httpRequest.remoteIp",
+	Method:       "httpRequest.requestMethod",
+	Path:         "httpRequest.requestUrl",
+	Protocol:     "httpRequest.protocol",
+	Status:       "httpRequest.status",
+	Bytes:        "httpRequest.responseSize",
+	Referer:      "httpRequest.referer",
+	UserAgent:    "httpRequest.userAgent",
+	Duration:     "httpRequest.latency",
+	DurationUnit: "s",
+}
+
+// ParseJSONMapping returns the default mapping overridden by the comma-separated list of
+// name=key pairs in s (eg. "time=ts,path=request.path,status=response.status").
+// Valid names are the ones of the JSONMapping fields in snake case (eg. remote_host).
+// Returns an error if s is malformed or contains an unknown name
+func ParseJSONMapping(s string) (JSONMapping, error) {
+	m := DefaultJSONMapping
+	fields := map[string]*string{
+		"time":          &m.Time,
+		"time_layout":   &m.TimeLayout,
+		"vhost":         &m.VHost,
+		"remote_host":   &m.RemoteHost,
+		"user":          &m.User,
+		"method":        &m.Method,
+		"path":          &m.Path,
+		"protocol":      &m.Protocol,
+		"status":        &m.Status,
+		"bytes":         &m.Bytes,
+		"referer":       &m.Referer,
+		"user_agent":    &m.UserAgent,
+		"duration":      &m.Duration,
+		"duration_unit": &m.DurationUnit,
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) != 2 {
+			return JSONMapping{}, fmt.Errorf("invalid json mapping %q, expected name=key", pair)
+		}
+		field, ok := fields[strings.TrimSpace(split[0])]
+		if !ok {
+			return JSONMapping{}, fmt.Errorf("unknown json mapping name %s", split[0])
+		}
+		*field = strings.TrimSpace(split[1])
+	}
+	return m, nil
+}
+
+// JSON the parser for access logs with one JSON object per line
+type JSON struct {
+	mapping      JSONMapping
+	durationUnit time.Duration
+}
+
+// NewJSON returns a JSON log parser with the default mapping. Cannot return nil
+func NewJSON() *JSON {
+	p, _ := NewJSONWithMapping(DefaultJSONMapping)
+	return p
+}
+
+// NewJSONWithMapping returns a JSON log parser with a custom mapping.
+// Returns an error if the mapping misses the time, the path or the status keys or if the
+// duration unit is invalid
+func NewJSONWithMapping(m JSONMapping) (*JSON, error) {
+	if m.Time == "" || m.TimeLayout == "" {
+		return nil, fmt.Errorf("json mapping has no time key or layout")
+	}
+	if m.Path == "" {
+		return nil, fmt.Errorf("json mapping has no path key")
+	}
+	if m.Status == "" {
+		return nil, fmt.Errorf("json mapping has no status key")
+	}
+
+	p := &JSON{mapping: m}
+	if m.Duration != "" {
+		unit, err := time.ParseDuration("1" + m.DurationUnit)
+		if err != nil || unit <= 0 {
+			return nil, fmt.Errorf("invalid json mapping duration unit %s", m.DurationUnit)
+		}
+		p.durationUnit = unit
+	}
+	return p, nil
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// Values of keys that are not in the mapping are stored in Line.Extra, keyed by their dotted path
+func (p *JSON) ParseLine(line string) (*Line, error) {
+	var obj map[string]interface{}
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber() // Keep numbers as they're written
+	if err := d.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid json line: %v", err)
+	}
+	if err := d.Decode(&struct{}{}); err != io.EOF {
+		return nil, fmt.Errorf("unexpected trailing data in json line: %s", line)
+	}
+
+	fields := make(map[string]string)
+	flattenJSON("", obj, fields)
+	take := func(key string) string {
+		if key == "" {
+			return ""
+		}
+		v := fields[key]
+		delete(fields, key)
+		return v
+	}
+
+	l := &Line{
+		VHost:      take(p.mapping.VHost),
+		RemoteHost: take(p.mapping.RemoteHost),
+		User:       take(p.mapping.User),
+		Method:     take(p.mapping.Method),
+		Protocol:   take(p.mapping.Protocol),
+		Referer:    take(p.mapping.Referer),
+		UserAgent:  take(p.mapping.UserAgent),
+	}
+
+	var err error
+	ts := take(p.mapping.Time)
+	if ts == "" {
+		return nil, fmt.Errorf("missing date in line: %s", line)
+	}
+	if l.Date, err = p.parseTime(ts); err != nil {
+		return nil, err
+	}
+	if l.StatusCode, err = parseStatusCode(take(p.mapping.Status)); err != nil {
+		return nil, err
+	}
+	if bytes := take(p.mapping.Bytes); bytes != "" {
+		if l.ContentLength, err = parseSize(bytes); err != nil {
+			return nil, err
+		}
+	}
+	if duration := take(p.mapping.Duration); duration != "" {
+		if l.Duration, err = p.parseDuration(duration); err != nil {
+			return nil, err
+		}
+		l.HasDuration = true
+	}
+	if err = l.setResource(take(p.mapping.Path)); err != nil {
+		return nil, err
+	}
+
+	for k, v := range fields {
+		l.setExtra(k, v)
+	}
+	return l, nil
+}
+
+// parseTime parses the time value according to the mapping's time layout
+func (p *JSON) parseTime(v string) (time.Time, error) {
+	var unit time.Duration
+	switch p.mapping.TimeLayout {
+	case UnixTimeLayout:
+		unit = time.Second
+	case UnixMsTimeLayout:
+		unit = time.Millisecond
+	default:
+		return parseTime(p.mapping.TimeLayout, v)
+	}
+	return parseEpoch(v, unit)
+}
+
+// parseDuration parses the duration value, either a number of the mapping's duration unit or
+// a Go duration string
+func (p *JSON) parseDuration(v string) (time.Duration, error) {
+	if d, err := parseDuration(v, p.durationUnit); err == nil {
+		return d, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration: %s", v)
+	}
+	return d, nil
+}
+
+// flattenJSON stores the leaf values of obj into out, keyed by their dotted path.
+// Arrays are stored in their JSON encoding and null values as the empty string
+func flattenJSON(prefix string, obj map[string]interface{}, out map[string]string) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch val := v.(type) {
+		case map[string]interface{}:
+			flattenJSON(key, val, out)
+		case string:
+			out[key] = val
+		case json.Number:
+			out[key] = val.String()
+		case bool:
+			out[key] = strconv.FormatBool(val)
+		case nil:
+			out[key] = ""
+		default:
+			encoded, _ := json.Marshal(val)
+			out[key] = string(encoded)
+		}
+	}
+}
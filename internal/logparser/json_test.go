@@ -0,0 +1,232 @@
+package logparser
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONMapping(t *testing.T) {
+	m, err := ParseJSONMapping("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultJSONMapping, m)
+
+	m, err = ParseJSONMapping("time=ts, time_layout=unix,path=request.path,status=response.status,duration_unit=us,")
+	assert.NoError(t, err)
+	assert.Equal(t, "ts", m.Time)
+	assert.Equal(t, UnixTimeLayout, m.TimeLayout)
+	assert.Equal(t, "request.path", m.Path)
+	assert.Equal(t, "response.status", m.Status)
+	assert.Equal(t, "us", m.DurationUnit)
+	assert.Equal(t, DefaultJSONMapping.User, m.User)
+
+	_, err = ParseJSONMapping("time")
+	assert.Error(t, err)
+
+	_, err = ParseJSONMapping("asd=foo")
+	assert.Error(t, err)
+}
+
+func TestNewJSONWithMapping(t *testing.T) {
+	p, err := NewJSONWithMapping(DefaultJSONMapping)
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+
+	for _, m := range []JSONMapping{
+		{Time: "time", Path: "path", Status: "status"},
+		{TimeLayout: time.RFC3339, Path: "path", Status: "status"},
+		{Time: "time", TimeLayout: time.RFC3339, Status: "status"},
+		{Time: "time", TimeLayout: time.RFC3339, Path: "path"},
+		{Time: "time", TimeLayout: time.RFC3339, Path: "path", Status: "status", Duration: "duration"},
+		{Time: "time", TimeLayout: time.RFC3339, Path: "path", Status: "status", Duration: "duration", DurationUnit: "lightyears"},
+	} {
+		p, err := NewJSONWithMapping(m)
+		assert.Error(t, err)
+		assert.Nil(t, p)
+	}
+}
+
+func TestJSON_ParseLine(t *testing.T) {
+	dateTime, _ := time.Parse(time.RFC3339, "2018-05-09T16:00:39Z")
+	nested := JSONMapping{
+		Time:         "ts",
+		TimeLayout:   UnixMsTimeLayout,
+		RemoteHost:   "client.ip",
+		Path:         "request.path",
+		Method:       "request.method",
+		Status:       "response.status",
+		Bytes:        "response.bytes",
+		Duration:     "response.time",
+		DurationUnit: "s",
+	}
+
+	testCases := []struct {
+		mapping   JSONMapping
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","vhost":"example.com","remote_addr":"127.0.0.1","remote_user":"james","method":"GET","path":"/report/foo","protocol":"HTTP/1.1","status":200,"bytes":123,"referer":"-","user_agent":"curl/7.58.0","duration":12.5}`,
+			&Line{
+				VHost:         "example.com",
+				RemoteHost:    "127.0.0.1",
+				User:          "james",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report/foo",
+				Route:         "/report/foo",
+				Section:       "/report",
+				Protocol:      "HTTP/1.1",
+				StatusCode:    200,
+				ContentLength: 123,
+				Referer:       "-",
+				UserAgent:     "curl/7.58.0",
+				Duration:      12500 * time.Microsecond,
+				HasDuration:   true,
+			},
+			false,
+		},
+		{
+			// Duration as Go duration string
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","path":"/report","status":200,"duration":"1.5s"}`,
+			&Line{
+				Date:        dateTime,
+				Path:        "/report",
+				Route:       "/report",
+				Section:     "/report",
+				StatusCode:  200,
+				Duration:    1500 * time.Millisecond,
+				HasDuration: true,
+			},
+			false,
+		},
+		{
+			// Invalid duration
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","path":"/report","status":200,"duration":"slow"}`,
+			nil,
+			true,
+		},
+		{
+			nested,
+			`{"ts":1525881639250,"client":{"ip":"10.0.0.1"},"request":{"method":"POST","path":"/api/v1","id":"abc"},"response":{"status":"201","bytes":"-","time":0.25},"tags":["a","b"],"cached":false,"trace":null}`,
+			&Line{
+				RemoteHost:  "10.0.0.1",
+				Date:        time.Unix(1525881639, 250*int64(time.Millisecond)),
+				Method:      "POST",
+				Path:        "/api/v1",
+				Route:       "/api/v1",
+				Section:     "/api",
+				StatusCode:  201,
+				Duration:    250 * time.Millisecond,
+				HasDuration: true,
+				Extra: map[string]string{
+					"request.id": "abc",
+					"tags":       `["a","b"]`,
+					"cached":     "false",
+					"trace":      "",
+				},
+			},
+			false,
+		},
+		{
+			// Not a JSON object
+			DefaultJSONMapping,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+			nil,
+			true,
+		},
+		{
+			// Trailing data
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","path":"/report","status":200} {}`,
+			nil,
+			true,
+		},
+		{
+			// Missing date
+			DefaultJSONMapping,
+			`{"path":"/report","status":200}`,
+			nil,
+			true,
+		},
+		{
+			// Invalid date
+			DefaultJSONMapping,
+			`{"time":"09/May/2018:16:00:39 +0000","path":"/report","status":200}`,
+			nil,
+			true,
+		},
+		{
+			// Invalid epoch date
+			nested,
+			`{"ts":"yesterday","request":{"path":"/report"},"response":{"status":200}}`,
+			nil,
+			true,
+		},
+		{
+			// Missing status
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","path":"/report"}`,
+			nil,
+			true,
+		},
+		{
+			// Invalid size
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","path":"/report","status":200,"bytes":"lots"}`,
+			nil,
+			true,
+		},
+		{
+			// Missing path
+			DefaultJSONMapping,
+			`{"time":"2018-05-09T16:00:39Z","status":200}`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range testCases {
+		p, err := NewJSONWithMapping(tt.mapping)
+		assert.NoError(t, err)
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.EqualValues(t, tt.expLine, parsed)
+	}
+}
+
+func TestJSON_ParseLineGCPLoadBalancer(t *testing.T) {
+	p, err := NewJSONWithMapping(GCPLoadBalancerMapping)
+	assert.NoError(t, err)
+
+	line := `{"httpRequest":{"requestMethod":"GET","requestUrl":"https://example.com/api/v1/users?id=1","requestSize":"120","status":503,"responseSize":"4021","userAgent":"curl/7.58.0","remoteIp":"203.0.113.7","serverIp":"10.0.0.1","latency":"0.125031s","protocol":"HTTP/1.1"},"jsonPayload":{"statusDetails":"backend_connection_closed_before_data_sent_to_client"},"severity":"WARNING","timestamp":"2018-05-09T16:00:39.123456Z"}`
+	parsed, err := p.ParseLine(line)
+	assert.NoError(t, err)
+	assert.Equal(t, &Line{
+		RemoteHost:    "203.0.113.7",
+		Date:          time.Date(2018, time.May, 9, 16, 0, 39, 123456000, time.UTC),
+		Method:        "GET",
+		Path:          "/api/v1/users",
+		Route:         "/api/v1/users",
+		Section:       "/api",
+		Query:         url.Values{"id": {"1"}},
+		Protocol:      "HTTP/1.1",
+		StatusCode:    503,
+		ContentLength: 4021,
+		UserAgent:     "curl/7.58.0",
+		Duration:      125031 * time.Microsecond,
+		HasDuration:   true,
+		Extra: map[string]string{
+			"httpRequest.requestSize":   "120",
+			"httpRequest.serverIp":      "10.0.0.1",
+			"jsonPayload.statusDetails": "backend_connection_closed_before_data_sent_to_client",
+			"severity":                  "WARNING",
+		},
+	}, parsed)
+}
@@ -0,0 +1,312 @@
+package logparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/strftime"
+)
+
+// clfTimeLayout is the layout of the %t directive without any custom format (square brackets excluded)
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// knownDirectives are all the directives (without any modifier) accepted in a LogFormat string.
+// See https://httpd.apache.org/docs/2.4/mod/mod_log_config.html#formats
+const knownDirectives = "aABbCDefhHiklLmnopPqrRsStTuUvVXIO"
+
+// timeKind is the kind of value logged by a time directive (eg. %t or %{msec}t)
+type timeKind int
+
+const (
+	timeLayout   timeKind = iota // Formatted date, either in the default layout or in a strftime one
+	timeSec                      // Seconds since the epoch
+	timeMsec                     // Milliseconds since the epoch
+	timeUsec                     // Microseconds since the epoch
+	timeMsecFrac                 // Millisecond fraction of the current second
+	timeUsecFrac                 // Microsecond fraction of the current second
+)
+
+// logDirective is a single compiled directive of a LogFormat string (eg. %>s or %{Referer}i)
+type logDirective struct {
+	name     string // The directive without modifiers, used as key for the extra fields
+	letter   byte
+	param    string
+	timeKind timeKind
+	layout   string        // Go time layout for timeLayout directives
+	unit     time.Duration // Unit of the value of duration directives (ie. %D and %T)
+}
+
+// logFormat is a compiled Apache httpd LogFormat string
+type logFormat struct {
+	tokens     []formatToken
+	directives []logDirective // One directive for each field token, in the same order
+}
+
+// compileLogFormat compiles an Apache httpd LogFormat string, the same syntax used in httpd.conf.
+// Returns an error if the format contains unknown directives or misses either the time (%t) or
+// the requested resource (%r or %U) directives, since they're required by the monitor
+func compileLogFormat(format string) (*logFormat, error) {
+	f := &logFormat{}
+	var literal strings.Builder
+	hasTime, hasResource := false, false
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c == '\\' && i+1 < len(format) { // Escapes used in httpd.conf, eg. \"%r\"
+			i++
+			switch format[i] {
+			case 'n':
+				literal.WriteByte('\n')
+			case 't':
+				literal.WriteByte('\t')
+			default:
+				literal.WriteByte(format[i])
+			}
+			continue
+		}
+		if c != '%' {
+			literal.WriteByte(c)
+			continue
+		}
+
+		d, next, err := compileDirective(format, i+1)
+		if err != nil {
+			return nil, err
+		}
+		i = next
+		if d == nil { // %% is a literal percent sign
+			literal.WriteByte('%')
+			continue
+		}
+		if d.letter == 't' && d.timeKind != timeMsecFrac && d.timeKind != timeUsecFrac {
+			hasTime = true
+		}
+		if d.letter == 'r' || d.letter == 'U' {
+			hasResource = true
+		}
+
+		f.tokens = appendLiteral(f.tokens, literal.String())
+		literal.Reset()
+		// The default time format is the only one logged within square brackets
+		bracketed := d.letter == 't' && d.param == ""
+		f.tokens = appendField(f.tokens, d.name, bracketed)
+		f.directives = append(f.directives, *d)
+	}
+	f.tokens = appendLiteral(f.tokens, literal.String())
+
+	if !hasTime {
+		return nil, fmt.Errorf("log format %q has no time directive", format)
+	}
+	if !hasResource {
+		return nil, fmt.Errorf("log format %q has neither %%r nor %%U directives", format)
+	}
+	return f, nil
+}
+
+// compileDirective compiles the directive starting at format[start], right after the '%'.
+// Returns the directive (nil for "%%") and the index of its last character in format
+func compileDirective(format string, start int) (*logDirective, int, error) {
+	i := start
+	if i < len(format) && format[i] == '%' {
+		return nil, i, nil
+	}
+	// Skip modifiers, ie. status code conditions (eg. %400,501{User-agent}i) and
+	// original/final request selectors (eg. %>s)
+	for i < len(format) && strings.IndexByte("<>!,0123456789", format[i]) >= 0 {
+		i++
+	}
+
+	d := &logDirective{}
+	if i < len(format) && format[i] == '{' {
+		end := strings.IndexByte(format[i:], '}')
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unterminated directive parameter at position %d", i)
+		}
+		d.param = format[i+1 : i+end]
+		i += end + 1
+	}
+	if i >= len(format) {
+		return nil, 0, fmt.Errorf("incomplete directive at the end of %q", format)
+	}
+
+	switch {
+	case format[i] == '^' && i+2 < len(format) && (format[i+1:i+3] == "ti" || format[i+1:i+3] == "to"):
+		// Request/response trailer lines, eg. %{Foo}^ti
+		d.letter = '^'
+		d.name = "%{" + d.param + "}" + format[i:i+3]
+		return d, i + 2, nil
+	case strings.IndexByte(knownDirectives, format[i]) < 0:
+		return nil, 0, fmt.Errorf("unknown directive %%%c at position %d", format[i], i)
+	}
+
+	d.letter = format[i]
+	d.name = "%" + string(d.letter)
+	if d.param != "" {
+		d.name = "%{" + d.param + "}" + string(d.letter)
+	}
+	switch d.letter {
+	case 't':
+		if err := d.compileTime(); err != nil {
+			return nil, 0, err
+		}
+	case 'D':
+		d.unit = time.Microsecond
+	case 'T':
+		if err := d.compileDuration(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return d, i, nil
+}
+
+// compileDuration sets the unit of a %T directive, ie. %T, %{s}T, %{ms}T or %{us}T
+func (d *logDirective) compileDuration() error {
+	switch d.param {
+	case "", "s":
+		d.unit = time.Second
+	case "ms":
+		d.unit = time.Millisecond
+	case "us":
+		d.unit = time.Microsecond
+	default:
+		return fmt.Errorf("invalid duration directive %s", d.name)
+	}
+	return nil
+}
+
+// compileTime sets the kind (and the layout, if any) of a time directive
+func (d *logDirective) compileTime() error {
+	param := strings.TrimPrefix(strings.TrimPrefix(d.param, "begin:"), "end:")
+	switch param {
+	case "":
+		d.timeKind, d.layout = timeLayout, clfTimeLayout
+	case "sec":
+		d.timeKind = timeSec
+	case "msec":
+		d.timeKind = timeMsec
+	case "usec":
+		d.timeKind = timeUsec
+	case "msec_frac":
+		d.timeKind = timeMsecFrac
+	case "usec_frac":
+		d.timeKind = timeUsecFrac
+	default:
+		layout, err := strftime.Layout(param)
+		if err != nil {
+			return fmt.Errorf("invalid time directive %s: %v", d.name, err)
+		}
+		d.timeKind, d.layout = timeLayout, layout
+	}
+	return nil
+}
+
+// parse parses a log line according to the log format.
+// Values of directives that have no counterpart in Line are stored in Line.Extra
+func (f *logFormat) parse(line string) (*Line, error) {
+	values, err := matchTokens(f.tokens, line)
+	if err != nil {
+		return nil, fmt.Errorf("line doesn't match the log format: %v", err)
+	}
+
+	l := &Line{}
+	var resource, path, query string
+	var frac, durationUnit time.Duration
+	for i, d := range f.directives {
+		v := values[i]
+		switch d.letter {
+		case 'v', 'V':
+			l.VHost = v
+		case 'h':
+			l.RemoteHost = v
+		case 'l':
+			l.RemoteLogName = v
+		case 'u':
+			l.User = v
+		case 'm':
+			l.Method = v
+		case 'U':
+			path = v
+		case 'q':
+			query = v
+		case 'H':
+			l.Protocol = v
+		case 'r':
+			l.Method, resource, l.Protocol, err = parseRequest(v)
+		case 's':
+			l.StatusCode, err = parseStatusCode(v)
+		case 'b', 'B':
+			l.ContentLength, err = parseSize(v)
+		case 'D', 'T':
+			// Keep the most precise duration if the format has more than one
+			if !l.HasDuration || d.unit < durationUnit {
+				l.Duration, err = parseDuration(v, d.unit)
+				l.HasDuration, durationUnit = true, d.unit
+			}
+		case 't':
+			var ts time.Time
+			ts, frac, err = d.parseTime(v, frac)
+			if !ts.IsZero() {
+				l.Date = ts
+			}
+		case 'i':
+			switch {
+			case strings.EqualFold(d.param, "Referer"):
+				l.Referer = v
+			case strings.EqualFold(d.param, "User-Agent"):
+				l.UserAgent = v
+			default:
+				l.setExtra(d.name, v)
+			}
+		default:
+			l.setExtra(d.name, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.Date.IsZero() {
+		return nil, fmt.Errorf("missing date in line: %s", line)
+	}
+	l.Date = l.Date.Add(frac)
+
+	if resource == "" {
+		resource = path + query
+	}
+	if err = l.setResource(resource); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// parseTime parses the value of a time directive. Returns the parsed date (zero for fraction
+// directives) and the fraction of second accumulated so far
+func (d *logDirective) parseTime(v string, frac time.Duration) (time.Time, time.Duration, error) {
+	if d.timeKind == timeLayout {
+		// httpd writes the times without a zone in local time
+		t, err := time.ParseInLocation(d.layout, v, time.Local)
+		if err != nil {
+			return time.Time{}, frac, fmt.Errorf("invalid date: %v", err)
+		}
+		return t, frac, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, frac, fmt.Errorf("invalid time value %s for %s", v, d.name)
+	}
+	switch d.timeKind {
+	case timeSec:
+		return time.Unix(n, 0), frac, nil
+	case timeMsec:
+		return time.Unix(0, n*int64(time.Millisecond)), frac, nil
+	case timeUsec:
+		return time.Unix(0, n*int64(time.Microsecond)), frac, nil
+	case timeMsecFrac:
+		return time.Time{}, time.Duration(n) * time.Millisecond, nil
+	default:
+		return time.Time{}, time.Duration(n) * time.Microsecond, nil
+	}
+}
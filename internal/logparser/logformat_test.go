@@ -0,0 +1,239 @@
+package logparser
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithFormat(t *testing.T) {
+	testCases := []struct {
+		format    string
+		shouldErr bool
+	}{
+		{`%h %l %u %t "%r" %>s %b`, false},
+		{`%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-agent}i\"`, false},
+		{`%v %h %l %u %t "%r" %>s %O %D %I "%{X-Request-Id}i"`, false},
+		{`%h [%{%Y-%m-%d %H:%M:%S %z}t] %m %U%q %H %s 100%%`, false},
+		{`%h %{msec}t "%r" %s %400,501{User-agent}i %{Foo}^ti`, false},
+		{`%h %t "%r" %s %T %{s}T %{ms}T %{us}T`, false},
+		// Missing time
+		{`%h %l %u "%r" %>s %b`, true},
+		// Missing resource
+		{`%h %l %u %t %>s %b`, true},
+		// Unknown directive
+		{`%h %l %u %t "%r" %>s %b %Z`, true},
+		// Unterminated parameter
+		{`%h %l %u %t "%r" %>s %b %{Referer`, true},
+		// Incomplete directive
+		{`%h %l %u %t "%r" %>s %b %`, true},
+		// Invalid strftime layout
+		{`%h %{%Q}t "%r" %s`, true},
+		// strftime literals that are Go layout elements
+		{`%h %{%d/%b/%Y 1 %T}t "%r" %s`, true},
+		// Invalid duration unit
+		{`%h %t "%r" %s %{ns}T`, true},
+	}
+
+	for _, tt := range testCases {
+		p, err := NewWithFormat(tt.format)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.format)
+		assert.Equal(t, tt.shouldErr, p == nil, tt.format)
+	}
+}
+
+func TestHTTPd_ParseLineWithFormat(t *testing.T) {
+	dateTime, _ := time.Parse(clfTimeLayout, "09/May/2018:16:00:39 +0000")
+
+	testCases := []struct {
+		format    string
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			`%h %l %u %t "%r" %>s %b`,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report/foo HTTP/1.0" 200 123`,
+			&Line{
+				RemoteHost:    "127.0.0.1",
+				RemoteLogName: "-",
+				User:          "james",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report/foo",
+				Route:         "/report/foo",
+				Section:       "/report",
+				Protocol:      "HTTP/1.0",
+				StatusCode:    200,
+				ContentLength: 123,
+			},
+			false,
+		},
+		{
+			`%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-agent}i\"`,
+			`127.0.0.1 - - [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.1" 304 - "-" "curl \"7.58.0\""`,
+			&Line{
+				RemoteHost:    "127.0.0.1",
+				RemoteLogName: "-",
+				User:          "-",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
+				Section:       "/report",
+				Protocol:      "HTTP/1.1",
+				StatusCode:    304,
+				ContentLength: 0,
+				Referer:       "-",
+				UserAgent:     `curl "7.58.0"`,
+			},
+			false,
+		},
+		{
+			`%v %h %l %u %t "%r" %>s %O %D %I "%{X-Request-Id}i"`,
+			`example.com 10.0.0.1 - - [09/May/2018:16:00:39 +0000] "POST /api/v1 HTTP/2.0" 201 512 1500 340 "abc-123"`,
+			&Line{
+				VHost:         "example.com",
+				RemoteHost:    "10.0.0.1",
+				RemoteLogName: "-",
+				User:          "-",
+				Date:          dateTime,
+				Method:        "POST",
+				Path:          "/api/v1",
+				Route:         "/api/v1",
+				Section:       "/api",
+				Protocol:      "HTTP/2.0",
+				StatusCode:    201,
+				Duration:      1500 * time.Microsecond,
+				HasDuration:   true,
+				Extra: map[string]string{
+					"%O":               "512",
+					"%I":               "340",
+					"%{X-Request-Id}i": "abc-123",
+				},
+			},
+			false,
+		},
+		{
+			`%h [%{%Y-%m-%d %H:%M:%S %z}t] %m %U%q %H %s`,
+			`127.0.0.1 [2018-05-09 16:00:39 +0000] GET /search?q=foo HTTP/1.1 200`,
+			&Line{
+				RemoteHost: "127.0.0.1",
+				Date:       dateTime,
+				Method:     "GET",
+				Path:       "/search",
+				Route:      "/search",
+				Section:    "/search",
+				Query:      url.Values{"q": {"foo"}},
+				Protocol:   "HTTP/1.1",
+				StatusCode: 200,
+			},
+			false,
+		},
+		{
+			`%h %{sec}t.%{msec_frac}t "%r" %s`,
+			`127.0.0.1 1525881639.250 "GET /report HTTP/1.0" 200`,
+			&Line{
+				RemoteHost: "127.0.0.1",
+				Date:       time.Unix(1525881639, 250*int64(time.Millisecond)),
+				Method:     "GET",
+				Path:       "/report",
+				Route:      "/report",
+				Section:    "/report",
+				Protocol:   "HTTP/1.0",
+				StatusCode: 200,
+			},
+			false,
+		},
+		{
+			// The most precise duration wins
+			`%h %t "%r" %s %T %{ms}T %D %{s}T`,
+			`127.0.0.1 [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 1 1234 1234567 1`,
+			&Line{
+				RemoteHost:  "127.0.0.1",
+				Date:        dateTime,
+				Method:      "GET",
+				Path:        "/report",
+				Route:       "/report",
+				Section:     "/report",
+				Protocol:    "HTTP/1.0",
+				StatusCode:  200,
+				Duration:    1234567 * time.Microsecond,
+				HasDuration: true,
+			},
+			false,
+		},
+		{
+			// Invalid duration
+			`%h %t "%r" %s %D`,
+			`127.0.0.1 [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 -`,
+			nil,
+			true,
+		},
+		{
+			// Line in the Common Log Format parsed with the Combined Log Format
+			`%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`,
+			nil,
+			true,
+		},
+		{
+			// Trailing data
+			`%h %l %u %t "%r" %>s %b`,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "-"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid date
+			`%h %l %u %t "%r" %>s %b`,
+			`127.0.0.1 - james [09/May/2018] "GET /report HTTP/1.0" 200 123`,
+			nil,
+			true,
+		},
+		{
+			// Invalid status code
+			`%h %l %u %t "%r" %>s %b`,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 20 123`,
+			nil,
+			true,
+		},
+		{
+			// Invalid request
+			`%h %l %u %t "%r" %>s %b`,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET" 200 123`,
+			nil,
+			true,
+		},
+		{
+			// Resource doesn't start with /
+			`%h %l %u %t "%r" %>s %b`,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET report HTTP/1.0" 200 123`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range testCases {
+		p, err := NewWithFormat(tt.format)
+		assert.NoError(t, err)
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.EqualValues(t, tt.expLine, parsed)
+	}
+}
+
+func TestHTTPd_ParseLineWithFormatLocalTime(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local = time.FixedZone("EDT", -4*3600)
+
+	p, err := NewWithFormat(`%h %{%Y-%m-%d %H:%M:%S}t "%r" %>s`)
+	assert.NoError(t, err)
+	l, err := p.ParseLine(`127.0.0.1 2018-05-09 12:00:39 "GET /report HTTP/1.0" 200`)
+	assert.NoError(t, err)
+	// Times without a zone are in local time, as written by httpd
+	assert.True(t, time.Date(2018, 5, 9, 16, 0, 39, 0, time.UTC).Equal(l.Date), l.Date)
+}
@@ -0,0 +1,259 @@
+package logparser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Matches of the keys of a LookupTable
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchCIDR   = "cidr"
+)
+
+// lookupFields are the fields of the log lines a LookupTable can label, by name
+var lookupFields = map[string]func(*Line) string{
+	"vhost":       func(l *Line) string { return l.VHost },
+	"remote_host": func(l *Line) string { return l.RemoteHost },
+	"client_ip":   func(l *Line) string { return l.ClientIP },
+	"user":        func(l *Line) string { return l.User },
+	"path":        func(l *Line) string { return l.Path },
+	"route":       func(l *Line) string { return l.Route },
+	"section":     func(l *Line) string { return l.Section },
+	"user_agent":  func(l *Line) string { return l.UserAgent },
+	"backend":     func(l *Line) string { return l.Backend },
+}
+
+// LookupTable labels the log lines with business meaning (eg. the team of a user or the office of
+// an IP address) by looking up the value of one of their fields in a table loaded from a file.
+// Keys are matched either exactly, as prefixes or, for IP addresses, as CIDR networks. The most
+// specific key wins, ie. the longest prefix or network
+type LookupTable struct {
+	name     string // Name of the label, eg. team
+	value    func(*Line) string
+	match    string
+	fileName string
+	modTime  time.Time
+	size     int64
+	exact    map[string]string
+	prefixes []lookupPrefix
+	networks []lookupNetwork
+}
+
+// lookupPrefix maps the values starting with a prefix to a label
+type lookupPrefix struct {
+	prefix string
+	label  string
+}
+
+// lookupNetwork maps the IP addresses in a network to a label
+type lookupNetwork struct {
+	network *net.IPNet
+	label   string
+}
+
+// LoadLookupTable returns the table with the given label name, labelling the given field of the log
+// lines (eg. user or client_ip) by matching its value with the keys read from a file. JSON files
+// (ie. with the .json extension) are an object of key-label pairs, any other file is CSV with a key
+// and a label per record, where records starting with '#' are ignored.
+// Returns an error if the field or the match are unknown, or the file cannot be read or contains an
+// invalid key
+func LoadLookupTable(name, field, match, fileName string) (*LookupTable, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty lookup table name")
+	}
+	value, ok := lookupFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown lookup table field %s", field)
+	}
+	if match != MatchExact && match != MatchPrefix && match != MatchCIDR {
+		return nil, fmt.Errorf("unknown lookup table match %s", match)
+	}
+
+	t := &LookupTable{name: name, value: value, match: match, fileName: fileName}
+	if _, err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseLookupTables loads the tables in the comma-separated list of name=field:match:file
+// definitions in s (eg. "team=user:exact:teams.csv,office=client_ip:cidr:offices.json").
+// Returns an error if s is malformed or any of the tables cannot be loaded
+func ParseLookupTables(s string) ([]*LookupTable, error) {
+	var tables []*LookupTable
+	for _, def := range strings.Split(s, ",") {
+		if strings.TrimSpace(def) == "" {
+			continue
+		}
+		split := strings.SplitN(def, "=", 2)
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid lookup table %q, expected name=field:match:file", def)
+		}
+		params := strings.SplitN(split[1], ":", 3)
+		if len(params) != 3 {
+			return nil, fmt.Errorf("invalid lookup table %q, expected name=field:match:file", def)
+		}
+		t, err := LoadLookupTable(strings.TrimSpace(split[0]), strings.TrimSpace(params[0]),
+			strings.TrimSpace(params[1]), strings.TrimSpace(params[2]))
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// Name returns the name of the label of the table
+func (t *LookupTable) Name() string {
+	return t.name
+}
+
+// Lookup returns the label of the log line, or an empty string if its field matches no key
+func (t *LookupTable) Lookup(l *Line) string {
+	v := t.value(l)
+	if v == "" {
+		return ""
+	}
+
+	switch t.match {
+	case MatchPrefix:
+		for _, p := range t.prefixes {
+			if strings.HasPrefix(v, p.prefix) {
+				return p.label
+			}
+		}
+	case MatchCIDR:
+		ip := normalizeIP(v)
+		if ip == nil {
+			return ""
+		}
+		for _, n := range t.networks {
+			if n.network.Contains(ip) {
+				return n.label
+			}
+		}
+	default:
+		return t.exact[v]
+	}
+	return ""
+}
+
+// Reload reads the file of the table again if it changed since the last time it was read, and
+// returns whether it did. The table is left unchanged if the file cannot be read or contains an
+// invalid key
+func (t *LookupTable) Reload() (bool, error) {
+	info, err := os.Stat(t.fileName)
+	if err != nil {
+		return false, fmt.Errorf("cannot read lookup table %s: %v", t.name, err)
+	}
+	if info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return false, nil
+	}
+
+	f, err := os.Open(t.fileName)
+	if err != nil {
+		return false, fmt.Errorf("cannot read lookup table %s: %v", t.name, err)
+	}
+	defer f.Close()
+
+	var entries [][2]string
+	if strings.EqualFold(filepath.Ext(t.fileName), ".json") {
+		entries, err = readJSONLookup(f)
+	} else {
+		entries, err = readCSVLookup(f)
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot read lookup table %s: %v", t.name, err)
+	}
+	if err := t.setEntries(entries); err != nil {
+		return false, fmt.Errorf("invalid lookup table %s: %v", t.name, err)
+	}
+	t.modTime, t.size = info.ModTime(), info.Size()
+	return true, nil
+}
+
+// setEntries replaces the keys of the table
+func (t *LookupTable) setEntries(entries [][2]string) error {
+	exact := make(map[string]string)
+	var prefixes []lookupPrefix
+	var networks []lookupNetwork
+	for _, e := range entries {
+		switch t.match {
+		case MatchPrefix:
+			prefixes = append(prefixes, lookupPrefix{prefix: e[0], label: e[1]})
+		case MatchCIDR:
+			n, err := parseNetwork(e[0])
+			if err != nil {
+				return err
+			}
+			networks = append(networks, lookupNetwork{network: n, label: e[1]})
+		default:
+			exact[e[0]] = e[1]
+		}
+	}
+
+	// The most specific keys are matched first
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i].prefix) > len(prefixes[j].prefix)
+	})
+	sort.SliceStable(networks, func(i, j int) bool {
+		iOnes, _ := networks[i].network.Mask.Size()
+		jOnes, _ := networks[j].network.Mask.Size()
+		return iOnes > jOnes
+	})
+	t.exact, t.prefixes, t.networks = exact, prefixes, networks
+	return nil
+}
+
+// readCSVLookup reads the key-label pairs of a CSV file
+func readCSVLookup(r io.Reader) ([][2]string, error) {
+	c := csv.NewReader(r)
+	c.Comment = '#'
+	c.FieldsPerRecord = 2
+	c.TrimLeadingSpace = true
+
+	var entries [][2]string
+	for {
+		record, err := c.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, [2]string{strings.TrimSpace(record[0]), strings.TrimSpace(record[1])})
+	}
+}
+
+// readJSONLookup reads the key-label pairs of a JSON object
+func readJSONLookup(r io.Reader) ([][2]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	entries := make([][2]string, 0, len(m))
+	for k, v := range m {
+		entries = append(entries, [2]string{k, v})
+	}
+	// Sorted for a deterministic order of the keys of the same length
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i][0] < entries[j][0]
+	})
+	return entries, nil
+}
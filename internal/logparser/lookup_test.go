@@ -0,0 +1,164 @@
+package logparser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLookupFile writes a lookup table file with the given extension in dir
+func writeLookupFile(t *testing.T, dir, ext, content string) string {
+	fileName := filepath.Join(dir, "table"+ext)
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte(content), 0644))
+	return fileName
+}
+
+func TestLoadLookupTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		field   string
+		match   string
+		ext     string
+		content string
+		line    Line
+		expLbl  string
+	}{
+		{"user", MatchExact, ".csv", "# user,team\njames,payments\n\"doe, john\", search\n", Line{User: "james"}, "payments"},
+		{"user", MatchExact, ".csv", "james,payments\n\"doe, john\", search\n", Line{User: "doe, john"}, "search"},
+		{"user", MatchExact, ".csv", "james,payments\n", Line{User: "jam"}, ""},
+		{"user", MatchExact, ".csv", "james,payments\n", Line{}, ""},
+		{"user", MatchExact, ".JSON", `{"james": "payments"}`, Line{User: "james"}, "payments"},
+		{"section", MatchPrefix, ".csv", "/api,platform\n/api/cart,checkout\n", Line{Section: "/api/cart"}, "checkout"},
+		{"section", MatchPrefix, ".csv", "/api,platform\n/api/cart,checkout\n", Line{Section: "/api/users"}, "platform"},
+		{"path", MatchPrefix, ".json", `{"/static/": "assets", "/": "site"}`, Line{Path: "/static/app.js"}, "assets"},
+		{"path", MatchPrefix, ".json", `{"/static/": "assets"}`, Line{Path: "/index.html"}, ""},
+		{"client_ip", MatchCIDR, ".csv", "10.0.0.0/8,datacenter\n10.1.0.0/16,office\n", Line{ClientIP: "10.1.2.3"}, "office"},
+		{"client_ip", MatchCIDR, ".csv", "10.0.0.0/8,datacenter\n10.1.0.0/16,office\n", Line{ClientIP: "10.2.2.3"}, "datacenter"},
+		{"client_ip", MatchCIDR, ".csv", "192.0.2.1,vpn\n2001:db8::/32,office\n", Line{ClientIP: "192.0.2.1"}, "vpn"},
+		{"client_ip", MatchCIDR, ".csv", "192.0.2.1,vpn\n2001:db8::/32,office\n", Line{ClientIP: "2001:db8::1"}, "office"},
+		{"remote_host", MatchCIDR, ".json", `{"10.0.0.0/8": "datacenter"}`, Line{RemoteHost: "example.com"}, ""},
+	}
+
+	for _, tt := range testCases {
+		fileName := writeLookupFile(t, dir, tt.ext, tt.content)
+		table, err := LoadLookupTable("label", tt.field, tt.match, fileName)
+		if assert.NoError(t, err, tt.content) {
+			assert.Equal(t, "label", table.Name())
+			assert.Equal(t, tt.expLbl, table.Lookup(&tt.line), tt.content)
+		}
+		os.Remove(fileName)
+	}
+}
+
+func TestLoadLookupTable_Err(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name    string
+		field   string
+		match   string
+		ext     string
+		content string
+	}{
+		{"", "user", MatchExact, ".csv", "james,payments\n"},
+		{"team", "nope", MatchExact, ".csv", "james,payments\n"},
+		{"team", "user", "regexp", ".csv", "james,payments\n"},
+		{"team", "user", MatchExact, ".csv", "james,payments,extra\n"},
+		{"team", "user", MatchExact, ".csv", "james\n"},
+		{"team", "user", MatchExact, ".json", `["james"]`},
+		{"team", "user", MatchExact, ".json", `{"james": 1}`},
+		{"office", "client_ip", MatchCIDR, ".csv", "10.0.0.0/33,office\n"},
+		{"office", "client_ip", MatchCIDR, ".csv", "office,10.0.0.0/8\n"},
+	}
+
+	for _, tt := range testCases {
+		fileName := writeLookupFile(t, dir, tt.ext, tt.content)
+		table, err := LoadLookupTable(tt.name, tt.field, tt.match, fileName)
+		assert.Error(t, err, tt.content)
+		assert.Nil(t, table, tt.content)
+		os.Remove(fileName)
+	}
+
+	table, err := LoadLookupTable("team", "user", MatchExact, "/non/existent/file.csv")
+	assert.Error(t, err)
+	assert.Nil(t, table)
+}
+
+func TestLookupTable_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileName := writeLookupFile(t, dir, ".csv", "james,payments\n")
+	table, err := LoadLookupTable("team", "user", MatchExact, fileName)
+	assert.NoError(t, err)
+
+	// Unchanged file
+	reloaded, err := table.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// Changed file, with a different modification time since some filesystems have a coarse one
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("james,search\n"), 0644))
+	assert.NoError(t, os.Chtimes(fileName, time.Now(), time.Now().Add(time.Second)))
+	reloaded, err = table.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "search", table.Lookup(&Line{User: "james"}))
+
+	// Invalid file, the table is left unchanged
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("james\n"), 0644))
+	assert.NoError(t, os.Chtimes(fileName, time.Now(), time.Now().Add(2*time.Second)))
+	reloaded, err = table.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Equal(t, "search", table.Lookup(&Line{User: "james"}))
+
+	// Removed file
+	assert.NoError(t, os.Remove(fileName))
+	reloaded, err = table.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Equal(t, "search", table.Lookup(&Line{User: "james"}))
+}
+
+func TestParseLookupTables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lookup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	csvFile := writeLookupFile(t, dir, ".csv", "james,payments\n")
+	jsonFile := writeLookupFile(t, dir, ".json", `{"10.0.0.0/8": "datacenter"}`)
+
+	tables, err := ParseLookupTables("team=user:exact:" + csvFile + ", site = client_ip:cidr:" + jsonFile + ",")
+	assert.NoError(t, err)
+	if assert.Len(t, tables, 2) {
+		assert.Equal(t, "team", tables[0].Name())
+		assert.Equal(t, "site", tables[1].Name())
+		assert.Equal(t, "datacenter", tables[1].Lookup(&Line{ClientIP: "10.0.0.1"}))
+	}
+
+	tables, err = ParseLookupTables("")
+	assert.NoError(t, err)
+	assert.Empty(t, tables)
+
+	testCases := []string{
+		"team",
+		"team=user:" + csvFile,
+		"team=user:regexp:" + csvFile,
+		"team=user:exact:/non/existent/file.csv",
+	}
+	for _, s := range testCases {
+		tables, err := ParseLookupTables(s)
+		assert.Error(t, err, s)
+		assert.Nil(t, tables, s)
+	}
+}
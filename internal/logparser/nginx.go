@@ -0,0 +1,192 @@
+package logparser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NginxCombinedFormat is the log_format predefined by nginx with the "combined" name.
+// See http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
+const NginxCombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// Nginx the nginx server log parser
+type Nginx struct {
+	tokens    []formatToken
+	variables []string // One variable name for each field token, in the same order
+}
+
+// NewNginx returns an nginx log parser for the predefined combined log_format. Cannot return nil
+func NewNginx() *Nginx {
+	p, _ := NewNginxWithFormat(NginxCombinedFormat)
+	return p
+}
+
+// NewNginxWithFormat returns an nginx log parser for lines written with a custom log_format
+// string, using the $variable (or ${variable}) syntax.
+// Returns an error if the format misses either the time ($time_local, $time_iso8601 or $msec)
+// or the requested resource ($request, $request_uri or $uri), since they're required by the monitor
+func NewNginxWithFormat(format string) (*Nginx, error) {
+	p := &Nginx{}
+	var literal strings.Builder
+	hasTime, hasResource := false, false
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '$' {
+			literal.WriteByte(format[i])
+			continue
+		}
+
+		var name string
+		if strings.HasPrefix(format[i+1:], "{") {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable at position %d", i)
+			}
+			name = format[i+2 : i+end]
+			i += end
+		} else {
+			end := i + 1
+			for end < len(format) && isVariableChar(format[end]) {
+				end++
+			}
+			name = format[i+1 : end]
+			i = end - 1
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty variable name at position %d", i)
+		}
+
+		switch name {
+		case "time_local", "time_iso8601", "msec":
+			hasTime = true
+		case "request", "request_uri", "uri":
+			hasResource = true
+		}
+		p.tokens = appendLiteral(p.tokens, literal.String())
+		literal.Reset()
+		p.tokens = appendField(p.tokens, "$"+name, false)
+		p.variables = append(p.variables, name)
+	}
+	p.tokens = appendLiteral(p.tokens, literal.String())
+
+	if !hasTime {
+		return nil, fmt.Errorf("log format %q has no time variable", format)
+	}
+	if !hasResource {
+		return nil, fmt.Errorf("log format %q has neither $request, $request_uri nor $uri variables", format)
+	}
+	return p, nil
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// Values of variables that have no counterpart in Line are stored in Line.Extra
+func (p *Nginx) ParseLine(line string) (*Line, error) {
+	values, err := matchTokens(p.tokens, line)
+	if err != nil {
+		return nil, fmt.Errorf("line doesn't match the log format: %v", err)
+	}
+
+	l := &Line{}
+	var request, requestURI, uri, args string
+	for i, name := range p.variables {
+		v := values[i]
+		switch name {
+		case "host", "server_name":
+			l.VHost = v
+		case "remote_addr":
+			l.RemoteHost = v
+		case "remote_user":
+			l.User = v
+		case "time_local":
+			l.Date, err = parseTime(clfTimeLayout, v)
+		case "time_iso8601":
+			l.Date, err = parseTime(time.RFC3339, v)
+		case "msec":
+			l.Date, err = parseEpoch(v, time.Second)
+		case "request":
+			request = v
+		case "request_method":
+			l.Method = v
+		case "request_uri":
+			requestURI = v
+		case "uri":
+			uri = v
+		case "args", "query_string":
+			args = v
+		case "server_protocol":
+			l.Protocol = v
+		case "status":
+			l.StatusCode, err = parseStatusCode(v)
+		case "body_bytes_sent":
+			l.ContentLength, err = parseSize(v)
+		case "http_referer":
+			l.Referer = v
+		case "http_user_agent":
+			l.UserAgent = v
+		case "request_time":
+			l.Duration, err = parseDuration(v, time.Second)
+			l.HasDuration = true
+		case "upstream_response_time":
+			// Total time of all the upstream servers tried
+			for _, d := range upstreamValues(v) {
+				var ud time.Duration
+				if ud, err = parseDuration(d, time.Second); err != nil {
+					break
+				}
+				l.BackendDuration += ud
+				l.HasBackendDuration = true
+			}
+		case "upstream_status":
+			// Status of the last upstream server tried, the one whose response was sent
+			if values := upstreamValues(v); len(values) > 0 {
+				l.BackendStatusCode, err = parseStatusCode(values[len(values)-1])
+			}
+		default:
+			l.setExtra("$"+name, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.Date.IsZero() {
+		return nil, fmt.Errorf("missing date in line: %s", line)
+	}
+
+	resource := requestURI
+	switch {
+	case request != "":
+		l.Method, resource, l.Protocol, err = parseRequest(request)
+		if err != nil {
+			return nil, err
+		}
+	case resource == "" && args != "" && args != "-":
+		resource = uri + "?" + args
+	case resource == "":
+		resource = uri
+	}
+	if err = l.setResource(resource); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// upstreamValues returns the values of an upstream variable, which has one value for each upstream
+// server tried, separated by commas, and for each internal redirect, separated by colons (eg. '0.100,
+// 0.050 : 0.020'). The '-' values of the servers that couldn't be reached are skipped
+func upstreamValues(v string) []string {
+	var values []string
+	for _, f := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ':' }) {
+		if f = strings.TrimSpace(f); f != "" && f != "-" {
+			values = append(values, f)
+		}
+	}
+	return values
+}
+
+// isVariableChar returns true if c can be part of an nginx variable name
+func isVariableChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
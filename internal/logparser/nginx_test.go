@@ -0,0 +1,205 @@
+package logparser
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNginx(t *testing.T) {
+	p := NewNginx()
+	assert.NotNil(t, p)
+	assert.Len(t, p.variables, 8)
+}
+
+func TestNewNginxWithFormat(t *testing.T) {
+	testCases := []struct {
+		format    string
+		shouldErr bool
+	}{
+		{NginxCombinedFormat, false},
+		{`$remote_addr [$time_iso8601] "$request" $status $request_time $upstream_response_time`, false},
+		{`${remote_addr}:${msec} $request_method $uri?$args $status`, false},
+		// Missing time
+		{`$remote_addr "$request" $status`, true},
+		// Missing resource
+		{`$remote_addr [$time_local] $status`, true},
+		// Unterminated variable
+		{`$remote_addr [$time_local] "$request" ${status`, true},
+		// Empty variable name
+		{`$remote_addr [$time_local] "$request" $ $status`, true},
+	}
+
+	for _, tt := range testCases {
+		p, err := NewNginxWithFormat(tt.format)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.format)
+		assert.Equal(t, tt.shouldErr, p == nil, tt.format)
+	}
+}
+
+func TestNginx_ParseLine(t *testing.T) {
+	dateTime, _ := time.Parse(clfTimeLayout, "09/May/2018:16:00:39 +0000")
+
+	testCases := []struct {
+		format    string
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			NginxCombinedFormat,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report/foo HTTP/1.1" 200 123 "-" "Mozilla/5.0 \x22quoted\x22"`,
+			&Line{
+				RemoteHost:    "127.0.0.1",
+				User:          "james",
+				Date:          dateTime,
+				Method:        "GET",
+				Path:          "/report/foo",
+				Route:         "/report/foo",
+				Section:       "/report",
+				Protocol:      "HTTP/1.1",
+				StatusCode:    200,
+				ContentLength: 123,
+				Referer:       "-",
+				UserAgent:     `Mozilla/5.0 "quoted"`,
+			},
+			false,
+		},
+		{
+			`$remote_addr [$time_iso8601] "$request" $status $request_time $upstream_response_time`,
+			`10.0.0.1 [2018-05-09T16:00:39Z] "POST /api/v1/users HTTP/2.0" 201 0.120 0.118`,
+			&Line{
+				RemoteHost:         "10.0.0.1",
+				Date:               dateTime.UTC(),
+				Method:             "POST",
+				Path:               "/api/v1/users",
+				Route:              "/api/v1/users",
+				Section:            "/api",
+				Protocol:           "HTTP/2.0",
+				StatusCode:         201,
+				Duration:           120 * time.Millisecond,
+				HasDuration:        true,
+				BackendDuration:    118 * time.Millisecond,
+				HasBackendDuration: true,
+			},
+			false,
+		},
+		{
+			// Two upstream servers tried, then an internal redirect to another upstream group
+			`$remote_addr [$time_iso8601] "$request" $status "$upstream_status" "$upstream_response_time"`,
+			`10.0.0.1 [2018-05-09T16:00:39Z] "GET /api HTTP/1.1" 200 "502, 504 : 200" "0.100, - : 0.020"`,
+			&Line{
+				RemoteHost:         "10.0.0.1",
+				Date:               dateTime.UTC(),
+				Method:             "GET",
+				Path:               "/api",
+				Route:              "/api",
+				Section:            "/api",
+				Protocol:           "HTTP/1.1",
+				StatusCode:         200,
+				BackendStatusCode:  200,
+				BackendDuration:    120 * time.Millisecond,
+				HasBackendDuration: true,
+			},
+			false,
+		},
+		{
+			// No upstream server reached
+			`$remote_addr [$time_iso8601] "$request" $status $upstream_status $upstream_response_time`,
+			`10.0.0.1 [2018-05-09T16:00:39Z] "GET /api HTTP/1.1" 504 - -`,
+			&Line{
+				RemoteHost: "10.0.0.1",
+				Date:       dateTime.UTC(),
+				Method:     "GET",
+				Path:       "/api",
+				Route:      "/api",
+				Section:    "/api",
+				Protocol:   "HTTP/1.1",
+				StatusCode: 504,
+			},
+			false,
+		},
+		{
+			`$host $remote_addr [$time_iso8601] "$request" $status`,
+			`example.com 10.0.0.1 [2018-05-09T16:00:39Z] "GET / HTTP/1.1" 200`,
+			&Line{
+				VHost:      "example.com",
+				RemoteHost: "10.0.0.1",
+				Date:       dateTime.UTC(),
+				Method:     "GET",
+				Path:       "/",
+				Route:      "/",
+				Section:    "/",
+				Protocol:   "HTTP/1.1",
+				StatusCode: 200,
+			},
+			false,
+		},
+		{
+			`${remote_addr}:${msec} $request_method $uri?$args $status`,
+			`10.0.0.1:1525881639.250 GET /search?q=foo 404`,
+			&Line{
+				RemoteHost: "10.0.0.1",
+				Date:       time.Unix(1525881639, 250*int64(time.Millisecond)),
+				Method:     "GET",
+				Path:       "/search",
+				Route:      "/search",
+				Section:    "/search",
+				Query:      url.Values{"q": {"foo"}},
+				StatusCode: 404,
+			},
+			false,
+		},
+		{
+			// Invalid epoch date
+			`${remote_addr}:${msec} $request_method $uri?$args $status`,
+			`10.0.0.1:1525881639.abc GET /search?q=foo 404`,
+			nil,
+			true,
+		},
+		{
+			// Missing user agent
+			NginxCombinedFormat,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report/foo HTTP/1.1" 200 123 "-"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid status code
+			NginxCombinedFormat,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report/foo HTTP/1.1" abc 123 "-" "-"`,
+			nil,
+			true,
+		},
+		{
+			// Invalid upstream values
+			`$remote_addr [$time_iso8601] "$request" $status $upstream_status`,
+			`10.0.0.1 [2018-05-09T16:00:39Z] "GET /api HTTP/1.1" 200 abc`,
+			nil,
+			true,
+		},
+		{
+			`$remote_addr [$time_iso8601] "$request" $status "$upstream_response_time"`,
+			`10.0.0.1 [2018-05-09T16:00:39Z] "GET /api HTTP/1.1" 200 "0.100, abc"`,
+			nil,
+			true,
+		},
+		{
+			// Resource doesn't start with /
+			NginxCombinedFormat,
+			`127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET report HTTP/1.1" 200 123 "-" "-"`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range testCases {
+		p, err := NewNginxWithFormat(tt.format)
+		assert.NoError(t, err)
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.EqualValues(t, tt.expLine, parsed)
+	}
+}
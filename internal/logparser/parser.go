@@ -0,0 +1,113 @@
+package logparser
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Parser parses single log lines into their structured representation
+type Parser interface {
+	// ParseLine returns either the parsed line or an error in case the line is malformed
+	// or misses some required field (eg. the date)
+	ParseLine(line string) (*Line, error)
+}
+
+// Factory returns a new parser for a specific log format
+type Factory func() (Parser, error)
+
+const (
+	// DefaultFormat is the name of the format used when none is specified.
+	// It accepts both the Common and the Combined Log Formats
+	DefaultFormat = "httpd"
+	// AutoFormat is the name of the format that detects the actual format from the log lines
+	AutoFormat = "auto"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register(DefaultFormat, func() (Parser, error) {
+		return New(), nil
+	})
+	Register("common", func() (Parser, error) {
+		return NewWithFormat(`%h %l %u %t "%r" %>s %b`)
+	})
+	Register("combined", func() (Parser, error) {
+		return NewWithFormat(`%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`)
+	})
+	Register("vhost_combined", func() (Parser, error) {
+		return NewWithFormat(`%v:%p %h %l %u %t "%r" %>s %O "%{Referer}i" "%{User-Agent}i"`)
+	})
+	Register("alb", func() (Parser, error) {
+		return NewALB(), nil
+	})
+	Register("elb", func() (Parser, error) {
+		return NewClassicELB(), nil
+	})
+	Register("haproxy", func() (Parser, error) {
+		return NewHAProxy(), nil
+	})
+	Register("fast", func() (Parser, error) {
+		return NewFast(), nil
+	})
+	Register("nginx", func() (Parser, error) {
+		return NewNginx(), nil
+	})
+	Register("gcp", func() (Parser, error) {
+		return NewJSONWithMapping(GCPLoadBalancerMapping)
+	})
+	Register("json", func() (Parser, error) {
+		return NewJSON(), nil
+	})
+	Register("w3c", func() (Parser, error) {
+		return NewW3C(), nil
+	})
+	Register(AutoFormat, func() (Parser, error) {
+		return NewAuto(DefaultSampleSize, nil)
+	})
+}
+
+// Register makes a log format available by the provided name.
+// It panics if a format with the same name is already registered or the factory is nil
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if f == nil {
+		panic("logparser: cannot register nil factory for format " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("logparser: format " + name + " already registered")
+	}
+	registry[name] = f
+}
+
+// Get returns a new parser for the format registered with the provided name.
+// Returns an error if there's no such format
+func Get(name string) (Parser, error) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown log format %s", name)
+	}
+	return f()
+}
+
+// Formats returns the sorted names of all the registered formats
+func Formats() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
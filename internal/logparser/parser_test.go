@@ -0,0 +1,76 @@
+package logparser
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	for _, name := range Formats() {
+		p, err := Get(name)
+		assert.NoError(t, err, name)
+		assert.NotNil(t, p, name)
+	}
+}
+
+func TestGet_UnknownFormat(t *testing.T) {
+	p, err := Get("asd")
+	assert.Error(t, err)
+	assert.Nil(t, p)
+}
+
+func TestGet_DefaultFormat(t *testing.T) {
+	p, err := Get(DefaultFormat)
+	assert.NoError(t, err)
+	assert.IsType(t, &HTTPd{}, p)
+}
+
+func TestGet_VHostCombined(t *testing.T) {
+	p, err := Get("vhost_combined")
+	assert.NoError(t, err)
+
+	l, err := p.ParseLine(`www.example.com:443 127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "curl/7.58.0"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "www.example.com", l.VHost)
+	assert.Equal(t, "127.0.0.1", l.RemoteHost)
+	assert.Equal(t, "/report", l.Section)
+	assert.Equal(t, "curl/7.58.0", l.UserAgent)
+	assert.Equal(t, map[string]string{"%p": "443", "%O": "123"}, l.Extra)
+}
+
+func TestFormats(t *testing.T) {
+	formats := Formats()
+	assert.Contains(t, formats, DefaultFormat)
+	assert.Contains(t, formats, AutoFormat)
+	assert.Contains(t, formats, "common")
+	assert.Contains(t, formats, "combined")
+	assert.True(t, sort.StringsAreSorted(formats))
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-register", func() (Parser, error) {
+		return New(), nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-register")
+		registryMu.Unlock()
+	}()
+
+	p, err := Get("test-register")
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+}
+
+func TestRegister_Panics(t *testing.T) {
+	assert.Panics(t, func() {
+		Register(DefaultFormat, func() (Parser, error) {
+			return New(), nil
+		})
+	})
+	assert.Panics(t, func() {
+		Register("test-nil", nil)
+	})
+}
@@ -0,0 +1,137 @@
+package logparser
+
+import "strings"
+
+const (
+	idPlaceholder    = ":id"
+	uuidPlaceholder  = ":uuid"
+	hashPlaceholder  = ":hash"
+	tokenPlaceholder = ":token"
+
+	minHashLength  = 16 // Shorter hex segments are likely to be words (eg. 'cafe' or 'decade')
+	minTokenLength = 20
+)
+
+// getRouteFromPath returns the route template of a path, that is the path with the segments
+// holding identifiers replaced by placeholders.
+// Eg. the route for '/users/12345/orders/9f8e7d6c-5b4a-3c2d-1e0f-a9b8c7d6e5f4' is
+// '/users/:id/orders/:uuid'.
+// Numeric IDs become ':id', UUIDs ':uuid', hex hashes ':hash' and long opaque tokens mixing
+// letters and digits ':token'
+func getRouteFromPath(path string) string {
+	var b strings.Builder
+	copied := 0 // Length of the prefix of path already written to b
+	for start := 0; start <= len(path); {
+		end := strings.IndexByte(path[start:], '/')
+		if end < 0 {
+			end = len(path)
+		} else {
+			end += start
+		}
+		if p := placeholder(path[start:end]); p != "" {
+			b.WriteString(path[copied:start])
+			b.WriteString(p)
+			copied = end
+		}
+		start = end + 1
+	}
+	if copied == 0 { // Nothing to replace, so avoid the allocation
+		return path
+	}
+	b.WriteString(path[copied:])
+	return b.String()
+}
+
+// placeholder returns the placeholder replacing a path segment or the empty string if the
+// segment is not an identifier
+func placeholder(segment string) string {
+	switch {
+	case segment == "":
+		return ""
+	case isNumeric(segment):
+		return idPlaceholder
+	case isUUID(segment):
+		return uuidPlaceholder
+	case isHash(segment):
+		return hashPlaceholder
+	case isToken(segment):
+		return tokenPlaceholder
+	}
+	return ""
+}
+
+// isNumeric returns true if s is made of decimal digits only
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID returns true if s is a UUID in its canonical 8-4-4-4-12 hex form
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHash returns true if s is a long enough hex string containing at least a digit
+// (eg. an MD5 or SHA-1 digest)
+func isHash(s string) bool {
+	if len(s) < minHashLength {
+		return false
+	}
+	hasDigit := false
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+		hasDigit = hasDigit || isDigit(s[i])
+	}
+	return hasDigit
+}
+
+// isToken returns true if s is a long enough string of URL-safe base64 characters mixing
+// letters and digits (eg. a session or an API token)
+func isToken(s string) bool {
+	if len(s) < minTokenLength {
+		return false
+	}
+	hasDigit, hasLetter := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isDigit(c):
+			hasDigit = true
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			hasLetter = true
+		case c == '-' || c == '_':
+		default:
+			return false
+		}
+	}
+	return hasDigit && hasLetter
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
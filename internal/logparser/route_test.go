@@ -0,0 +1,37 @@
+package logparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRouteFromPath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expRoute string
+	}{
+		{"/", "/"},
+		{"/report", "/report"},
+		{"/report/foo/bar", "/report/foo/bar"},
+		{"/users/12345", "/users/:id"},
+		{"/users/12345/", "/users/:id/"},
+		{"/users/12345/orders/9f8e7d6c-5b4a-3c2d-1e0f-a9b8c7d6e5f4", "/users/:id/orders/:uuid"},
+		{"/users/12345/orders/9F8E7D6C-5B4A-3C2D-1E0F-A9B8C7D6E5F4", "/users/:id/orders/:uuid"},
+		{"/commits/da39a3ee5e6b4b0d3255bfef95601890afd80709", "/commits/:hash"},
+		{"/files/d41d8cd98f00b204e9800998ecf8427e/raw", "/files/:hash/raw"},
+		{"/reset/aGVsbG8gd29ybGQgdG9rZW4xMjM", "/reset/:token"},
+		{"/reset/Ab3_xY9-Qw7zLm2Np5Rs", "/reset/:token"},
+		{"/api/v1/users", "/api/v1/users"},
+		{"/cafe/decade", "/cafe/decade"},                           // Hex words are not hashes
+		{"/deadbeefdeadbeefdeadbeef", "/deadbeefdeadbeefdeadbeef"}, // Hex without digits is not a hash
+		{"/internationalization", "/internationalization"},         // Long words are not tokens
+		{"/9f8e7d6c-5b4a-3c2d-1e0f", "/:token"},                    // Truncated UUIDs are still opaque
+		{"/page/2/item1", "/page/:id/item1"},
+		{"//12", "//:id"},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expRoute, getRouteFromPath(tt.path), tt.path)
+	}
+}
@@ -0,0 +1,126 @@
+package logparser
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Sections derives the section of a request from its path.
+// Paths are matched against an ordered list of rules and the first matching one names the
+// section. Paths matching no rule fall back to their first depth segments
+type Sections struct {
+	depth int
+	rules []sectionRule
+}
+
+// sectionRule maps the paths with a prefix or matching a regular expression to a section
+type sectionRule struct {
+	prefix   string
+	re       *regexp.Regexp
+	template string // Section name, possibly referencing the submatches of re (eg. $1 or ${name})
+}
+
+// NewSections returns the section rules for paths matching no rule, whose section is made of
+// their first depth segments (eg. '/api/v1' for '/api/v1/users' with depth 2).
+// Returns an error if depth is lower than 1
+func NewSections(depth int) (*Sections, error) {
+	if depth < 1 {
+		return nil, fmt.Errorf("invalid section depth %d, must be at least 1", depth)
+	}
+	return &Sections{depth: depth}, nil
+}
+
+// LoadSections returns the section rules with the provided depth and the ordered rules read
+// from a file. Every line of the file is a rule in one of the forms
+//
+//	prefix <path prefix> <section>
+//	regexp <regular expression> <section template>
+//
+// where the template may reference the submatches of the expression (eg. '$1' or '${name}').
+// Empty lines and lines starting with '#' are ignored.
+// Returns an error if the file cannot be read or contains an invalid rule
+func LoadSections(depth int, fileName string) (*Sections, error) {
+	s, err := NewSections(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open section rules file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid section rule at line %d: expected 3 fields, got %d", n, len(fields))
+		}
+		switch fields[0] {
+		case "prefix":
+			err = s.AddPrefixRule(fields[1], fields[2])
+		case "regexp":
+			err = s.AddRegexpRule(fields[1], fields[2])
+		default:
+			err = fmt.Errorf("unknown rule type %s", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid section rule at line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read section rules file: %v", err)
+	}
+	return s, nil
+}
+
+// AddPrefixRule appends a rule mapping the paths starting with prefix to section.
+// Returns an error if either prefix or section is empty
+func (s *Sections) AddPrefixRule(prefix, section string) error {
+	if prefix == "" || section == "" {
+		return fmt.Errorf("prefix rule needs both a prefix and a section")
+	}
+	s.rules = append(s.rules, sectionRule{prefix: prefix, template: section})
+	return nil
+}
+
+// AddRegexpRule appends a rule mapping the paths matching expr to the section obtained by
+// expanding template with the submatches of expr (eg. '^/api/v(\d+)/(\w+)' and '/api/v$1/$2').
+// Returns an error if expr is not a valid regular expression or template is empty
+func (s *Sections) AddRegexpRule(expr, template string) error {
+	if template == "" {
+		return fmt.Errorf("regexp rule needs a section template")
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("cannot compile section regexp: %v", err)
+	}
+	s.rules = append(s.rules, sectionRule{re: re, template: template})
+	return nil
+}
+
+// Section returns the section of the path according to the first matching rule or, if no
+// rule matches, its first depth segments
+func (s *Sections) Section(path string) string {
+	for _, r := range s.rules {
+		if r.re == nil {
+			if strings.HasPrefix(path, r.prefix) {
+				return r.template
+			}
+			continue
+		}
+		if match := r.re.FindStringSubmatchIndex(path); match != nil {
+			return string(r.re.ExpandString(nil, r.template, path, match))
+		}
+	}
+	return getSectionFromPath(path, s.depth)
+}
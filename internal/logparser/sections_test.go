@@ -0,0 +1,125 @@
+package logparser
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSections(t *testing.T) {
+	testCases := []struct {
+		depth     int
+		shouldErr bool
+	}{
+		{1, false},
+		{3, false},
+		{0, true},
+		{-1, true},
+	}
+
+	for _, tt := range testCases {
+		s, err := NewSections(tt.depth)
+		assert.Equal(t, tt.shouldErr, err != nil)
+		assert.Equal(t, tt.shouldErr, s == nil)
+	}
+}
+
+func TestSections_AddRule_Err(t *testing.T) {
+	s, _ := NewSections(1)
+	assert.Error(t, s.AddPrefixRule("", "/foo"))
+	assert.Error(t, s.AddPrefixRule("/foo", ""))
+	assert.Error(t, s.AddRegexpRule("^/foo(", "/foo"))
+	assert.Error(t, s.AddRegexpRule("^/foo", ""))
+	assert.Empty(t, s.rules)
+}
+
+func TestSections_Section(t *testing.T) {
+	s, _ := NewSections(2)
+	assert.NoError(t, s.AddPrefixRule("/static/", "/static"))
+	assert.NoError(t, s.AddRegexpRule(`^/api/v(\d+)/(\w+)`, "/api/v$1/$2"))
+	assert.NoError(t, s.AddRegexpRule(`^/users/(?P<id>\d+)$`, "/users/${id}"))
+	assert.NoError(t, s.AddPrefixRule("/api", "/api"))
+
+	testCases := []struct {
+		path       string
+		expSection string
+	}{
+		{"/static/css/main.css", "/static"},
+		{"/static", "/static"}, // Doesn't match "/static/", so it falls back to the depth
+		{"/api/v1/users", "/api/v1/users"},
+		{"/api/v1/users/42", "/api/v1/users"},
+		{"/api/v2/orders/", "/api/v2/orders"},
+		{"/api/v2", "/api"}, // Matched by the prefix rule only
+		{"/api/health", "/api"},
+		{"/users/42", "/users/42"},
+		{"/users/42/edit", "/users/42"}, // Falls back to the depth
+		{"/report/foo/bar", "/report/foo"},
+		{"/report", "/report"},
+		{"/", "/"},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.expSection, s.Section(tt.path), tt.path)
+	}
+}
+
+func TestSections_SectionFirstMatchWins(t *testing.T) {
+	s, _ := NewSections(1)
+	assert.NoError(t, s.AddPrefixRule("/api", "/api"))
+	assert.NoError(t, s.AddRegexpRule(`^/api/v(\d+)`, "/api/v$1"))
+
+	assert.Equal(t, "/api", s.Section("/api/v1/users"))
+}
+
+func TestLoadSections(t *testing.T) {
+	f, err := ioutil.TempFile("", "sections")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`# Versioned API endpoints
+regexp ^/api/v(\d+)/(\w+) /api/v$1/$2
+
+prefix   /static/   /static
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	s, err := LoadSections(2, f.Name())
+	assert.NoError(t, err)
+	assert.Len(t, s.rules, 2)
+	assert.Equal(t, "/api/v2/orders", s.Section("/api/v2/orders/1"))
+	assert.Equal(t, "/static", s.Section("/static/img/logo.png"))
+	assert.Equal(t, "/report/foo", s.Section("/report/foo/bar"))
+}
+
+func TestLoadSections_Err(t *testing.T) {
+	testCases := []struct {
+		content string
+		depth   int
+	}{
+		{"prefix /static/ /static", 0},
+		{"prefix /static/", 1},
+		{"prefix /static/ /static extra", 1},
+		{"suffix .css /css", 1},
+		{"regexp ^/api/(v /api", 1},
+	}
+
+	for _, tt := range testCases {
+		f, err := ioutil.TempFile("", "sections")
+		assert.NoError(t, err)
+		_, err = f.WriteString(tt.content)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		s, err := LoadSections(tt.depth, f.Name())
+		assert.Error(t, err, tt.content)
+		assert.Nil(t, s)
+		os.Remove(f.Name())
+	}
+
+	s, err := LoadSections(1, "/non/existing/file")
+	assert.Error(t, err)
+	assert.Nil(t, s)
+}
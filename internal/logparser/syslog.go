@@ -0,0 +1,196 @@
+package logparser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogFacilities are the names of the syslog facilities, indexed by their code
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv",
+	"ftp", "ntp", "security", "console", "solaris-cron", "local0", "local1", "local2", "local3",
+	"local4", "local5", "local6", "local7",
+}
+
+// syslogHeader holds the fields of the header of a syslog message. Empty fields are missing
+// or nil (ie. '-') in the message
+type syslogHeader struct {
+	facility string
+	hostname string
+	appName  string
+}
+
+// Syslog is a parser for access log lines framed as syslog messages (eg. written by
+// 'CustomLog "|/usr/bin/logger"' and collected by a central syslog server). It strips the
+// RFC 3164 or RFC 5424 header and hands the message to the wrapped parser.
+// The hostname, the app name (ie. the tag) and the facility of the message are stored in
+// Line.Extra as "syslog_hostname", "syslog_app_name" and "syslog_facility"
+type Syslog struct {
+	parser Parser
+}
+
+// NewSyslog returns a parser for the syslog messages whose payload is parsed by p. Cannot return nil
+func NewSyslog(p Parser) *Syslog {
+	return &Syslog{parser: p}
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// Lines without a syslog header are handed to the wrapped parser as they are
+func (p *Syslog) ParseLine(line string) (*Line, error) {
+	h, msg, ok := parseSyslogHeader(line)
+	if !ok {
+		return p.parser.ParseLine(line)
+	}
+	l, err := p.parser.ParseLine(msg)
+	if err != nil {
+		return nil, err
+	}
+	if h.hostname != "" {
+		l.setExtra("syslog_hostname", h.hostname)
+	}
+	if h.appName != "" {
+		l.setExtra("syslog_app_name", h.appName)
+	}
+	if h.facility != "" {
+		l.setExtra("syslog_facility", h.facility)
+	}
+	return l, nil
+}
+
+// parseSyslogHeader splits line in its syslog header and message. The header is either an
+// RFC 5424 one or an RFC 3164 one, optionally without priority (as written to files by
+// syslog daemons) and with an RFC 3339 timestamp instead of the traditional one.
+// Returns false if line doesn't start with a syslog header
+func parseSyslogHeader(line string) (syslogHeader, string, bool) {
+	var h syslogHeader
+	rest := line
+	hasPri := false
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end < 2 || end > 4 {
+			return h, "", false
+		}
+		pri, err := strconv.Atoi(rest[1:end])
+		if err != nil || pri < 0 || pri >= len(syslogFacilities)*8 {
+			return h, "", false
+		}
+		h.facility = syslogFacilities[pri/8]
+		rest = rest[end+1:]
+		hasPri = true
+	}
+	if hasPri && strings.HasPrefix(rest, "1 ") {
+		return parseRFC5424Header(h, rest[2:])
+	}
+	return parseRFC3164Header(h, rest)
+}
+
+// parseRFC5424Header parses the RFC 5424 header after the priority and the version
+// (eg. '2003-10-11T22:14:15.003Z host app 1234 ID47 [id@32473 k="v"] message')
+func parseRFC5424Header(h syslogHeader, s string) (syslogHeader, string, bool) {
+	var fields [5]string // Timestamp, hostname, app name, process ID and message ID
+	for i := range fields {
+		end := strings.IndexByte(s, ' ')
+		if end <= 0 {
+			return h, "", false
+		}
+		fields[i] = s[:end]
+		s = s[end+1:]
+	}
+	if fields[0] != "-" {
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			return h, "", false
+		}
+	}
+	h.hostname = syslogNilValue(fields[1])
+	h.appName = syslogNilValue(fields[2])
+
+	// Structured data is either nil or a sequence of elements, whose quoted parameter values
+	// may contain escaped quotes and square brackets
+	end := 0
+	if strings.HasPrefix(s, "-") {
+		end = 1
+	} else {
+		for end < len(s) && s[end] == '[' {
+			quoted := false
+			i := end + 1
+			for ; i < len(s); i++ {
+				if s[i] == '\\' {
+					i++
+					continue
+				}
+				if s[i] == '"' {
+					quoted = !quoted
+				} else if s[i] == ']' && !quoted {
+					break
+				}
+			}
+			if i >= len(s) {
+				return h, "", false
+			}
+			end = i + 1
+		}
+		if end == 0 {
+			return h, "", false
+		}
+	}
+	msg := s[end:]
+	if msg != "" && msg[0] != ' ' {
+		return h, "", false
+	}
+	// The message may start with the UTF-8 byte order mark
+	msg = strings.TrimPrefix(strings.TrimPrefix(msg, " "), "\ufeff")
+	return h, msg, true
+}
+
+// parseRFC3164Header parses the RFC 3164 header after the priority
+// (eg. 'Oct 11 22:14:15 host app[1234]: message')
+func parseRFC3164Header(h syslogHeader, s string) (syslogHeader, string, bool) {
+	if len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			return parseRFC3164HostTag(h, s[len(time.Stamp)+1:])
+		}
+	}
+	end := strings.IndexByte(s, ' ')
+	if end < 0 {
+		return h, "", false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, s[:end]); err != nil {
+		return h, "", false
+	}
+	return parseRFC3164HostTag(h, s[end+1:])
+}
+
+// parseRFC3164HostTag parses the hostname and the tag, with an optional process ID, that follow
+// the timestamp of an RFC 3164 header
+func parseRFC3164HostTag(h syslogHeader, s string) (syslogHeader, string, bool) {
+	end := strings.IndexByte(s, ' ')
+	if end <= 0 {
+		return h, "", false
+	}
+	h.hostname = s[:end]
+	s = s[end+1:]
+
+	end = strings.Index(s, ": ")
+	if end <= 0 || strings.IndexByte(s[:end], ' ') >= 0 {
+		return h, "", false
+	}
+	tag := s[:end]
+	if i := strings.IndexByte(tag, '['); i >= 0 {
+		if i == 0 || !strings.HasSuffix(tag, "]") {
+			return h, "", false
+		}
+		tag = tag[:i]
+	}
+	h.appName = tag
+	return h, s[end+2:], true
+}
+
+// syslogNilValue returns v or an empty string if v is the nil value (ie. '-')
+func syslogNilValue(v string) string {
+	if v == "-" {
+		return ""
+	}
+	return v
+}
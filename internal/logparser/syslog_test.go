@@ -0,0 +1,134 @@
+package logparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSyslog(t *testing.T) {
+	p := NewSyslog(New())
+	assert.NotNil(t, p)
+	assert.IsType(t, &HTTPd{}, p.parser)
+}
+
+func TestSyslog_ParseLine(t *testing.T) {
+	testCases := []struct {
+		line      string
+		expExtra  map[string]string
+		shouldErr bool
+	}{
+		{
+			// RFC 3164, as sent by logger
+			`<190>May  9 16:00:39 web1 httpd[1234]: ` + testCommonLine,
+			map[string]string{"syslog_hostname": "web1", "syslog_app_name": "httpd", "syslog_facility": "local7"},
+			false,
+		},
+		{
+			// RFC 3164, as written to files by syslog daemons
+			`May  9 16:00:39 web1 httpd: ` + testCommonLine,
+			map[string]string{"syslog_hostname": "web1", "syslog_app_name": "httpd"},
+			false,
+		},
+		{
+			// RFC 3164 with RFC 3339 timestamp (eg. rsyslog's RSYSLOG_FileFormat)
+			`2018-05-09T16:00:39.123456+00:00 web1 httpd[1234]: ` + testCommonLine,
+			map[string]string{"syslog_hostname": "web1", "syslog_app_name": "httpd"},
+			false,
+		},
+		{
+			// RFC 5424
+			`<134>1 2018-05-09T16:00:39.003Z web1.example.com httpd 1234 - - ` + testCommonLine,
+			map[string]string{"syslog_hostname": "web1.example.com", "syslog_app_name": "httpd", "syslog_facility": "local0"},
+			false,
+		},
+		{
+			// RFC 5424 with structured data and BOM
+			`<14>1 2018-05-09T16:00:39Z web1 - - ID47 [exampleSDID@32473 iut="3" eventID="a\"]"][meta x="y"] ` + "\ufeff" + testCommonLine,
+			map[string]string{"syslog_hostname": "web1", "syslog_facility": "user"},
+			false,
+		},
+		{
+			// No syslog header
+			testCommonLine,
+			nil,
+			false,
+		},
+		{
+			// Invalid payload
+			`<190>May  9 16:00:39 web1 httpd[1234]: asd`,
+			nil,
+			true,
+		},
+		{
+			// Unterminated structured data
+			`<134>1 2018-05-09T16:00:39.003Z web1 httpd 1234 - [exampleSDID@32473 iut="3" ` + testCommonLine,
+			nil,
+			true,
+		},
+	}
+
+	p := NewSyslog(New())
+	for _, tt := range testCases {
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		if tt.shouldErr {
+			assert.Nil(t, parsed, tt.line)
+			continue
+		}
+		if assert.NotNil(t, parsed, tt.line) {
+			assert.Equal(t, "/report", parsed.Path, tt.line)
+			assert.Equal(t, 200, parsed.StatusCode, tt.line)
+			assert.Equal(t, tt.expExtra, parsed.Extra, tt.line)
+		}
+	}
+}
+
+func TestSyslog_ParseLine_Directive(t *testing.T) {
+	p := NewSyslog(NewW3C())
+	parsed, err := p.ParseLine(`<134>Oct 11 22:14:15 web1 iis: #Fields: date time cs-uri-stem sc-status`)
+	assert.Equal(t, ErrDirective, err)
+	assert.Nil(t, parsed)
+
+	parsed, err = p.ParseLine(`<134>Oct 11 22:14:15 web1 iis: 2018-05-09 16:00:39 /report 200`)
+	assert.NoError(t, err)
+	assert.Equal(t, "/report", parsed.Path)
+	assert.Equal(t, "iis", parsed.Extra["syslog_app_name"])
+}
+
+func TestParseSyslogHeader(t *testing.T) {
+	testCases := []struct {
+		line   string
+		expH   syslogHeader
+		expMsg string
+		expOk  bool
+	}{
+		{`<0>Oct 11 22:14:15 host app[1]: msg`, syslogHeader{"kern", "host", "app"}, "msg", true},
+		{`Oct 11 22:14:15 host app: msg: with colons`, syslogHeader{"", "host", "app"}, "msg: with colons", true},
+		{`<191>1 - - - - - -`, syslogHeader{"local7", "", ""}, "", true},
+		{`<165>1 2003-10-11T22:14:15.003Z host app - - - msg`, syslogHeader{"local4", "host", "app"}, "msg", true},
+		// Invalid priority
+		{`<192>Oct 11 22:14:15 host app: msg`, syslogHeader{}, "", false},
+		{`<abc>Oct 11 22:14:15 host app: msg`, syslogHeader{}, "", false},
+		// Invalid timestamp
+		{`Oct 32 22:14:15 host app: msg`, syslogHeader{}, "", false},
+		{`<165>1 2003-10-11 host app - - - msg`, syslogHeader{}, "", false},
+		// Missing tag
+		{`Oct 11 22:14:15 host msg`, syslogHeader{}, "", false},
+		{`Oct 11 22:14:15 host [1]: msg`, syslogHeader{}, "", false},
+		// Missing fields
+		{`<165>1 2003-10-11T22:14:15.003Z host app`, syslogHeader{}, "", false},
+		// Invalid structured data
+		{`<165>1 2003-10-11T22:14:15.003Z host app - - msg`, syslogHeader{}, "", false},
+		{testCommonLine, syslogHeader{}, "", false},
+	}
+
+	for _, tt := range testCases {
+		h, msg, ok := parseSyslogHeader(tt.line)
+		assert.Equal(t, tt.expOk, ok, tt.line)
+		if ok {
+			assert.Equal(t, tt.expH, h, tt.line)
+			assert.Equal(t, tt.expMsg, msg, tt.line)
+		}
+	}
+}
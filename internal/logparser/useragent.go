@@ -0,0 +1,184 @@
+package logparser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Classes of the clients that made the requests
+const (
+	ClassHuman      = "human"
+	ClassBot        = "bot"
+	ClassMonitoring = "monitoring"
+	ClassUnknown    = "unknown"
+)
+
+// maxClassifierCache is the number of user agents whose class is cached. Most of the traffic
+// comes from a small set of user agents, so the cache is simply cleared when full
+const maxClassifierCache = 10000
+
+// DefaultUserAgentPatterns are the built-in patterns of the Classifier, in the format accepted by
+// LoadClassifier. The last one catches the bots that aren't explicitly listed
+const DefaultUserAgentPatterns = `
+monitoring Pingdom pingdom
+monitoring UptimeRobot uptimerobot
+monitoring StatusCake statuscake
+monitoring Site24x7 site24x7
+monitoring NewRelic newrelicpinger
+monitoring Datadog datadog\s?(agent|synthetics)
+monitoring ELB-HealthChecker elb-healthchecker
+monitoring GoogleHC googlehc
+monitoring kube-probe kube-probe
+monitoring Nagios nagios|check_http
+monitoring Zabbix zabbix
+monitoring Blackbox-Exporter blackbox\sexporter
+monitoring Consul consul\shealth\scheck
+bot Googlebot googlebot|google-inspectiontool|adsbot-google|mediapartners-google
+bot Bingbot bingbot|bingpreview|adidxbot
+bot YandexBot yandex(bot|images|mobilebot)
+bot Baiduspider baiduspider
+bot DuckDuckBot duckduckbot
+bot Applebot applebot
+bot AhrefsBot ahrefsbot
+bot SemrushBot semrushbot
+bot MJ12bot mj12bot
+bot DotBot dotbot
+bot PetalBot petalbot
+bot GPTBot gptbot
+bot CCBot ccbot
+bot facebookexternalhit facebookexternalhit|facebookcatalog
+bot Twitterbot twitterbot
+bot Slackbot slackbot
+bot LinkedInBot linkedinbot
+bot curl ^curl/
+bot Wget ^wget/
+bot python-requests python-requests|python-urllib|aiohttp
+bot Go-http-client go-http-client
+bot Java ^java/|apache-httpclient|okhttp
+bot libwww-perl libwww-perl
+bot Scrapy scrapy
+bot other bot\b|crawl|spider|slurp|scraper|headless
+`
+
+// Classifier tells human traffic from crawlers and monitoring probes by the user agent of the
+// requests. User agents are matched against an ordered list of patterns and the first matching
+// one names the class and the bot. User agents matching no pattern are human if they look like
+// the ones of browsers, unknown otherwise (eg. empty ones)
+type Classifier struct {
+	mu       sync.Mutex
+	patterns []uaPattern
+	cache    map[string]uaClass
+}
+
+// uaPattern maps the user agents matching a regular expression to a class and a bot name
+type uaPattern struct {
+	re    *regexp.Regexp
+	class string
+	name  string
+}
+
+// uaClass is the result of the classification of a user agent
+type uaClass struct {
+	class string
+	name  string
+}
+
+// NewClassifier returns a classifier with the built-in patterns. Cannot return nil
+func NewClassifier() *Classifier {
+	c := &Classifier{cache: make(map[string]uaClass)}
+	if err := c.addPatterns(strings.NewReader(DefaultUserAgentPatterns)); err != nil {
+		panic("logparser: invalid default user agent patterns: " + err.Error())
+	}
+	return c
+}
+
+// LoadClassifier returns a classifier with the ordered patterns read from a file, which are
+// matched before the built-in ones so that they can be updated without a new release.
+// Every line of the file is a pattern in the form
+//
+//	<class> <bot name> <regular expression>
+//
+// where the class is either bot or monitoring and the expression is matched case-insensitively.
+// Empty lines and lines starting with '#' are ignored.
+// Returns an error if the file cannot be read or contains an invalid pattern
+func LoadClassifier(fileName string) (*Classifier, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open user agent patterns file: %v", err)
+	}
+	defer f.Close()
+
+	c := &Classifier{cache: make(map[string]uaClass)}
+	if err := c.addPatterns(f); err != nil {
+		return nil, err
+	}
+	if err := c.addPatterns(strings.NewReader(DefaultUserAgentPatterns)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// addPatterns appends the patterns read from r
+func (c *Classifier) addPatterns(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid user agent pattern at line %d: expected 3 fields, got %d", n, len(fields))
+		}
+		if fields[0] != ClassBot && fields[0] != ClassMonitoring {
+			return fmt.Errorf("invalid user agent pattern at line %d: unknown class %s", n, fields[0])
+		}
+		re, err := regexp.Compile("(?i)" + fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid user agent pattern at line %d: %v", n, err)
+		}
+		c.patterns = append(c.patterns, uaPattern{re: re, class: fields[0], name: fields[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read user agent patterns: %v", err)
+	}
+	return nil
+}
+
+// Classify returns the class of the client with the given user agent and, for bots and
+// monitoring probes, their name
+func (c *Classifier) Classify(userAgent string) (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r, ok := c.cache[userAgent]; ok {
+		return r.class, r.name
+	}
+	r := c.classify(userAgent)
+	if len(c.cache) >= maxClassifierCache {
+		c.cache = make(map[string]uaClass)
+	}
+	c.cache[userAgent] = r
+	return r.class, r.name
+}
+
+func (c *Classifier) classify(userAgent string) uaClass {
+	if userAgent == "" || userAgent == "-" {
+		return uaClass{class: ClassUnknown}
+	}
+	for _, p := range c.patterns {
+		if p.re.MatchString(userAgent) {
+			return uaClass{class: p.class, name: p.name}
+		}
+	}
+	if strings.HasPrefix(userAgent, "Mozilla/") || strings.HasPrefix(userAgent, "Opera/") {
+		return uaClass{class: ClassHuman}
+	}
+	return uaClass{class: ClassUnknown}
+}
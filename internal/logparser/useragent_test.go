@@ -0,0 +1,119 @@
+package logparser
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClassifier(t *testing.T) {
+	c := NewClassifier()
+	assert.NotNil(t, c)
+	assert.NotEmpty(t, c.patterns)
+}
+
+func TestClassifier_Classify(t *testing.T) {
+	testCases := []struct {
+		userAgent string
+		expClass  string
+		expName   string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.77 Safari/537.36", ClassHuman, ""},
+		{"Opera/9.80 (Windows NT 6.1; U; en) Presto/2.8.131 Version/11.11", ClassHuman, ""},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", ClassBot, "Googlebot"},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", ClassBot, "Bingbot"},
+		{"Mozilla/5.0 (compatible; SomeNewBot/1.0; +http://example.com/bot)", ClassBot, "other"},
+		{"curl/7.58.0", ClassBot, "curl"},
+		{"Pingdom.com_bot_version_1.4_(http://www.pingdom.com/)", ClassMonitoring, "Pingdom"},
+		{"Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", ClassMonitoring, "UptimeRobot"},
+		{"kube-probe/1.12", ClassMonitoring, "kube-probe"},
+		{"ELB-HealthChecker/2.0", ClassMonitoring, "ELB-HealthChecker"},
+		{"MyInternalTool/1.0", ClassUnknown, ""},
+		{"-", ClassUnknown, ""},
+		{"", ClassUnknown, ""},
+	}
+
+	c := NewClassifier()
+	for _, tt := range testCases {
+		class, name := c.Classify(tt.userAgent)
+		assert.Equal(t, tt.expClass, class, tt.userAgent)
+		assert.Equal(t, tt.expName, name, tt.userAgent)
+	}
+
+	// Results come from the cache the second time
+	assert.Len(t, c.cache, len(testCases))
+	for _, tt := range testCases {
+		class, name := c.Classify(tt.userAgent)
+		assert.Equal(t, tt.expClass, class, tt.userAgent)
+		assert.Equal(t, tt.expName, name, tt.userAgent)
+	}
+}
+
+func TestClassifier_ClassifyCacheFull(t *testing.T) {
+	c := NewClassifier()
+	for i := 0; i < maxClassifierCache; i++ {
+		c.cache[string(rune(i))] = uaClass{class: ClassUnknown}
+	}
+	class, _ := c.Classify("curl/7.58.0")
+	assert.Equal(t, ClassBot, class)
+	assert.Len(t, c.cache, 1)
+}
+
+func TestLoadClassifier(t *testing.T) {
+	f, err := ioutil.TempFile("", "patterns")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`# Internal tools
+monitoring HealthCheck ^internal-health/
+bot Googlebot-Impostor googlebot/9
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	c, err := LoadClassifier(f.Name())
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		userAgent string
+		expClass  string
+		expName   string
+	}{
+		{"internal-health/1.0", ClassMonitoring, "HealthCheck"},
+		// File patterns are matched before the built-in ones
+		{"Mozilla/5.0 (compatible; Googlebot/9.0)", ClassBot, "Googlebot-Impostor"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", ClassBot, "Googlebot"},
+	}
+	for _, tt := range testCases {
+		class, name := c.Classify(tt.userAgent)
+		assert.Equal(t, tt.expClass, class, tt.userAgent)
+		assert.Equal(t, tt.expName, name, tt.userAgent)
+	}
+}
+
+func TestLoadClassifier_Err(t *testing.T) {
+	testCases := []string{
+		"bot Googlebot",
+		"human Browser mozilla",
+		"bot Broken (unclosed",
+	}
+
+	for _, content := range testCases {
+		f, err := ioutil.TempFile("", "patterns")
+		assert.NoError(t, err)
+		_, err = f.WriteString(content)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		c, err := LoadClassifier(f.Name())
+		assert.Error(t, err, content)
+		assert.Nil(t, c)
+		os.Remove(f.Name())
+	}
+
+	c, err := LoadClassifier("/non/existent/file")
+	assert.Error(t, err)
+	assert.Nil(t, c)
+}
@@ -0,0 +1,196 @@
+package logparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IISDefaultFields are the fields logged by Microsoft IIS by default, used by the W3C parser
+// until it reads a #Fields directive
+const IISDefaultFields = "date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken"
+
+const (
+	w3cDateLayout     = "2006-01-02"
+	w3cTimeLayout     = "15:04:05"
+	w3cDateTimeLayout = w3cDateLayout + " " + w3cTimeLayout
+)
+
+// ErrDirective is returned for the directive lines of W3C logs (eg. '#Fields: ...'), which hold
+// metadata instead of requests
+var ErrDirective = errors.New("directive line")
+
+// W3C the parser for the W3C Extended Log File Format, written by Microsoft IIS among others.
+// See https://www.w3.org/TR/WD-logfile.html.
+// The columns are mapped to the fields of Line according to the latest #Fields directive, so a
+// file can change its fields halfway (eg. after being rotated or truncated)
+type W3C struct {
+	mu     sync.Mutex
+	fields []string
+	date   time.Time // From the #Date directive, used if the fields have no date
+}
+
+// NewW3C returns a W3C log parser expecting IISDefaultFields until it reads a #Fields directive.
+// Cannot return nil
+func NewW3C() *W3C {
+	p, _ := NewW3CWithFields(IISDefaultFields)
+	return p
+}
+
+// NewW3CWithFields returns a W3C log parser expecting the space-separated fields until it reads a
+// #Fields directive.
+// Returns an error if the fields miss the status or the requested resource, since they're
+// required by the monitor
+func NewW3CWithFields(fields string) (*W3C, error) {
+	p := &W3C{}
+	if err := p.setFields(fields); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ParseLine takes a single log line and returns either its parsed version and an error
+// in case the line is malformed or misses some required field (eg. the date).
+// Directive lines update the parser and return ErrDirective, or an error if they're invalid.
+// Values of fields that have no counterpart in Line are stored in Line.Extra
+func (p *W3C) ParseLine(line string) (*Line, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if strings.HasPrefix(line, "#") {
+		return nil, p.parseDirective(line)
+	}
+	if p.fields == nil {
+		return nil, fmt.Errorf("no valid #Fields directive for line: %s", line)
+	}
+
+	values := strings.Split(line, " ")
+	if len(values) != len(p.fields) {
+		return nil, fmt.Errorf("line has %d values, expected %d: %s", len(values), len(p.fields), line)
+	}
+
+	l := &Line{}
+	var date, clock, resource, query string
+	var err error
+	for i, name := range p.fields {
+		v := values[i]
+		switch name {
+		case "date":
+			date = v
+		case "time":
+			clock = v
+		case "c-ip":
+			l.RemoteHost = v
+		case "cs-username":
+			l.User = v
+		case "cs-method":
+			l.Method = v
+		case "cs-uri-stem", "cs-uri":
+			resource = v
+		case "cs-uri-query":
+			if v != "-" {
+				query = v
+			}
+		case "cs-version":
+			l.Protocol = v
+		case "sc-status":
+			l.StatusCode, err = parseStatusCode(v)
+		case "sc-bytes":
+			l.ContentLength, err = parseSize(v)
+		case "cs-host":
+			l.VHost = hostFromHostPort(v)
+		case "cs(Referer)":
+			l.Referer = v
+		case "cs(User-Agent)":
+			l.UserAgent = strings.Replace(v, "+", " ", -1) // IIS writes spaces as '+'
+		case "time-taken":
+			if v != "-" {
+				l.Duration, err = parseDuration(v, time.Millisecond)
+				l.HasDuration = true
+			}
+		default:
+			l.setExtra(name, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.Date, err = p.parseDate(date, clock); err != nil {
+		return nil, err
+	}
+	if query != "" {
+		resource += "?" + query
+	}
+	if err = l.setResource(resource); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// parseDirective updates the parser with the #Fields and #Date directives, ignoring the others
+func (p *W3C) parseDirective(line string) error {
+	split := strings.SplitN(line[1:], ":", 2)
+	if len(split) != 2 {
+		return ErrDirective
+	}
+	value := strings.TrimSpace(split[1])
+
+	switch split[0] {
+	case "Fields":
+		if err := p.setFields(value); err != nil {
+			p.fields = nil // Don't map the following lines with stale fields
+			return err
+		}
+	case "Date":
+		d, err := time.Parse(w3cDateTimeLayout, value)
+		if err != nil {
+			return fmt.Errorf("invalid #Date directive: %v", err)
+		}
+		p.date = d
+	}
+	return ErrDirective
+}
+
+// setFields sets the space-separated fields of the following lines
+func (p *W3C) setFields(fields string) error {
+	names := strings.Fields(fields)
+	hasStatus, hasResource := false, false
+	for _, name := range names {
+		switch name {
+		case "sc-status":
+			hasStatus = true
+		case "cs-uri-stem", "cs-uri":
+			hasResource = true
+		}
+	}
+	if !hasStatus {
+		return fmt.Errorf("fields %q have no sc-status field", fields)
+	}
+	if !hasResource {
+		return fmt.Errorf("fields %q have neither cs-uri-stem nor cs-uri fields", fields)
+	}
+	p.fields = names
+	return nil
+}
+
+// parseDate returns the UTC time of the date and time fields. The date of the #Date directive
+// is used if the line has no date field
+func (p *W3C) parseDate(date, clock string) (time.Time, error) {
+	if clock == "" {
+		return time.Time{}, fmt.Errorf("missing time field")
+	}
+	if date == "" {
+		if p.date.IsZero() {
+			return time.Time{}, fmt.Errorf("missing date field and #Date directive")
+		}
+		date = p.date.Format(w3cDateLayout)
+	}
+	t, err := time.Parse(w3cDateTimeLayout, date+" "+clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %v", err)
+	}
+	return t, nil
+}
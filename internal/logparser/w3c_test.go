@@ -0,0 +1,221 @@
+package logparser
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewW3C(t *testing.T) {
+	p := NewW3C()
+	assert.NotNil(t, p)
+	assert.Len(t, p.fields, 15)
+}
+
+func TestNewW3CWithFields(t *testing.T) {
+	testCases := []struct {
+		fields    string
+		shouldErr bool
+	}{
+		{IISDefaultFields, false},
+		{"date time cs-uri sc-status", false},
+		{"time cs-uri-stem sc-status", false},
+		{"date time cs-uri-stem", true},
+		{"date time sc-status", true},
+		{"", true},
+	}
+
+	for _, tt := range testCases {
+		p, err := NewW3CWithFields(tt.fields)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.fields)
+		assert.Equal(t, tt.shouldErr, p == nil, tt.fields)
+	}
+}
+
+func TestW3C_ParseLine(t *testing.T) {
+	dateTime := time.Date(2018, time.May, 9, 16, 0, 39, 0, time.UTC)
+
+	testCases := []struct {
+		line      string
+		expLine   *Line
+		shouldErr bool
+	}{
+		{
+			// IIS default fields
+			"2018-05-09 16:00:39 10.0.0.1 GET /report/foo - 443 james 192.168.1.10 Mozilla/5.0+(Windows+NT+10.0) https://example.com/ 200 0 0 125",
+			&Line{
+				RemoteHost: "192.168.1.10",
+				User:       "james",
+				Date:       dateTime,
+				Method:     "GET",
+				Path:       "/report/foo",
+				Route:      "/report/foo",
+				Section:    "/report",
+				StatusCode: 200,
+				Referer:    "https://example.com/",
+				UserAgent:  "Mozilla/5.0 (Windows NT 10.0)",
+				Duration:   125 * time.Millisecond,
+				Extra: map[string]string{
+					"s-ip":            "10.0.0.1",
+					"s-port":          "443",
+					"sc-substatus":    "0",
+					"sc-win32-status": "0",
+				},
+				HasDuration: true,
+			},
+			false,
+		},
+		{
+			"2018-05-09 16:00:39 10.0.0.1 GET /search q=foo 80 - 192.168.1.10 - - 404 0 2 -",
+			&Line{
+				RemoteHost: "192.168.1.10",
+				User:       "-",
+				Date:       dateTime,
+				Method:     "GET",
+				Path:       "/search",
+				Route:      "/search",
+				Section:    "/search",
+				Query:      url.Values{"q": {"foo"}},
+				StatusCode: 404,
+				Referer:    "-",
+				UserAgent:  "-",
+				Extra: map[string]string{
+					"s-ip":            "10.0.0.1",
+					"s-port":          "80",
+					"sc-substatus":    "0",
+					"sc-win32-status": "2",
+				},
+			},
+			false,
+		},
+		{
+			// Missing values
+			"2018-05-09 16:00:39 10.0.0.1 GET /report",
+			nil,
+			true,
+		},
+		{
+			// Invalid date
+			"2018-05-32 16:00:39 10.0.0.1 GET /report - 443 - 192.168.1.10 - - 200 0 0 125",
+			nil,
+			true,
+		},
+		{
+			// Invalid status
+			"2018-05-09 16:00:39 10.0.0.1 GET /report - 443 - 192.168.1.10 - - 2000 0 0 125",
+			nil,
+			true,
+		},
+		{
+			// Invalid time taken
+			"2018-05-09 16:00:39 10.0.0.1 GET /report - 443 - 192.168.1.10 - - 200 0 0 abc",
+			nil,
+			true,
+		},
+		{
+			// Resource doesn't start with /
+			"2018-05-09 16:00:39 10.0.0.1 GET report - 443 - 192.168.1.10 - - 200 0 0 125",
+			nil,
+			true,
+		},
+		{
+			testCommonLine,
+			nil,
+			true,
+		},
+	}
+
+	p := NewW3C()
+	for _, tt := range testCases {
+		parsed, err := p.ParseLine(tt.line)
+		assert.Equal(t, tt.shouldErr, err != nil, tt.line)
+		assert.Equal(t, tt.expLine, parsed, tt.line)
+	}
+}
+
+func TestW3C_ParseLineDirectives(t *testing.T) {
+	p := NewW3C()
+
+	for _, line := range []string{
+		"#Software: Microsoft Internet Information Services 10.0",
+		"#Version: 1.0",
+		"#Date: 2018-05-09 16:00:00",
+		"#Fields: time cs-method cs-uri-stem sc-status sc-bytes time-taken cs-host",
+		"#Remark",
+	} {
+		parsed, err := p.ParseLine(line)
+		assert.Equal(t, ErrDirective, err, line)
+		assert.Nil(t, parsed)
+	}
+
+	// The date comes from the #Date directive
+	parsed, err := p.ParseLine("16:00:39 POST /api/v1/users 201 512 3 example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &Line{
+		Date:          time.Date(2018, time.May, 9, 16, 0, 39, 0, time.UTC),
+		Method:        "POST",
+		Path:          "/api/v1/users",
+		Route:         "/api/v1/users",
+		Section:       "/api",
+		StatusCode:    201,
+		ContentLength: 512,
+		Duration:      3 * time.Millisecond,
+		HasDuration:   true,
+		VHost:         "example.com",
+	}, parsed)
+
+	// The fields change halfway, eg. after the file is rotated
+	_, err = p.ParseLine("#Fields: date time cs-uri sc-status")
+	assert.Equal(t, ErrDirective, err)
+	parsed, err = p.ParseLine("2018-05-10 08:00:00 /report?id=1 500")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, time.May, 10, 8, 0, 0, 0, time.UTC), parsed.Date)
+	assert.Equal(t, "/report", parsed.Path)
+	assert.Equal(t, url.Values{"id": {"1"}}, parsed.Query)
+	assert.Equal(t, 500, parsed.StatusCode)
+
+	// Invalid fields make the following lines fail until the next valid ones
+	_, err = p.ParseLine("#Fields: date time cs-method")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrDirective, err)
+	_, err = p.ParseLine("2018-05-10 08:00:00 GET")
+	assert.Error(t, err)
+	_, err = p.ParseLine("#Fields: date time cs-uri-stem sc-status")
+	assert.Equal(t, ErrDirective, err)
+	_, err = p.ParseLine("2018-05-10 08:00:00 /report 200")
+	assert.NoError(t, err)
+
+	// Invalid #Date directive
+	_, err = p.ParseLine("#Date: yesterday")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrDirective, err)
+}
+
+func TestW3C_ParseLineMissingDate(t *testing.T) {
+	p, err := NewW3CWithFields("time cs-uri-stem sc-status")
+	assert.NoError(t, err)
+
+	_, err = p.ParseLine("16:00:39 /report 200")
+	assert.Error(t, err)
+
+	p, err = NewW3CWithFields("date cs-uri-stem sc-status")
+	assert.NoError(t, err)
+
+	_, err = p.ParseLine("2018-05-09 /report 200")
+	assert.Error(t, err)
+}
+
+func TestW3C_ParseLineUTC(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local = time.FixedZone("EDT", -4*3600)
+
+	p, err := NewW3CWithFields("date time cs-uri-stem sc-status")
+	assert.NoError(t, err)
+	l, err := p.ParseLine("2018-05-09 16:00:39 /report 200")
+	assert.NoError(t, err)
+	// W3C times are always in UTC
+	assert.True(t, time.Date(2018, 5, 9, 16, 0, 39, 0, time.UTC).Equal(l.Date), l.Date)
+}
@@ -0,0 +1,110 @@
+package rotate
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncWriter writes to the underlying writer in a separate goroutine, so that slow writes (eg. a
+// rotation or a busy disk) never block the caller. Writes that don't fit in the buffer are dropped
+// and counted, unless the writer is blocking
+type AsyncWriter struct {
+	mu       sync.RWMutex
+	w        io.WriteCloser
+	buf      chan []byte
+	blocking bool
+	closed   bool
+	dropped  int64         // Atomic
+	doneChan chan struct{} // Closed when all the buffered writes have been written
+	log      *log.Logger
+}
+
+// AsyncOption configures an optional behavior of the AsyncWriter
+type AsyncOption func(*AsyncWriter)
+
+// WithBlocking makes writes wait for room in the buffer when it's full, instead of being dropped.
+// The caller is then slowed down to the pace of the underlying writer
+func WithBlocking() AsyncOption {
+	return func(a *AsyncWriter) {
+		a.blocking = true
+	}
+}
+
+// NewAsync returns a writer buffering up to size writes to w. Returns an error if size is not
+// positive
+func NewAsync(w io.WriteCloser, size int, opts ...AsyncOption) (*AsyncWriter, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid buffer size %d, must be positive", size)
+	}
+	a := &AsyncWriter{
+		w:        w,
+		buf:      make(chan []byte, size),
+		doneChan: make(chan struct{}),
+		log:      log.New(os.Stderr, "", log.LstdFlags),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	go a.loop()
+	return a, nil
+}
+
+// Write buffers a copy of p to be written. If the buffer is full, it waits for room if the writer
+// is blocking or drops p otherwise. Errors of the underlying writer are logged, since they happen
+// after Write returns
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, fmt.Errorf("write on closed writer")
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	if a.blocking {
+		a.buf <- b
+		return len(p), nil
+	}
+	select {
+	case a.buf <- b:
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of writes dropped because the buffer was full
+func (a *AsyncWriter) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Close writes the buffered writes and closes the underlying writer
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.buf)
+	a.mu.Unlock()
+
+	<-a.doneChan
+	if d := a.Dropped(); d > 0 {
+		a.log.Printf("[WARN] dropped %d writes, the buffer was full\n", d)
+	}
+	return a.w.Close()
+}
+
+func (a *AsyncWriter) loop() {
+	defer close(a.doneChan)
+	for b := range a.buf {
+		if _, err := a.w.Write(b); err != nil {
+			a.log.Println("[ERROR]", err)
+		}
+	}
+}
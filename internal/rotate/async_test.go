@@ -0,0 +1,105 @@
+package rotate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingWriter blocks every write until unblocked
+type blockingWriter struct {
+	bytes.Buffer
+	unblock chan struct{}
+	closed  bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.Buffer.Write(p)
+}
+
+func (w *blockingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestNewAsync_Err(t *testing.T) {
+	a, err := NewAsync(&blockingWriter{}, 0)
+	assert.Error(t, err)
+	assert.Nil(t, a)
+}
+
+func TestAsyncWriter_Write(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+
+	w, err := New(fileName, 1024, 1)
+	assert.NoError(t, err)
+	a, err := NewAsync(w, 10)
+	assert.NoError(t, err)
+
+	buf := []byte("aaaa\n")
+	for i := 0; i < 3; i++ {
+		n, err := a.Write(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, len(buf), n)
+		copy(buf, "bbbb\n") // Written as it was when buffered
+	}
+	assert.NoError(t, a.Close())
+	assert.NoError(t, a.Close())
+	assert.Equal(t, "aaaa\nbbbb\nbbbb\n", readFile(t, fileName))
+	assert.Equal(t, int64(0), a.Dropped())
+
+	n, err := a.Write(buf)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestAsyncWriter_WriteFull(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	a, err := NewAsync(w, 2)
+	assert.NoError(t, err)
+
+	// The first write is pending, the next two are buffered and the others dropped, never blocking
+	for i := 0; i < 6; i++ {
+		_, err := a.Write([]byte(fmt.Sprintf("%d\n", i)))
+		assert.NoError(t, err)
+	}
+	close(w.unblock)
+	assert.NoError(t, a.Close())
+	assert.True(t, w.closed)
+	assert.Equal(t, int64(len(w.String())/2), 6-a.Dropped())
+	assert.True(t, a.Dropped() >= 3)
+}
+
+func TestAsyncWriter_WriteBlocking(t *testing.T) {
+	w := &blockingWriter{unblock: make(chan struct{})}
+	a, err := NewAsync(w, 2, WithBlocking())
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 6; i++ {
+			_, err := a.Write([]byte(fmt.Sprintf("%d\n", i)))
+			assert.NoError(t, err)
+		}
+	}()
+	// The first write is pending and the next two are buffered, so the fourth one waits
+	select {
+	case <-done:
+		t.Fatal("writes on a full buffer didn't block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(w.unblock)
+	<-done
+	assert.NoError(t, a.Close())
+	assert.Equal(t, "0\n1\n2\n3\n4\n5\n", w.String())
+	assert.Equal(t, int64(0), a.Dropped())
+}
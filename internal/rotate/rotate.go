@@ -0,0 +1,383 @@
+// Package rotate provides a file writer that rotates the file by time and/or once it reaches a
+// maximum size, like Apache httpd's rotatelogs
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/strftime"
+)
+
+// Writer writes to files named after a strftime pattern, like Apache httpd's rotatelogs
+// (eg. 'access_log.%Y%m%d'), rotating them by time, by size or both. A file that is full, or
+// whose name has already been used by a compressed file, is continued by a numbered one (eg.
+// 'access_log.20190102.1' and then 'access_log.20190102.2'). Closed files can be compressed with
+// gzip and only the newest ones kept, both in the background
+type Writer struct {
+	mu        sync.Mutex
+	pattern   string
+	glob      string         // Matching the names of all the files and more, see strftime.Glob
+	names     *regexp.Regexp // Matching exactly the names of all the files, numbered and compressed too
+	maxSize   int64
+	interval  time.Duration
+	compress  bool
+	maxFiles  int
+	pruning   bool // Whether the closed files beyond maxFiles are removed
+	now       func() time.Time
+	file      *os.File
+	fileName  string
+	name      string // File name of the current period, ie. with no number
+	index     int    // Number of the current file in the period
+	size      int64
+	periodEnd time.Time      // End of the period of the current file, zero without time rotation
+	cleanupMu sync.Mutex     // Closed files are compressed and pruned one rotation at a time
+	wg        sync.WaitGroup // Background compressions and prunings
+	log       *log.Logger
+}
+
+// Option configures an optional setting of the writer
+type Option func(*Writer)
+
+// WithMaxSize rotates the file when the next write would exceed the given size in bytes
+func WithMaxSize(size int64) Option {
+	return func(w *Writer) {
+		w.maxSize = size
+	}
+}
+
+// WithInterval rotates the file at every multiple of the interval (eg. 24h rotates at midnight
+// UTC). The name of each file is formatted with the start of its period
+func WithInterval(interval time.Duration) Option {
+	return func(w *Writer) {
+		w.interval = interval
+	}
+}
+
+// WithCompression compresses the closed files with gzip, adding the '.gz' extension
+func WithCompression() Option {
+	return func(w *Writer) {
+		w.compress = true
+	}
+}
+
+// WithMaxFiles keeps only the newest n closed files, by modification time, besides the current
+// one. Files are matched by the pattern, so they include the ones written by previous runs.
+// By default all the closed files are kept
+func WithMaxFiles(n int) Option {
+	return func(w *Writer) {
+		w.maxFiles = n
+		w.pruning = true
+	}
+}
+
+// New returns a writer appending to fileName, which is created if it doesn't exist. The file is
+// rotated when the next write would exceed maxSize and only the newest maxBackups rotated files
+// are kept (see NewPattern, the file name is not a pattern though).
+// Returns an error if maxSize is not positive, maxBackups is negative or the file cannot be opened
+func New(fileName string, maxSize int64, maxBackups int) (*Writer, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid max size %d, must be positive", maxSize)
+	}
+	pattern := strings.Replace(fileName, "%", "%%", -1)
+	return NewPattern(pattern, WithMaxSize(maxSize), WithMaxFiles(maxBackups))
+}
+
+// NewPattern returns a writer to the files named after the strftime pattern, formatted with the
+// current time. Returns an error if the pattern or any option is invalid, or the file cannot be
+// opened. Without options the file is never rotated
+func NewPattern(pattern string, opts ...Option) (*Writer, error) {
+	return newPattern(pattern, time.Now, opts...)
+}
+
+// newPattern returns a writer with the given clock
+func newPattern(pattern string, now func() time.Time, opts ...Option) (*Writer, error) {
+	glob, err := strftime.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file name pattern: %v", err)
+	}
+	r, err := strftime.Regexp(filepath.Clean(pattern)) // Like the file names listed by filepath.Glob
+	if err != nil {
+		return nil, fmt.Errorf("invalid file name pattern: %v", err)
+	}
+	w := &Writer{
+		pattern: pattern,
+		glob:    glob,
+		names:   regexp.MustCompile(`^` + r + `(?:\.\d+)?(?:\.gz)?$`),
+		now:     now,
+		log:     log.New(os.Stderr, "", log.LstdFlags),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.maxSize < 0 {
+		return nil, fmt.Errorf("invalid max size %d, cannot be negative", w.maxSize)
+	}
+	if w.interval < 0 {
+		return nil, fmt.Errorf("invalid interval %s, cannot be negative", w.interval)
+	}
+	if w.pruning && w.maxFiles < 0 {
+		return nil, fmt.Errorf("invalid max files %d, cannot be negative", w.maxFiles)
+	}
+
+	if err := w.open(w.now(), true); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes p to the current file, rotating it first if its period is over or p doesn't fit
+// in the remaining space. Writes longer than the maximum size are written to a file of their own
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, fmt.Errorf("write on closed file %s", w.fileName)
+	}
+	now := w.now()
+	expired := w.interval > 0 && !now.Before(w.periodEnd)
+	full := w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize
+	if expired || full {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file and waits for the background compressions and prunings
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	return err
+}
+
+// open opens the file of the period including t for appending. The last file of the period is
+// continued only when resuming (ie. on start) and if it has room left, otherwise a new numbered one
+// is started
+func (w *Writer) open(t time.Time, resume bool) error {
+	start := t
+	if w.interval > 0 {
+		start = t.Truncate(w.interval)
+		w.periodEnd = start.Add(w.interval)
+	}
+	name, err := strftime.Format(w.pattern, start)
+	if err != nil {
+		return fmt.Errorf("invalid file name pattern: %v", err)
+	}
+
+	// Older files of the period may have been pruned already
+	last, err := lastIndex(name)
+	if err != nil {
+		return err
+	}
+	if !resume && name == w.name && w.index > last {
+		last = w.index
+	}
+	index := last + 1
+	if last >= 0 && resume && w.hasRoom(numberedName(name, last)) {
+		index = last
+	}
+	fileName := numberedName(name, index)
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot stat file: %v", err)
+	}
+	w.file, w.fileName, w.name, w.index, w.size = f, fileName, name, index, info.Size()
+	return nil
+}
+
+// hasRoom tells whether the file can be appended to, ie. it hasn't been compressed and it isn't full
+func (w *Writer) hasRoom(fileName string) bool {
+	if exists(fileName + ".gz") {
+		return false
+	}
+	if w.maxSize == 0 {
+		return true
+	}
+	info, err := os.Stat(fileName)
+	return err != nil || info.Size() < w.maxSize
+}
+
+// rotate closes the current file and opens the next one, then compresses and prunes the closed
+// files in the background. The file is reopened even if it cannot be closed, so writing can go on
+func (w *Writer) rotate(t time.Time) error {
+	closeErr := w.file.Close()
+	closed := w.fileName
+	w.file = nil
+	if err := w.open(t, false); err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("cannot close file: %v", closeErr)
+	}
+
+	if !w.compress && !w.pruning {
+		return nil
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.cleanupMu.Lock()
+		defer w.cleanupMu.Unlock()
+		w.mu.Lock()
+		current := w.fileName // Newer than the one at the time of the rotation, if rotated again
+		w.mu.Unlock()
+		if w.compress {
+			if err := compressFile(closed); err != nil {
+				w.log.Println("[ERROR]", err)
+			}
+		}
+		if w.pruning {
+			if err := w.prune(current); err != nil {
+				w.log.Println("[ERROR]", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// prune removes the oldest files named after the pattern, keeping the current one and the newest
+// maxFiles others. Other files sharing the prefix of their names (eg. 'access_log.bak' for the
+// 'access_log' pattern) are never removed
+func (w *Writer) prune(current string) error {
+	matches, err := filepath.Glob(w.glob + "*")
+	if err != nil {
+		return fmt.Errorf("cannot list files: %v", err)
+	}
+
+	type file struct {
+		name    string
+		modTime time.Time
+	}
+	var files []file
+	current = filepath.Clean(current) // Like the file names listed by filepath.Glob
+	for _, m := range matches {
+		if m == current || !w.names.MatchString(m) { // Not even the temporary compressed files
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, file{name: m, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].name > files[j].name
+	})
+
+	for i := w.maxFiles; i < len(files); i++ {
+		if err := os.Remove(files[i].name); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove file: %v", err)
+		}
+	}
+	return nil
+}
+
+// compressFile replaces the file with its gzip compressed version, adding the '.gz' extension
+func compressFile(fileName string) error {
+	src, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	defer src.Close()
+	dst, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	defer os.Remove(dst.Name()) // No-op once renamed
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	if err := os.Chmod(dst.Name(), 0644); err != nil {
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	if err := os.Rename(dst.Name(), fileName+".gz"); err != nil {
+		return fmt.Errorf("cannot compress file: %v", err)
+	}
+	return os.Remove(fileName)
+}
+
+// numberedName returns the name of the i-th file of a period, the first one having no number
+func numberedName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, i)
+}
+
+// lastIndex returns the highest number of the existing files of a period, either compressed or
+// not, or -1 if there's none
+func lastIndex(name string) (int, error) {
+	infos, err := ioutil.ReadDir(filepath.Dir(name))
+	if err != nil {
+		return 0, fmt.Errorf("cannot list files: %v", err)
+	}
+	last := -1
+	base := filepath.Base(name)
+	for _, info := range infos {
+		suffix := strings.TrimSuffix(info.Name(), ".gz")
+		if !strings.HasPrefix(suffix, base) {
+			continue
+		}
+		suffix = strings.TrimPrefix(suffix, base)
+		if suffix == "" {
+			if last < 0 {
+				last = 0
+			}
+			continue
+		}
+		if !strings.HasPrefix(suffix, ".") {
+			continue
+		}
+		if i, err := strconv.Atoi(suffix[1:]); err == nil && i > last {
+			last = i
+		}
+	}
+	return last, nil
+}
+
+// exists tells whether the file exists
+func exists(fileName string) bool {
+	_, err := os.Stat(fileName)
+	return err == nil
+}
@@ -0,0 +1,326 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "rotate-test-")
+	assert.NoError(t, err)
+	return dir
+}
+
+func readFile(t *testing.T, fileName string) string {
+	b, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+// testClock is a clock moved forward by the tests
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+// newTestPattern returns a writer whose clock is controlled by the test
+func newTestPattern(t *testing.T, pattern string, c *testClock, opts ...Option) *Writer {
+	w, err := newPattern(pattern, c.now, opts...)
+	assert.NoError(t, err)
+	return w
+}
+
+func writeLines(t *testing.T, w *Writer, lines ...string) {
+	for _, l := range lines {
+		n, err := w.Write([]byte(l))
+		assert.NoError(t, err)
+		assert.Equal(t, len(l), n)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readGzipFile(t *testing.T, fileName string) string {
+	f, err := os.Open(fileName)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestNew(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+
+	w, err := New(filepath.Join(dir, "test.log"), 10, 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, w)
+	assert.NoError(t, w.Close())
+	assert.FileExists(t, filepath.Join(dir, "test.log"))
+}
+
+func TestNew_Err(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		fileName   string
+		maxSize    int64
+		maxBackups int
+	}{
+		{filepath.Join(dir, "test.log"), 0, 1},
+		{filepath.Join(dir, "test.log"), -1, 1},
+		{filepath.Join(dir, "test.log"), 10, -1},
+		{filepath.Join(dir, "missing", "test.log"), 10, 1},
+	}
+
+	for _, tt := range testCases {
+		w, err := New(tt.fileName, tt.maxSize, tt.maxBackups)
+		assert.Error(t, err)
+		assert.Nil(t, w)
+	}
+}
+
+func TestWriter_Write(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+
+	w, err := New(fileName, 10, 2)
+	assert.NoError(t, err)
+	writeLines(t, w, "aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"test.log.1", "test.log.2", "test.log.3"}, listDir(t, dir))
+	assert.Equal(t, "cccc\ndddd\n", readFile(t, fileName+".1"))
+	assert.Equal(t, "eeee\nffff\n", readFile(t, fileName+".2"))
+	assert.Equal(t, "gggg\n", readFile(t, fileName+".3"))
+}
+
+func TestWriter_WriteAppendsToExistingFile(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("aaaa\n"), 0644))
+
+	w, err := New(fileName, 10, 1)
+	assert.NoError(t, err)
+	writeLines(t, w, "bbbb\n", "cccc\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "aaaa\nbbbb\n", readFile(t, fileName))
+	assert.Equal(t, "cccc\n", readFile(t, fileName+".1"))
+}
+
+func TestWriter_WriteLongerThanMaxSize(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+
+	w, err := New(fileName, 4, 1)
+	assert.NoError(t, err)
+	writeLines(t, w, "aaaaaaaa\n", "b\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "aaaaaaaa\n", readFile(t, fileName))
+	assert.Equal(t, "b\n", readFile(t, fileName+".1"))
+}
+
+func TestWriter_WriteWithoutBackups(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "test.log")
+
+	w, err := New(fileName, 5, 0)
+	assert.NoError(t, err)
+	writeLines(t, w, "aaaa\n", "bbbb\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"test.log.1"}, listDir(t, dir))
+	assert.Equal(t, "bbbb\n", readFile(t, fileName+".1"))
+}
+
+func TestWriter_WriteAfterClose(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+
+	w, err := New(filepath.Join(dir, "test.log"), 10, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	n, err := w.Write([]byte("aaaa\n"))
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestNewPattern(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+
+	w, err := NewPattern(filepath.Join(dir, "access_log.%Y"), WithMaxSize(10), WithInterval(time.Hour),
+		WithCompression(), WithMaxFiles(3))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), w.maxSize)
+	assert.Equal(t, time.Hour, w.interval)
+	assert.True(t, w.compress)
+	assert.Equal(t, 3, w.maxFiles)
+	assert.Equal(t, filepath.Join(dir, "access_log.*"), w.glob)
+	assert.NoError(t, w.Close())
+	assert.FileExists(t, filepath.Join(dir, "access_log."+time.Now().Format("2006")))
+}
+
+func TestNewPattern_Err(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		pattern string
+		opts    []Option
+	}{
+		{filepath.Join(dir, "access_log.%Q"), nil},
+		{filepath.Join(dir, "access_log"), []Option{WithMaxSize(-1)}},
+		{filepath.Join(dir, "access_log"), []Option{WithInterval(-time.Second)}},
+		{filepath.Join(dir, "access_log"), []Option{WithMaxFiles(-1)}},
+		{filepath.Join(dir, "missing", "access_log"), nil},
+	}
+
+	for _, tt := range testCases {
+		w, err := NewPattern(tt.pattern, tt.opts...)
+		assert.Error(t, err, tt.pattern)
+		assert.Nil(t, w)
+	}
+}
+
+func TestWriter_WriteInterval(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	c := &testClock{t: time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)}
+
+	w := newTestPattern(t, filepath.Join(dir, "access_log.%Y%m%d%H"), c, WithInterval(time.Hour))
+	writeLines(t, w, "a\n", "b\n")
+	c.t = c.t.Add(29 * time.Minute)
+	writeLines(t, w, "c\n")
+	c.t = c.t.Add(time.Minute) // 11:00
+	writeLines(t, w, "d\n")
+	c.t = c.t.Add(3 * time.Hour)
+	writeLines(t, w, "e\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"access_log.2019010210", "access_log.2019010211", "access_log.2019010214"}, listDir(t, dir))
+	assert.Equal(t, "a\nb\nc\n", readFile(t, filepath.Join(dir, "access_log.2019010210")))
+	assert.Equal(t, "d\n", readFile(t, filepath.Join(dir, "access_log.2019010211")))
+	assert.Equal(t, "e\n", readFile(t, filepath.Join(dir, "access_log.2019010214")))
+}
+
+func TestWriter_WriteMaxSize(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access_log")
+	c := &testClock{t: time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)}
+
+	w := newTestPattern(t, fileName, c, WithMaxSize(10))
+	writeLines(t, w, "aaaa\n", "bbbb\n", "cccc\n", "dddddddddddd\n", "e\n")
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "aaaa\nbbbb\n", readFile(t, fileName))
+	assert.Equal(t, "cccc\n", readFile(t, fileName+".1"))
+	assert.Equal(t, "dddddddddddd\n", readFile(t, fileName+".2"))
+	assert.Equal(t, "e\n", readFile(t, fileName+".3"))
+
+	// Appends to the last file, if it has room left, when reopened
+	w = newTestPattern(t, fileName, c, WithMaxSize(10))
+	writeLines(t, w, "f\n", "gggggg\n")
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "e\nf\n", readFile(t, fileName+".3"))
+	assert.Equal(t, "gggggg\n", readFile(t, fileName+".4"))
+}
+
+func TestWriter_WriteCompression(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	c := &testClock{t: time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)}
+
+	w := newTestPattern(t, filepath.Join(dir, "access_log.%Y%m%d"), c, WithInterval(24*time.Hour), WithCompression())
+	writeLines(t, w, "a\n")
+	c.t = c.t.Add(24 * time.Hour)
+	writeLines(t, w, "b\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"access_log.20190102.gz", "access_log.20190103"}, listDir(t, dir))
+	assert.Equal(t, "a\n", readGzipFile(t, filepath.Join(dir, "access_log.20190102.gz")))
+	assert.Equal(t, "b\n", readFile(t, filepath.Join(dir, "access_log.20190103")))
+
+	// A compressed file is not appended to, but continued by a numbered one
+	c.t = c.t.Add(-24 * time.Hour)
+	w = newTestPattern(t, filepath.Join(dir, "access_log.%Y%m%d"), c, WithInterval(24*time.Hour), WithCompression())
+	writeLines(t, w, "c\n")
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "c\n", readFile(t, filepath.Join(dir, "access_log.20190102.1")))
+}
+
+func TestWriter_WriteMaxFiles(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	c := &testClock{t: time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)}
+	// Not written by the writer, even if in the same directory or sharing the prefix of the names
+	for _, name := range []string{"error_log", "access_log.state", "access_log.20190101.bak", "access_log.2019010"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name), c.t.Add(-time.Hour), c.t.Add(-time.Hour)))
+	}
+
+	w := newTestPattern(t, filepath.Join(dir, "access_log.%Y%m%d"), c, WithInterval(24*time.Hour), WithMaxFiles(2))
+	for _, l := range []string{"a\n", "b\n", "c\n", "d\n", "e\n"} {
+		writeLines(t, w, l)
+		// Modification times telling the files apart
+		assert.NoError(t, os.Chtimes(w.fileName, c.t, c.t))
+		c.t = c.t.Add(24 * time.Hour)
+	}
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"access_log.2019010", "access_log.20190101.bak", "access_log.20190104", "access_log.20190105",
+		"access_log.20190106", "access_log.state", "error_log"}, listDir(t, dir))
+}
+
+func TestWriter_WriteMaxFilesNumbered(t *testing.T) {
+	dir := getTestDir(t)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access_log")
+	c := &testClock{t: time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)}
+
+	// Numbering goes on after the first files of the period have been pruned
+	w := newTestPattern(t, fileName, c, WithMaxSize(2), WithMaxFiles(1))
+	for _, l := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		writeLines(t, w, l)
+		assert.NoError(t, os.Chtimes(w.fileName, c.t, c.t))
+		c.t = c.t.Add(time.Minute)
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []string{"access_log.2", "access_log.3"}, listDir(t, dir))
+
+	w = newTestPattern(t, fileName, c, WithMaxSize(2))
+	writeLines(t, w, "e\n")
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "e\n", readFile(t, fileName+".4"))
+}
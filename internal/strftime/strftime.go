@@ -0,0 +1,138 @@
+// Package strftime converts C strftime(3) formats, as used by Apache httpd, into Go time layouts
+package strftime
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// conversion is the equivalent of a strftime conversion specification
+type conversion struct {
+	layout string // Go time layout
+	regexp string // Regular expression matching the formatted values
+}
+
+// conversions maps every supported strftime conversion specification to its equivalent
+var conversions = map[byte]conversion{
+	'a': {"Mon", `[A-Z][a-z]{2}`},
+	'A': {"Monday", `[A-Z][a-z]+`},
+	'b': {"Jan", `[A-Z][a-z]{2}`},
+	'B': {"January", `[A-Z][a-z]+`},
+	'd': {"02", `\d{2}`},
+	'D': {"01/02/06", `\d{2}/\d{2}/\d{2}`},
+	'e': {"_2", `[ \d]\d`},
+	'F': {"2006-01-02", `\d{4}-\d{2}-\d{2}`},
+	'h': {"Jan", `[A-Z][a-z]{2}`},
+	'H': {"15", `\d{2}`},
+	'I': {"03", `\d{2}`},
+	'j': {"002", `\d{3}`},
+	'm': {"01", `\d{2}`},
+	'M': {"04", `\d{2}`},
+	'p': {"PM", `[AP]M`},
+	'R': {"15:04", `\d{2}:\d{2}`},
+	'S': {"05", `\d{2}`},
+	'T': {"15:04:05", `\d{2}:\d{2}:\d{2}`},
+	'y': {"06", `\d{2}`},
+	'Y': {"2006", `\d{4}`},
+	'z': {"-0700", `[+-]\d{4}`},
+	'Z': {"MST", `[A-Za-z0-9+-]+`}, // Abbreviation or offset, if the zone has no abbreviation
+	'%': {"%", `%`},
+}
+
+// layoutCheckTime is formatted differently by every element of the Go time layouts (eg. it's not a
+// Monday in the afternoon), so that literals turned into layout elements can be detected
+var layoutCheckTime = time.Date(2021, 11, 23, 9, 47, 38, 123456789, time.FixedZone("XYZ", 9*3600+30*60))
+
+// Layout returns the Go time layout equivalent to the given strftime format.
+// Returns an error if the format contains an unsupported conversion specification, or characters
+// outside of the conversion specifications that are Go layout elements (eg. '1', 'Mon' or 'PM')
+func Layout(format string) (string, error) {
+	var b strings.Builder
+	err := walk(format, func(literal byte) {
+		b.WriteByte(literal)
+	}, func(c conversion) {
+		b.WriteString(c.layout)
+	})
+	if err != nil {
+		return "", err
+	}
+	layout := b.String()
+	if s, _ := Format(format, layoutCheckTime); layoutCheckTime.Format(layout) != s {
+		return "", fmt.Errorf("unsupported characters in %q, they are Go time layout elements", format)
+	}
+	return layout, nil
+}
+
+// Format formats the time according to the given strftime format. Unlike formatting with the
+// Layout, characters outside of the conversion specifications are always copied as they are (eg.
+// the digits of a file name).
+// Returns an error if the format contains an unsupported conversion specification
+func Format(format string, t time.Time) (string, error) {
+	var b strings.Builder
+	err := walk(format, func(literal byte) {
+		b.WriteByte(literal)
+	}, func(c conversion) {
+		b.WriteString(t.Format(c.layout))
+	})
+	return b.String(), err
+}
+
+// Glob returns the glob pattern (see filepath.Match) matching all the strings formatted with the
+// given strftime format, where every conversion specification matches any sequence of characters.
+// Returns an error if the format contains an unsupported conversion specification
+func Glob(format string) (string, error) {
+	var b strings.Builder
+	star := false // Consecutive conversions match with a single wildcard
+	err := walk(format, func(literal byte) {
+		if strings.IndexByte(`*?[\`, literal) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(literal)
+		star = false
+	}, func(c conversion) {
+		if c.layout == "%" {
+			b.WriteByte('%')
+			star = false
+		} else if !star {
+			b.WriteByte('*')
+			star = true
+		}
+	})
+	return b.String(), err
+}
+
+// Regexp returns the regular expression matching all the strings formatted with the given strftime
+// format, with no anchors.
+// Returns an error if the format contains an unsupported conversion specification
+func Regexp(format string) (string, error) {
+	var b strings.Builder
+	err := walk(format, func(literal byte) {
+		b.WriteString(regexp.QuoteMeta(string(literal)))
+	}, func(c conversion) {
+		b.WriteString(c.regexp)
+	})
+	return b.String(), err
+}
+
+// walk calls literal for every character outside of the conversion specifications of the format
+// and conv with the equivalent of every conversion specification, in order
+func walk(format string, literal func(byte), conv func(conversion)) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			return fmt.Errorf("incomplete conversion specification at the end of %q", format)
+		}
+		i++
+		c, ok := conversions[format[i]]
+		if !ok {
+			return fmt.Errorf("unsupported conversion specification %%%c in %q", format[i], format)
+		}
+		conv(c)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package strftime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayout(t *testing.T) {
+	testCases := []struct {
+		format    string
+		expLayout string
+		shouldErr bool
+	}{
+		{"%d/%b/%Y:%H:%M:%S %z", "02/Jan/2006:15:04:05 -0700", false},
+		{"%Y-%m-%dT%T", "2006-01-02T15:04:05", false},
+		{"%F %R", "2006-01-02 15:04", false},
+		{"access.%Y%m%d.log", "access.20060102.log", false},
+		{"%H%%", "15%", false},
+		{"", "", false},
+		{"%Y-%m-%", "", true},
+		{"%Q", "", true},
+		// Literals that are Go layout elements
+		{"%Y-%m-%d 1", "", true},
+		{"100%%", "", true},
+		{"Mon %H:%M", "", true},
+		{"%I:%M PM", "", true},
+		{"%T MST", "", true},
+		{"%T.000", "", true},
+	}
+
+	for _, tt := range testCases {
+		layout, err := Layout(tt.format)
+		assert.Equal(t, tt.shouldErr, err != nil)
+		assert.Equal(t, tt.expLayout, layout)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		format    string
+		exp       string
+		shouldErr bool
+	}{
+		{"/var/log/httpd2/access_log.%Y%m%d", "/var/log/httpd2/access_log.20190102", false},
+		{"access.%F-%H%M%S.log", "access.2019-01-02-150405.log", false},
+		{"Jan_15.%%.%d", "Jan_15.%.02", false},
+		{"access.log", "access.log", false},
+		{"access.%Q", "", true},
+	}
+
+	for _, tt := range testCases {
+		s, err := Format(tt.format, tm)
+		assert.Equal(t, tt.shouldErr, err != nil)
+		if !tt.shouldErr {
+			assert.Equal(t, tt.exp, s)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	testCases := []struct {
+		format    string
+		exp       string
+		shouldErr bool
+	}{
+		{"/var/log/access_log.%Y%m%d", "/var/log/access_log.*", false},
+		{"access.%F-%H.log", "access.*-*.log", false},
+		{"[x]*.%%.%d", `\[x]\*.%.*`, false},
+		{"access.%", "", true},
+	}
+
+	for _, tt := range testCases {
+		g, err := Glob(tt.format)
+		assert.Equal(t, tt.shouldErr, err != nil)
+		if !tt.shouldErr {
+			assert.Equal(t, tt.exp, g)
+		}
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		format    string
+		exp       string
+		shouldErr bool
+	}{
+		{"/var/log/access_log.%Y%m%d", `/var/log/access_log\.\d{4}\d{2}\d{2}`, false},
+		{"access.%F-%H.log", `access\.\d{4}-\d{2}-\d{2}-\d{2}\.log`, false},
+		{"[x]*.%%.%b", `\[x\]\*\.%\.[A-Z][a-z]{2}`, false},
+		{"access.%", "", true},
+	}
+
+	for _, tt := range testCases {
+		r, err := Regexp(tt.format)
+		assert.Equal(t, tt.shouldErr, err != nil)
+		if tt.shouldErr {
+			continue
+		}
+		assert.Equal(t, tt.exp, r)
+		// Matching the formatted time
+		s, err := Format(tt.format, tm)
+		assert.NoError(t, err)
+		assert.Regexp(t, "^"+r+"$", s)
+	}
+
+	// Every conversion matches the values it formats
+	for spec := range conversions {
+		r, err := Regexp("%" + string(spec))
+		assert.NoError(t, err)
+		for _, tm := range []time.Time{tm, time.Date(2020, 12, 31, 1, 0, 0, 0, time.FixedZone("", 3600))} {
+			s, err := Format("%"+string(spec), tm)
+			assert.NoError(t, err)
+			assert.Regexp(t, "^"+r+"$", s, string(spec))
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package tailer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic bytes at the start of the compressed files
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Open opens the file for reading, transparently decompressing it if it's compressed with gzip,
+// bzip2 or zstd. The compression is detected by the magic bytes, not by the file extension
+func Open(fileName string) (io.ReadCloser, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, fmt.Errorf("cannot read %s: %v", fileName, err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid gzip file %s: %v", fileName, err)
+		}
+		return &readCloser{Reader: gz, closers: []io.Closer{gz, f}}, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return &readCloser{Reader: bzip2.NewReader(r), closers: []io.Closer{f}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid zstd file %s: %v", fileName, err)
+		}
+		zrc := zr.IOReadCloser()
+		return &readCloser{Reader: zrc, closers: []io.Closer{zrc, f}}, nil
+	}
+	return &readCloser{Reader: r, closers: []io.Closer{f}}, nil
+}
+
+// isCompressed tells whether the file is compressed with gzip, bzip2 or zstd, detected by the
+// magic bytes as by Open
+func isCompressed(fileName string) (bool, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, fmt.Errorf("cannot read %s: %v", fileName, err)
+	}
+	magic = magic[:n]
+	return bytes.HasPrefix(magic, gzipMagic) || bytes.HasPrefix(magic, bzip2Magic) || bytes.HasPrefix(magic, zstdMagic), nil
+}
+
+// openAt opens the file for reading from the offset, decompressing it if needed (see Open). Only
+// uncompressed files can be opened at an offset
+func openAt(fileName string, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return Open(fileName)
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read %s: %v", fileName, err)
+	}
+	return f, nil
+}
+
+// readCloser is a reader closing both the decompressor, if any, and the file
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rotatedRegexp matches the suffix of the rotated log files as named by logrotate, either numbered
+// (eg. access.log.1) or dated with dateext (eg. access.log-20190102), possibly compressed
+var rotatedRegexp = regexp.MustCompile(`^(?:\.(\d+)|-(\d{8,}))(?:\.(?:gz|bz2|zst))?$`)
+
+// RotatedFiles returns the rotated versions of the log file in the same directory, in
+// chronological order, ie. the oldest first (eg. access.log.3.gz, access.log.2.gz, access.log.1).
+// Dated files come before the numbered ones
+func RotatedFiles(fileName string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Dir(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list rotated files: %v", err)
+	}
+
+	type rotated struct {
+		name  string
+		date  string
+		index int
+	}
+	var files []rotated
+	base := filepath.Base(fileName)
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasPrefix(info.Name(), base) {
+			continue
+		}
+		m := rotatedRegexp.FindStringSubmatch(strings.TrimPrefix(info.Name(), base))
+		if m == nil {
+			continue
+		}
+		r := rotated{name: filepath.Join(filepath.Dir(fileName), info.Name()), date: m[2]}
+		if m[1] != "" {
+			if r.index, err = strconv.Atoi(m[1]); err != nil {
+				continue
+			}
+		}
+		files = append(files, r)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if (a.date != "") != (b.date != "") {
+			return a.date != ""
+		}
+		if a.date != b.date {
+			return a.date < b.date
+		}
+		if a.index != b.index {
+			return a.index > b.index
+		}
+		return a.name < b.name
+	})
+	names := make([]string, 0, len(files))
+	for _, r := range files {
+		names = append(names, r.name)
+	}
+	return names, nil
+}
+
+// resumeBackfill skips the rotated files read before the checkpoint, if the checkpointed file is
+// one of them (ie. the file has been rotated since the checkpoint). That file is then read from the
+// checkpoint offset. Compressed files cannot match, since compressing a file creates a new one
+func (t *Tailer) resumeBackfill(c *checkpoint) error {
+	for i, fileName := range t.backfillFiles {
+		f, err := os.Open(fileName)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			continue
+		}
+		id := getFileID(info)
+		// Files have no identity on some platforms
+		if id == (fileID{}) || c.Device != id.device || c.Inode != id.inode || c.Offset > info.Size() {
+			f.Close()
+			continue
+		}
+		offset, err := lineStart(f, c.Offset)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		t.backfillFiles, t.backfillOffset = t.backfillFiles[i:], offset
+		return nil
+	}
+	return nil
+}
+
+// backfill sends the lines of the rotated files to out, oldest first, and then the ones of the
+// live file read from in. Reading the rotated files is interrupted when the tailer is stopped
+func (t *Tailer) backfill(in <-chan *tail.Line, out chan<- *tail.Line) {
+	defer close(out)
+	for i, fileName := range t.backfillFiles {
+		if t.stopped() {
+			break
+		}
+		var offset int64
+		if i == 0 {
+			offset = t.backfillOffset
+		}
+		if err := t.readFile(fileName, offset, out); err != nil {
+			t.log.Println("[ERROR] cannot backfill:", err)
+		}
+	}
+	for l := range in {
+		out <- l
+	}
+}
+
+// readFile sends the lines of the file from the offset, decompressed if needed, to out
+func (t *Tailer) readFile(fileName string, offset int64, out chan<- *tail.Line) error {
+	f, err := openAt(fileName, offset)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		text, err := r.ReadString('\n')
+		if text != "" {
+			// Checked first, since select doesn't prefer quitting when the line can be sent too
+			if t.stopped() {
+				return nil
+			}
+			select {
+			case out <- &tail.Line{Text: strings.TrimRight(text, "\n"), Time: time.Now()}:
+			case <-t.quitChan:
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", fileName, err)
+		}
+	}
+}
+
+// stopped tells whether the tailer has been stopped
+func (t *Tailer) stopped() bool {
+	select {
+	case <-t.quitChan:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,273 @@
+package tailer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hpcloud/tail"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// bzip2Lines is "bz 0\nbz 1\n" compressed with bzip2, since the standard library has no encoder
+var bzip2Lines = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xd8, 0x48, 0xf7, 0x41, 0x00, 0x00,
+	0x03, 0x59, 0x80, 0x00, 0x10, 0x40, 0x00, 0x60, 0x00, 0x10, 0x00, 0x00, 0x10, 0x20, 0x00, 0x30,
+	0xc0, 0x04, 0xa6, 0x98, 0x37, 0x48, 0x42, 0x98, 0x5d, 0xc9, 0x14, 0xe1, 0x42, 0x43, 0x61, 0x23,
+	0xdd, 0x04,
+}
+
+func gzipLines(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(s))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdLines(t *testing.T, s string) []byte {
+	w, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	defer w.Close()
+	return w.EncodeAll([]byte(s), nil)
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Extensions don't matter
+	testCases := []struct {
+		name    string
+		content []byte
+		exp     string
+	}{
+		{"plain.log", []byte("pl 0\npl 1\n"), "pl 0\npl 1\n"},
+		{"empty.log", nil, ""},
+		{"gzip.log", gzipLines(t, "gz 0\ngz 1\n"), "gz 0\ngz 1\n"},
+		{"bzip2.log", bzip2Lines, "bz 0\nbz 1\n"},
+		{"zstd.log", zstdLines(t, "zs 0\nzs 1\n"), "zs 0\nzs 1\n"},
+	}
+
+	for _, tt := range testCases {
+		fileName := filepath.Join(dir, tt.name)
+		assert.NoError(t, ioutil.WriteFile(fileName, tt.content, 0644))
+		r, err := Open(fileName)
+		if assert.NoError(t, err, tt.name) {
+			b, err := ioutil.ReadAll(r)
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, tt.exp, string(b), tt.name)
+			assert.NoError(t, r.Close())
+		}
+	}
+}
+
+func TestOpen_Err(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r, err := Open(filepath.Join(dir, "nope.log"))
+	assert.Error(t, err)
+	assert.Nil(t, r)
+
+	// Truncated gzip header
+	fileName := filepath.Join(dir, "bad.gz")
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte{0x1f, 0x8b, 0x08}, 0644))
+	r, err = Open(fileName)
+	assert.Error(t, err)
+	assert.Nil(t, r)
+}
+
+func TestRotatedFiles(t *testing.T) {
+	testCases := []struct {
+		files []string
+		exp   []string
+	}{
+		{nil, []string{}},
+		{
+			[]string{"access.log.1", "access.log.2.gz", "access.log.10.zst", "access.log.3.bz2"},
+			[]string{"access.log.10.zst", "access.log.3.bz2", "access.log.2.gz", "access.log.1"},
+		},
+		{
+			[]string{"access.log-20190103", "access.log-20190101.gz", "access.log-20190102.gz"},
+			[]string{"access.log-20190101.gz", "access.log-20190102.gz", "access.log-20190103"},
+		},
+		{
+			[]string{"access.log.1", "access.log-20190101.gz"},
+			[]string{"access.log-20190101.gz", "access.log.1"},
+		},
+		// Not rotated versions of access.log
+		{
+			[]string{"access.log.state", "access.log.1.tmp", "access.log-2019", "access.logs.1", "error.log.1"},
+			[]string{},
+		},
+	}
+
+	for _, tt := range testCases {
+		dir, err := ioutil.TempDir("", "tailer")
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "access.log"), nil, 0644))
+		for _, f := range tt.files {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, f), nil, 0644))
+		}
+
+		files, err := RotatedFiles(filepath.Join(dir, "access.log"))
+		assert.NoError(t, err)
+		exp := make([]string, 0, len(tt.exp))
+		for _, f := range tt.exp {
+			exp = append(exp, filepath.Join(dir, f))
+		}
+		assert.Equal(t, exp, files)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRotatedFiles_Err(t *testing.T) {
+	files, err := RotatedFiles(filepath.Join("nope", "access.log"))
+	assert.Error(t, err)
+	assert.Nil(t, files)
+}
+
+func TestTailer_Backfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	assert.NoError(t, ioutil.WriteFile(fileName+".3.gz", gzipLines(t, "Line 0\nLine 1\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName+".2.zst", zstdLines(t, "Line 2\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName+".1", []byte("Line 3\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("Line 4\n"), 0644))
+
+	tailer := New(fileName, WithBackfill())
+	assert.Equal(t, []string{"Line 0", "Line 1", "Line 2", "Line 3", "Line 4"}, readLines(t, tailer, 5))
+	assert.NoError(t, tailer.Stop())
+}
+
+func TestTailer_BackfillStopped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	assert.NoError(t, ioutil.WriteFile(fileName+".1", []byte("Line 0\nLine 1\nLine 2\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName, nil, 0644))
+
+	// Stopping interrupts the backfill
+	tailer := New(fileName, WithBackfill())
+	assert.Equal(t, []string{"Line 0"}, readLines(t, tailer, 1))
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, tailer.Stop())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout stopping the tailer")
+	}
+}
+
+func TestTailer_BackfillStoppedNoLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	assert.NoError(t, ioutil.WriteFile(fileName+".2", []byte("Line 0\nLine 1\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName+".1", []byte("Line 2\n"), 0644))
+
+	// No line is sent once stopped, even if it could be
+	tailer := New(fileName)
+	tailer.backfillFiles = []string{fileName + ".2", fileName + ".1"}
+	close(tailer.quitChan)
+	in := make(chan *tail.Line)
+	close(in)
+	out := make(chan *tail.Line, 10)
+	tailer.backfill(in, out)
+	assert.Len(t, out, 0)
+}
+
+func TestTailer_BackfillCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	stateFile := filepath.Join(dir, "state.json")
+	assert.NoError(t, ioutil.WriteFile(fileName+".1.gz", gzipLines(t, "Line 0\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("Line 1\n"), 0644))
+
+	tailer := New(fileName, WithBackfill(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 0", "Line 1"}, readLines(t, tailer, 2))
+	assert.NoError(t, tailer.Stop())
+
+	// Resuming from the checkpoint skips the backfill
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("Line 2\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	tailer = New(fileName, WithBackfill(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 2"}, readLines(t, tailer, 1))
+	assert.NoError(t, tailer.Stop())
+}
+
+func TestTailer_BackfillCheckpointRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "access.log")
+	stateFile := filepath.Join(dir, "state.json")
+	assert.NoError(t, ioutil.WriteFile(fileName+".1.gz", gzipLines(t, "Line 0\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("Line 1\n"), 0644))
+
+	tailer := New(fileName, WithBackfill(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 0", "Line 1"}, readLines(t, tailer, 2))
+	assert.NoError(t, tailer.Stop())
+
+	// Rotated while not running, the checkpointed file is resumed and the older ones skipped
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("Line 2\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, os.Rename(fileName+".1.gz", fileName+".2.gz"))
+	assert.NoError(t, os.Rename(fileName, fileName+".1"))
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("Line 3\n"), 0644))
+	tailer = New(fileName, WithBackfill(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 2", "Line 3"}, readLines(t, tailer, 2))
+	assert.NoError(t, tailer.Stop())
+}
+
+func TestIsCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		content []byte
+		exp     bool
+	}{
+		{nil, false},
+		{[]byte("a\n"), false},
+		{gzipLines(t, "a\n"), true},
+		{[]byte("BZh91AY&SY"), true},
+		{zstdLines(t, "a\n"), true},
+	}
+
+	for i, tt := range testCases {
+		fileName := filepath.Join(dir, fmt.Sprintf("%d.log", i))
+		assert.NoError(t, ioutil.WriteFile(fileName, tt.content, 0644))
+		compressed, err := isCompressed(fileName)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.exp, compressed, i)
+	}
+	_, err = isCompressed(filepath.Join(dir, "nope.log"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,159 @@
+package tailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lineStartChunk is the size of the chunks read backwards looking for the start of a line
+const lineStartChunk = 4096
+
+// checkpoint is the read position in a tailed file persisted to the state file
+type checkpoint struct {
+	FileName string    `json:"file_name"`
+	Device   uint64    `json:"device"`
+	Inode    uint64    `json:"inode"`
+	Offset   int64     `json:"offset"`
+	Time     time.Time `json:"time"` // Log time of the last line processed, zero if unknown
+}
+
+// stateStore is the state file, holding the checkpoints of one or more tailed files. It's shared by
+// the tailers of a Group, so that they don't overwrite each other's checkpoints
+type stateStore struct {
+	mu          sync.Mutex
+	fileName    string
+	checkpoints map[string]*checkpoint // By tailed file name, nil until loaded
+}
+
+func newStateStore(fileName string) *stateStore {
+	return &stateStore{fileName: fileName}
+}
+
+// get returns the checkpoint of the tailed file, nil if there's none. An invalid state file is
+// reported once and then treated as empty
+func (s *stateStore) get(fileName string) (*checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkpoints == nil {
+		checkpoints, err := loadCheckpoints(s.fileName)
+		s.checkpoints = checkpoints
+		if err != nil {
+			s.checkpoints = make(map[string]*checkpoint)
+			return nil, err
+		}
+	}
+	return s.checkpoints[fileName], nil
+}
+
+// set saves the checkpoint of a tailed file, rewriting the state file with all the checkpoints
+func (s *stateStore) set(c *checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkpoints == nil {
+		s.checkpoints = make(map[string]*checkpoint)
+	}
+	s.checkpoints[c.FileName] = c
+	return saveCheckpoints(s.fileName, s.checkpoints)
+}
+
+// loadCheckpoints reads the checkpoints from the state file, by tailed file name. Returns an empty
+// map if there's no state file. A state file holding a single checkpoint is accepted too
+func loadCheckpoints(stateFile string) (map[string]*checkpoint, error) {
+	checkpoints := make(map[string]*checkpoint)
+	b, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state file: %v", err)
+	}
+
+	var list []*checkpoint
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		list = append(list, &checkpoint{})
+		err = json.Unmarshal(b, list[0])
+	} else {
+		err = json.Unmarshal(b, &list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", stateFile, err)
+	}
+	for _, c := range list {
+		if c != nil {
+			checkpoints[c.FileName] = c
+		}
+	}
+	return checkpoints, nil
+}
+
+// saveCheckpoints writes the checkpoints to the state file, sorted by tailed file name. The file
+// is replaced atomically, so that a crash cannot leave it half written
+func saveCheckpoints(stateFile string, checkpoints map[string]*checkpoint) error {
+	list := make([]*checkpoint, 0, len(checkpoints))
+	for _, c := range checkpoints {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].FileName < list[j].FileName })
+	b, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("cannot encode checkpoints: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(stateFile), filepath.Base(stateFile)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot write state file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write state file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write state file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), stateFile); err != nil {
+		return fmt.Errorf("cannot write state file: %v", err)
+	}
+	return nil
+}
+
+// resumeOffset returns the offset tailing resumes from in the file with the given identity and
+// size. It's the start of the line at the checkpoint offset, or 0 if there's no checkpoint or the
+// file was rotated (ie. it's another file) or truncated since the checkpoint
+func resumeOffset(f *os.File, id fileID, size int64, c *checkpoint) (int64, error) {
+	if c == nil || c.FileName != f.Name() || c.Device != id.device || c.Inode != id.inode || c.Offset > size {
+		return 0, nil
+	}
+	return lineStart(f, c.Offset)
+}
+
+// lineStart returns the offset of the start of the line containing the given offset. The offset of
+// the checkpoints is the one of the tailer's reader, which may not be at a line boundary
+func lineStart(f io.ReaderAt, offset int64) (int64, error) {
+	buf := make([]byte, lineStartChunk)
+	for end := offset; end > 0; {
+		start := end - lineStartChunk
+		if start < 0 {
+			start = 0
+		}
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("cannot read log file: %v", err)
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,337 @@
+package tailer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/fileutils"
+	"github.com/hpcloud/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndLoadCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	checkpoints, err := loadCheckpoints(stateFile)
+	assert.NoError(t, err)
+	assert.Empty(t, checkpoints)
+
+	exp := map[string]*checkpoint{
+		"access.log": {FileName: "access.log", Device: 1, Inode: 2, Offset: 3, Time: time.Unix(4, 0).UTC()},
+		"other.log":  {FileName: "other.log", Device: 1, Inode: 5, Offset: 6, Time: time.Unix(7, 0).UTC()},
+	}
+	assert.NoError(t, saveCheckpoints(stateFile, exp))
+	checkpoints, err = loadCheckpoints(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, checkpoints)
+
+	// No temporary file left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// Single checkpoint state file
+	single := `{"file_name":"access.log","device":1,"inode":2,"offset":3,"time":"1970-01-01T00:00:04Z"}`
+	assert.NoError(t, ioutil.WriteFile(stateFile, []byte(single), 0644))
+	checkpoints, err = loadCheckpoints(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*checkpoint{"access.log": exp["access.log"]}, checkpoints)
+
+	assert.NoError(t, ioutil.WriteFile(stateFile, []byte("{"), 0644))
+	checkpoints, err = loadCheckpoints(stateFile)
+	assert.Error(t, err)
+	assert.Nil(t, checkpoints)
+
+	assert.Error(t, saveCheckpoints(filepath.Join(dir, "nope", "state.json"), exp))
+}
+
+func TestStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	s := newStateStore(stateFile)
+	c, err := s.get("access.log")
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	a := &checkpoint{FileName: "access.log", Offset: 1, Time: time.Unix(1, 0).UTC()}
+	b := &checkpoint{FileName: "other.log", Offset: 2, Time: time.Unix(2, 0).UTC()}
+	assert.NoError(t, s.set(a))
+	assert.NoError(t, s.set(b))
+
+	// Both checkpoints persisted
+	s = newStateStore(stateFile)
+	c, err = s.get("access.log")
+	assert.NoError(t, err)
+	assert.Equal(t, a, c)
+	c, err = s.get("other.log")
+	assert.NoError(t, err)
+	assert.Equal(t, b, c)
+
+	// An invalid state file is reported once
+	assert.NoError(t, ioutil.WriteFile(stateFile, []byte("not json"), 0644))
+	s = newStateStore(stateFile)
+	_, err = s.get("access.log")
+	assert.Error(t, err)
+	c, err = s.get("access.log")
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+}
+
+// loadCheckpoint returns the checkpoint of the tailed file in the state file
+func loadCheckpoint(stateFile, fileName string) (*checkpoint, error) {
+	checkpoints, err := loadCheckpoints(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoints[fileName], nil
+}
+
+func TestLineStart(t *testing.T) {
+	long := strings.Repeat("x", 2*lineStartChunk+10)
+	testCases := []struct {
+		content  string
+		offset   int64
+		expStart int64
+	}{
+		{"", 0, 0},
+		{"a\nb\n", 0, 0},
+		{"a\nb\n", 2, 2},
+		{"a\nb\n", 4, 4},
+		{"a\nbcd\n", 4, 2},
+		{"abc", 2, 0},
+		{"a\n" + long + "\n", int64(len(long)), 2},
+	}
+
+	for _, tt := range testCases {
+		start, err := lineStart(strings.NewReader(tt.content), tt.offset)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expStart, start, tt.content)
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	_, err = f.WriteString("line 0\nline 1\nline 2\n")
+	assert.NoError(t, err)
+	id := fileID{device: 1, inode: 2}
+
+	testCases := []struct {
+		c         *checkpoint
+		expOffset int64
+	}{
+		{nil, 0},
+		{&checkpoint{FileName: f.Name(), Device: 1, Inode: 2, Offset: 14}, 14},
+		// Offset in the middle of a line
+		{&checkpoint{FileName: f.Name(), Device: 1, Inode: 2, Offset: 17}, 14},
+		// Rotated
+		{&checkpoint{FileName: f.Name(), Device: 1, Inode: 3, Offset: 14}, 0},
+		{&checkpoint{FileName: f.Name(), Device: 2, Inode: 2, Offset: 14}, 0},
+		// Truncated
+		{&checkpoint{FileName: f.Name(), Device: 1, Inode: 2, Offset: 22}, 0},
+		// Another file
+		{&checkpoint{FileName: "other.log", Device: 1, Inode: 2, Offset: 14}, 0},
+	}
+
+	for _, tt := range testCases {
+		offset, err := resumeOffset(f, id, 21, tt.c)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expOffset, offset)
+	}
+}
+
+// readLines starts the tailer and reads n lines, failing the test if they don't come in time.
+// The tailer cannot be stopped while a line is waiting to be read
+func readLines(t *testing.T, tailer *Tailer, n int) []string {
+	lines, err := tailer.Start()
+	assert.NoError(t, err)
+
+	var out []string
+	for i := 0; i < n; i++ {
+		select {
+		case l := <-lines:
+			out = append(out, l.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for line %d", i)
+		}
+	}
+	return out
+}
+
+func TestTailer_Checkpoint(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	stateFile := f.Name() + ".state"
+	defer os.Remove(stateFile)
+
+	for i := 0; i < 3; i++ {
+		_, err := f.WriteString(fmt.Sprintf("Line %d\n", i))
+		assert.NoError(t, err)
+	}
+
+	// First run reads the whole file and checkpoints its end when stopped
+	tailer := New(f.Name(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 0", "Line 1", "Line 2"}, readLines(t, tailer, 3))
+	date := time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)
+	tailer.Processed(date)
+	assert.NoError(t, tailer.Stop())
+
+	c, err := loadCheckpoint(stateFile, f.Name())
+	assert.NoError(t, err)
+	if assert.NotNil(t, c) {
+		assert.Equal(t, f.Name(), c.FileName)
+		assert.Equal(t, int64(21), c.Offset)
+		assert.NotZero(t, c.Inode)
+		assert.Equal(t, date, c.Time)
+	}
+
+	// Second run resumes from the checkpoint
+	_, err = f.WriteString("Line 3\n")
+	assert.NoError(t, err)
+	tailer = New(f.Name(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 3"}, readLines(t, tailer, 1))
+	assert.NoError(t, tailer.Stop())
+	c, err = loadCheckpoint(stateFile, f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(28), c.Offset)
+	assert.Equal(t, date, c.Time) // Kept until a line is processed
+
+	// Third run starts from the beginning of the rotated file, created while the old one still
+	// exists so that it cannot reuse its inode
+	rotated := f.Name() + ".new"
+	assert.NoError(t, ioutil.WriteFile(rotated, []byte("Line 4\nLine 5\nLine 6\nLine 7\nLine 8\n"), 0644))
+	assert.NoError(t, os.Rename(rotated, f.Name()))
+	tailer = New(f.Name(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 4", "Line 5", "Line 6", "Line 7", "Line 8"}, readLines(t, tailer, 5))
+	assert.NoError(t, tailer.Stop())
+}
+
+func TestTailer_CheckpointInvalidState(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	stateFile := f.Name() + ".state"
+	defer os.Remove(stateFile)
+
+	_, err = f.WriteString("Line 0\n")
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(stateFile, []byte("not json"), 0644))
+
+	tailer := New(f.Name(), WithCheckpoint(stateFile, time.Hour))
+	assert.Equal(t, []string{"Line 0"}, readLines(t, tailer, 1))
+	assert.NoError(t, tailer.Stop())
+}
+
+// readLinesFrom reads n lines from the channel, failing the test if they don't come in time
+func readLinesFrom(t *testing.T, lines <-chan *tail.Line, n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		select {
+		case l := <-lines:
+			out = append(out, l.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for line %d", i)
+		}
+	}
+	return out
+}
+
+func TestTailer_CheckpointRotated(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	stateFile := f.Name() + ".state"
+	defer os.Remove(stateFile)
+
+	_, err = f.WriteString("Line 0\n")
+	assert.NoError(t, err)
+	tailer := New(f.Name(), WithCheckpoint(stateFile, time.Hour))
+	lines, err := tailer.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Line 0"}, readLinesFrom(t, lines, 1))
+	time.Sleep(100 * time.Millisecond) // Give the tailer some time to watch the file for changes
+	old, err := os.Stat(f.Name())
+	assert.NoError(t, err)
+
+	// Rotated as logrotate does, the new file is followed once its lines are delivered
+	rotated := f.Name() + ".1"
+	assert.NoError(t, os.Rename(f.Name(), rotated))
+	defer os.Remove(rotated)
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte("Line 1\nLine 2\n"), 0644))
+	info, err := os.Stat(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Line 1", "Line 2"}, readLinesFrom(t, lines, 2))
+	assert.NoError(t, tailer.Stop())
+
+	c, err := loadCheckpoint(stateFile, f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(14), c.Offset)
+	assert.Equal(t, getFileID(info).inode, c.Inode)
+	assert.NotEqual(t, getFileID(old).inode, c.Inode)
+}
+
+func TestTailer_CheckpointTruncated(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	stateFile := f.Name() + ".state"
+	defer os.Remove(stateFile)
+
+	_, err = f.WriteString("Line 0\nLine 1\n")
+	assert.NoError(t, err)
+	tailer := New(f.Name(), WithCheckpoint(stateFile, time.Hour))
+	lines, err := tailer.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Line 0", "Line 1"}, readLinesFrom(t, lines, 2))
+	time.Sleep(100 * time.Millisecond) // Give the tailer some time to watch the file for changes
+
+	// Truncated as logrotate's copytruncate does, the file is followed from its beginning
+	assert.NoError(t, f.Truncate(0))
+	_, err = f.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = f.WriteString("Line 2\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Line 2"}, readLinesFrom(t, lines, 1))
+	assert.NoError(t, tailer.Stop())
+
+	c, err := loadCheckpoint(stateFile, f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), c.Offset)
+}
+
+func TestFollowsLine(t *testing.T) {
+	long := strings.Repeat("x", 3*lineStartChunk)
+	testCases := []struct {
+		content string
+		text    string
+		exp     bool
+	}{
+		{"Line 0\nLine 1\n", "Line 0", true},
+		{"Line 0\nLine 1\n", "Line 1", false},
+		{"Line 0", "Line 0", false},
+		{"Line 00\n", "Line 0", false},
+		{"", "Line 0", false},
+		{long + "\n", long, true},
+		{long + "y\n", long, false},
+	}
+
+	for _, tt := range testCases {
+		r := bufio.NewReaderSize(strings.NewReader(tt.content), 16)
+		assert.Equal(t, tt.exp, followsLine(r, tt.text), tt.content)
+	}
+}
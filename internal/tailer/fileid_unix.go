@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package tailer
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file across renames, telling a rotated log file from the original one
+type fileID struct {
+	device uint64
+	inode  uint64
+}
+
+// getFileID returns the device and the inode of the file
+func getFileID(info os.FileInfo) fileID {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+	return fileID{device: uint64(st.Dev), inode: uint64(st.Ino)}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package tailer
+
+import (
+	"os"
+)
+
+// fileID identifies a file across renames, telling a rotated log file from the original one
+type fileID struct {
+	device uint64
+	inode  uint64
+}
+
+// getFileID returns the zero identity, since files have no inode on Windows. Rotations since a
+// checkpoint are then detected only if the new file is smaller than the checkpoint offset
+func getFileID(info os.FileInfo) fileID {
+	return fileID{}
+}
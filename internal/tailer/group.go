@@ -0,0 +1,257 @@
+package tailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// DefaultScanPeriod is how often the glob patterns of a Group are matched again
+const DefaultScanPeriod = 10 * time.Second
+
+// Line is a line read by a Group, along with the name of the file it was read from
+type Line struct {
+	*tail.Line
+	FileName string
+	tailer   *Tailer // Nil if the line wasn't read by a tailer (eg. from a pipe)
+}
+
+// Processed records the log time of the line (eg. its date once parsed) as the one of the last line
+// processed, saved with the checkpoint of its file if any
+func (l *Line) Processed(date time.Time) {
+	if l.tailer != nil {
+		l.tailer.Processed(date)
+	}
+}
+
+// Group tails concurrently the files matching a set of paths and glob patterns, merging their
+// lines. Glob patterns are matched again every scan period, so that the files created afterwards
+// (eg. for a new virtual host) are tailed too
+type Group struct {
+	patterns   []string
+	opts       []Option
+	state      *stateStore // Shared by all the tailers, nil without checkpointing
+	scanPeriod time.Duration
+	mu         sync.Mutex
+	tailers    map[string]*Tailer // By file name
+	lines      chan *Line
+	wg         sync.WaitGroup // Goroutines forwarding the lines of the tailers
+	started    bool
+	quitChan   chan struct{}
+	scanChan   chan struct{} // Closed when the scan loop exits
+	stopChan   chan struct{} // Closed when the group has been stopped
+	log        *log.Logger
+}
+
+// GroupOption configures an optional setting of the group
+type GroupOption func(*Group)
+
+// WithTailers applies the given options to the tailer of every file in the group
+func WithTailers(opts ...Option) GroupOption {
+	return func(g *Group) {
+		g.opts = append(g.opts, opts...)
+	}
+}
+
+// WithScanPeriod sets how often the glob patterns are matched again. Defaults to DefaultScanPeriod
+func WithScanPeriod(period time.Duration) GroupOption {
+	return func(g *Group) {
+		g.scanPeriod = period
+	}
+}
+
+// NewGroup returns a group tailing the files matching the given paths and glob patterns (see
+// filepath.Match). Plain paths must exist when the group is started, glob patterns may match no
+// file yet. Cannot return nil.
+func NewGroup(patterns []string, opts ...GroupOption) *Group {
+	g := &Group{
+		patterns:   patterns,
+		scanPeriod: DefaultScanPeriod,
+		tailers:    make(map[string]*Tailer),
+		lines:      make(chan *Line),
+		quitChan:   make(chan struct{}),
+		scanChan:   make(chan struct{}),
+		stopChan:   make(chan struct{}),
+		log:        log.New(os.Stderr, "", log.LstdFlags),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if t := New("", g.opts...); t.stateFile != "" {
+		g.state = newStateStore(t.stateFile)
+	}
+	return g
+}
+
+// Multiple tells whether the group may tail more than one file
+func (g *Group) Multiple() bool {
+	return len(g.patterns) > 1 || (len(g.patterns) == 1 && isGlob(g.patterns[0]))
+}
+
+// Start starts tailing the files matching the patterns, each one in a separate goroutine.
+// Returns the channel of the lines of all the files and an error
+func (g *Group) Start() (<-chan *Line, error) {
+	if g.started {
+		return nil, fmt.Errorf("tailer group can be started only once")
+	}
+	if len(g.patterns) == 0 {
+		return nil, fmt.Errorf("no file to tail")
+	}
+	fileNames, err := g.match(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileName := range fileNames {
+		if err := g.add(fileName); err != nil {
+			go func() {
+				for range g.lines { // Nobody else reads the lines of the tailers already started
+				}
+			}()
+			g.stopTailers()
+			g.wg.Wait()
+			close(g.lines)
+			return nil, err
+		}
+	}
+	g.started = true
+	go g.scanLoop()
+	return g.lines, nil
+}
+
+// Stop stops tailing all the files, gracefully exiting the background goroutines.
+// Returns the first error stopping the tailers
+func (g *Group) Stop() error {
+	if !g.started {
+		return fmt.Errorf("tailer group can be stopped only after start")
+	}
+	close(g.quitChan)
+	<-g.scanChan // No tailer added from now on
+	err := g.stopTailers()
+	g.wg.Wait()
+	close(g.lines)
+	close(g.stopChan)
+	return err
+}
+
+// Wait blocks until the group is stopped. A tailer dying on its own doesn't stop the group, the
+// reason for its death is logged instead
+func (g *Group) Wait() error {
+	if !g.started {
+		return fmt.Errorf("tailer group cannot wait if not started")
+	}
+	<-g.stopChan
+	return nil
+}
+
+// match returns the names of the files matching the patterns. Plain paths are included only if
+// all is true, since they're tailed from the start anyway. Compressed files matching a glob (eg.
+// the rotated access.log.2.gz for access.log*) are left out, since they cannot be followed
+func (g *Group) match(all bool) ([]string, error) {
+	var fileNames []string
+	seen := make(map[string]bool)
+	for _, p := range g.patterns {
+		matches := []string{p}
+		if isGlob(p) {
+			var err error
+			if matches, err = filepath.Glob(p); err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", p, err)
+			}
+		} else if !all {
+			continue
+		}
+		for _, m := range matches {
+			if seen[m] {
+				continue
+			}
+			// Files that cannot be read are not left out, so that tailing them reports the error
+			if isGlob(p) {
+				if compressed, _ := isCompressed(m); compressed {
+					continue
+				}
+			}
+			seen[m] = true
+			fileNames = append(fileNames, m)
+		}
+	}
+	return fileNames, nil
+}
+
+// add starts tailing the file, unless it's already tailed
+func (g *Group) add(fileName string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.tailers[fileName]; ok {
+		return nil
+	}
+
+	t := New(fileName, g.opts...)
+	t.state = g.state
+	lines, err := t.Start()
+	if err != nil {
+		return err
+	}
+	g.tailers[fileName] = t
+	g.wg.Add(1)
+	go g.forward(t, lines)
+	return nil
+}
+
+// forward sends the lines of a tailer to the group channel, tagged with the file name
+func (g *Group) forward(t *Tailer, lines <-chan *tail.Line) {
+	defer g.wg.Done()
+	for l := range lines {
+		g.lines <- &Line{Line: l, FileName: t.fileName, tailer: t}
+	}
+	if err := t.Wait(); err != nil {
+		g.log.Printf("[ERROR] stopped tailing %s: %v", t.fileName, err)
+	}
+}
+
+// scanLoop starts tailing the files matching the glob patterns every scan period
+func (g *Group) scanLoop() {
+	defer close(g.scanChan)
+	ticker := time.NewTicker(g.scanPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fileNames, err := g.match(false)
+			if err != nil {
+				g.log.Println("[ERROR]", err)
+				continue
+			}
+			for _, fileName := range fileNames {
+				if err := g.add(fileName); err != nil {
+					g.log.Printf("[ERROR] cannot tail %s: %v", fileName, err)
+				}
+			}
+		case <-g.quitChan:
+			return
+		}
+	}
+}
+
+// stopTailers stops all the tailers. Returns the first error
+func (g *Group) stopTailers() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var firstErr error
+	for _, t := range g.tailers {
+		if err := t.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// isGlob tells whether the path is a glob pattern
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
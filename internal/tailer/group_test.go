@@ -0,0 +1,205 @@
+package tailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readGroupLines reads n lines from the group, failing the test if they don't come in time.
+// Returns the lines as "<file base name>: <text>", sorted since files are tailed concurrently
+func readGroupLines(t *testing.T, lines <-chan *Line, n int) []string {
+	var out []string
+	for i := 0; i < n; i++ {
+		select {
+		case l := <-lines:
+			out = append(out, filepath.Base(l.FileName)+": "+l.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for line %d", i)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestNewGroup(t *testing.T) {
+	g := NewGroup([]string{"a.log"}, WithTailers(WithCheckpoint("state", time.Second)), WithScanPeriod(time.Second))
+	assert.Equal(t, []string{"a.log"}, g.patterns)
+	assert.Len(t, g.opts, 1)
+	assert.NotNil(t, g.state)
+	assert.Equal(t, time.Second, g.scanPeriod)
+
+	g = NewGroup([]string{"a.log"})
+	assert.Nil(t, g.state)
+	assert.Equal(t, DefaultScanPeriod, g.scanPeriod)
+}
+
+func TestGroup_Multiple(t *testing.T) {
+	testCases := []struct {
+		patterns []string
+		exp      bool
+	}{
+		{nil, false},
+		{[]string{"a.log"}, false},
+		{[]string{"*.log"}, true},
+		{[]string{"a.log", "b.log"}, true},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.exp, NewGroup(tt.patterns).Multiple(), tt.patterns)
+	}
+}
+
+func TestGroup_Start(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a-access.log"), []byte("a 0\na 1\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b-access.log"), []byte("b 0\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "error.log"), []byte("e 0\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte("o 0\n"), 0644))
+
+	// Files matched more than once are tailed once
+	g := NewGroup([]string{filepath.Join(dir, "*-access.log"), filepath.Join(dir, "other.log"),
+		filepath.Join(dir, "a-access.log")}, WithScanPeriod(50*time.Millisecond))
+	lines, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a-access.log: a 0", "a-access.log: a 1", "b-access.log: b 0", "other.log: o 0"},
+		readGroupLines(t, lines, 4))
+
+	// New files matching the glob are picked up
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c-access.log"), []byte("c 0\n"), 0644))
+	assert.Equal(t, []string{"c-access.log: c 0"}, readGroupLines(t, lines, 1))
+
+	assert.NoError(t, g.Stop())
+	assert.NoError(t, g.Wait())
+	_, ok := <-lines
+	assert.False(t, ok)
+}
+
+func TestGroup_StartCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "access.log"), []byte("a 0\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "access.log.1"), []byte("a 1\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "access.log.2.gz"), gzipLines(t, "a 2\n"), 0644))
+
+	// Compressed files matching the glob are not tailed, even when they appear later
+	g := NewGroup([]string{filepath.Join(dir, "access.log*")}, WithScanPeriod(50*time.Millisecond))
+	lines, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"access.log.1: a 1", "access.log: a 0"}, readGroupLines(t, lines, 2))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "access.log.3.zst"), zstdLines(t, "a 3\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "access.log.4"), []byte("a 4\n"), 0644))
+	assert.Equal(t, []string{"access.log.4: a 4"}, readGroupLines(t, lines, 1))
+
+	g.mu.Lock()
+	assert.Len(t, g.tailers, 3)
+	g.mu.Unlock()
+	assert.NoError(t, g.Stop())
+}
+
+func TestGroup_StartErr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.log"), []byte("a 0\n"), 0644))
+
+	testCases := [][]string{
+		nil,
+		{filepath.Join(dir, "a.log"), filepath.Join(dir, "nope.log")},
+		{filepath.Join(dir, "[")},
+	}
+
+	for _, patterns := range testCases {
+		lines, err := NewGroup(patterns).Start()
+		assert.Error(t, err, patterns)
+		assert.Nil(t, lines)
+	}
+}
+
+func TestGroup_StartNoMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	g := NewGroup([]string{filepath.Join(dir, "*.log")})
+	lines, err := g.Start()
+	assert.NoError(t, err)
+	assert.NotNil(t, lines)
+	assert.NoError(t, g.Stop())
+}
+
+func TestGroup_StartAlreadyStarted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	g := NewGroup([]string{filepath.Join(dir, "*.log")})
+	_, err = g.Start()
+	assert.NoError(t, err)
+	lines, err := g.Start()
+	assert.Error(t, err)
+	assert.Nil(t, lines)
+	assert.NoError(t, g.Stop())
+}
+
+func TestGroup_StopAndWaitWhenNotStarted(t *testing.T) {
+	g := NewGroup([]string{"a.log"})
+	assert.Error(t, g.Stop())
+	assert.Error(t, g.Wait())
+}
+
+func TestGroup_Checkpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tailer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("a 0\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("b 0\nb 1\n"), 0644))
+	stateFile := filepath.Join(dir, "state.json")
+
+	// Both files checkpointed in the same state file
+	g := NewGroup([]string{filepath.Join(dir, "*.log")}, WithTailers(WithCheckpoint(stateFile, time.Hour)))
+	lines, err := g.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.log: a 0", "b.log: b 0", "b.log: b 1"}, readGroupLines(t, lines, 3))
+	assert.NoError(t, g.Stop())
+
+	checkpoints, err := loadCheckpoints(stateFile)
+	assert.NoError(t, err)
+	if assert.Len(t, checkpoints, 2) {
+		assert.Equal(t, int64(4), checkpoints[a].Offset)
+		assert.Equal(t, int64(8), checkpoints[b].Offset)
+	}
+
+	// Both files resumed
+	f, err := os.OpenFile(a, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("a 1\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	g = NewGroup([]string{a, b}, WithTailers(WithCheckpoint(stateFile, time.Hour)))
+	lines, err = g.Start()
+	assert.NoError(t, err)
+	date := time.Date(2019, 1, 2, 10, 30, 0, 0, time.UTC)
+	select {
+	case l := <-lines:
+		assert.Equal(t, "a 1", l.Text)
+		l.Processed(date) // Log time saved with the checkpoint of the file of the line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for line a 1")
+	}
+	assert.NoError(t, g.Stop())
+
+	checkpoints, err = loadCheckpoints(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, date, checkpoints[a].Time)
+	assert.True(t, checkpoints[b].Time.IsZero())
+}
@@ -0,0 +1,177 @@
+package tailer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// Stdin is the name of the pipe reading the standard input
+const Stdin = "-"
+
+// Pipe reads the lines of a stream, ie. the standard input (eg. when run as an Apache httpd piped
+// logger) or a named pipe, until its end. Unlike the Tailer, it doesn't need a regular file
+type Pipe struct {
+	fileName string
+	tee      io.Writer
+	stdin    *os.File
+	log      *log.Logger
+	mu       sync.Mutex
+	file     *os.File // Nil until opened
+	started  bool
+	err      error         // Reason the stream ended for, nil at its end
+	quitChan chan struct{} // Closed when the pipe is stopped
+	doneChan chan struct{} // Closed when the stream ended or the pipe was stopped
+}
+
+// PipeOption configures an optional setting of the pipe
+type PipeOption func(*Pipe)
+
+// WithTee copies every line read from the pipe, newline included, to the writer (eg. to keep the
+// raw log in a file). Write errors are logged and don't stop reading the pipe
+func WithTee(w io.Writer) PipeOption {
+	return func(p *Pipe) {
+		p.tee = w
+	}
+}
+
+// NewPipe returns a pipe reading the named pipe with the given name, or the standard input if the
+// name is Stdin. Cannot return nil.
+func NewPipe(fileName string, opts ...PipeOption) *Pipe {
+	p := &Pipe{
+		fileName: fileName,
+		stdin:    os.Stdin,
+		log:      log.New(os.Stderr, "", log.LstdFlags),
+		quitChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Start starts reading the stream in a separate goroutine. A named pipe is opened by the goroutine,
+// since opening blocks until there's a writer.
+// Returns the lines channel, closed at the end of the stream, and an error
+func (p *Pipe) Start() (<-chan *Line, error) {
+	if p.started {
+		return nil, fmt.Errorf("pipe can be started only once")
+	}
+	if p.fileName != Stdin {
+		if _, err := os.Stat(p.fileName); err != nil {
+			return nil, err
+		}
+	}
+	p.started = true
+
+	lines := make(chan *Line)
+	go p.read(lines)
+	return lines, nil
+}
+
+// Stop stops reading the stream. It doesn't wait for a pending read, which may never return
+func (p *Pipe) Stop() error {
+	if !p.started {
+		return fmt.Errorf("pipe can be stopped only after start")
+	}
+	select {
+	case <-p.quitChan:
+		return nil
+	default:
+		close(p.quitChan)
+	}
+
+	return p.closeFile() // Interrupts a pending read of a named pipe
+}
+
+// Wait blocks until the end of the stream or the pipe is stopped.
+// Returns the reason for the stream to end, nil at its end
+func (p *Pipe) Wait() error {
+	if !p.started {
+		return fmt.Errorf("pipe cannot wait if not started")
+	}
+	select {
+	case <-p.doneChan:
+	case <-p.quitChan: // The goroutine may be blocked opening a named pipe with no writer
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// read sends the lines of the stream to out until its end
+func (p *Pipe) read(out chan<- *Line) {
+	defer close(p.doneChan)
+	defer close(out)
+	err := p.readAll(out)
+	p.mu.Lock()
+	select {
+	case <-p.quitChan: // Reading errors caused by stopping are expected
+	default:
+		p.err = err
+	}
+	p.mu.Unlock()
+}
+
+func (p *Pipe) readAll(out chan<- *Line) error {
+	f := p.stdin
+	if p.fileName != Stdin {
+		var err error
+		if f, err = os.Open(p.fileName); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	p.file = f
+	p.mu.Unlock()
+	defer p.closeFile()
+
+	r := bufio.NewReader(f)
+	teeFailing := false // Only the first of consecutive write errors is logged
+	for {
+		text, err := r.ReadString('\n')
+		if text != "" {
+			if p.tee != nil {
+				_, wErr := io.WriteString(p.tee, text)
+				if wErr != nil && !teeFailing {
+					p.log.Println("[ERROR] cannot write to tee, lines are not copied until it recovers:", wErr)
+				} else if wErr == nil && teeFailing {
+					p.log.Println("[INFO] writing to tee again")
+				}
+				teeFailing = wErr != nil
+			}
+			l := &tail.Line{Text: strings.TrimRight(text, "\n"), Time: time.Now()}
+			select {
+			case out <- &Line{Line: l, FileName: p.fileName}:
+			case <-p.quitChan:
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", p.fileName, err)
+		}
+	}
+}
+
+// closeFile closes the named pipe, if open. The standard input is left open
+func (p *Pipe) closeFile() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.file
+	p.file = nil
+	if f == nil || f == p.stdin {
+		return nil
+	}
+	return f.Close()
+}
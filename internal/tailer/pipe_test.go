@@ -0,0 +1,163 @@
+package tailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/fileutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// readPipeLines reads the lines from the pipe until the channel is closed, failing the test if it
+// doesn't come in time
+func readPipeLines(t *testing.T, lines <-chan *Line) []string {
+	var out []string
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				return out
+			}
+			out = append(out, l.FileName+": "+l.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the end of the pipe")
+		}
+	}
+}
+
+func TestNewPipe(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPipe(Stdin, WithTee(&buf))
+	assert.Equal(t, Stdin, p.fileName)
+	assert.Equal(t, &buf, p.tee)
+}
+
+func TestPipe_Start(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	_, err = f.WriteString("Line 0\nLine 1\nLine 2") // Last line with no newline
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	p := NewPipe(f.Name(), WithTee(&buf))
+	lines, err := p.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{f.Name() + ": Line 0", f.Name() + ": Line 1", f.Name() + ": Line 2"}, readPipeLines(t, lines))
+	assert.NoError(t, p.Wait())
+	assert.Equal(t, "Line 0\nLine 1\nLine 2", buf.String())
+	assert.NoError(t, p.Stop())
+}
+
+// failingWriter fails the writes of the lines starting with 'x'
+type failingWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("x")) {
+		return 0, fmt.Errorf("write failed")
+	}
+	return w.buf.Write(p)
+}
+
+func TestPipe_TeeErr(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	_, err = f.WriteString("Line 0\nx1\nx2\nLine 3\nx4\n")
+	assert.NoError(t, err)
+
+	var w failingWriter
+	var logs bytes.Buffer
+	p := NewPipe(f.Name(), WithTee(&w))
+	p.log = log.New(&logs, "", 0)
+	lines, err := p.Start()
+	assert.NoError(t, err)
+	// Reading goes on when the tee fails
+	assert.Len(t, readPipeLines(t, lines), 5)
+	assert.NoError(t, p.Wait())
+	assert.Equal(t, "Line 0\nLine 3\n", w.buf.String())
+	assert.Equal(t, `[ERROR] cannot write to tee, lines are not copied until it recovers: write failed
+[INFO] writing to tee again
+[ERROR] cannot write to tee, lines are not copied until it recovers: write failed
+`, logs.String())
+	assert.NoError(t, p.Stop())
+}
+
+func TestPipe_Stdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+
+	p := NewPipe(Stdin)
+	lines, err := p.Start()
+	assert.NoError(t, err)
+	go func() {
+		_, err := w.WriteString("Line 0\nLine 1\n")
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close()) // End of the stream
+	}()
+	assert.Equal(t, []string{"-: Line 0", "-: Line 1"}, readPipeLines(t, lines))
+	assert.NoError(t, p.Wait())
+}
+
+func TestPipe_Stop(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+
+	p := NewPipe(Stdin)
+	lines, err := p.Start()
+	assert.NoError(t, err)
+	_, err = w.WriteString("Line 0\nLine 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "Line 0", (<-lines).Text)
+
+	// The pending line is dropped
+	assert.NoError(t, p.Stop())
+	assert.NoError(t, p.Wait())
+	assert.NoError(t, p.Stop())
+}
+
+func TestPipe_StartErr(t *testing.T) {
+	p := NewPipe("nope")
+	lines, err := p.Start()
+	assert.Error(t, err)
+	assert.Nil(t, lines)
+}
+
+func TestPipe_StartAlreadyStarted(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	p := NewPipe(f.Name())
+	_, err = p.Start()
+	assert.NoError(t, err)
+	lines, err := p.Start()
+	assert.Error(t, err)
+	assert.Nil(t, lines)
+	assert.NoError(t, p.Stop())
+}
+
+func TestPipe_StopAndWaitWhenNotStarted(t *testing.T) {
+	p := NewPipe(Stdin)
+	assert.Error(t, p.Stop())
+	assert.Error(t, p.Wait())
+}
@@ -1,7 +1,13 @@
 package tailer
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/hpcloud/tail"
 )
@@ -12,18 +18,70 @@ type Tailer struct {
 	tailConf tail.Config
 	tail     *tail.Tail
 	started  bool
+	// Checkpointing of the read position, disabled if stateFile is empty
+	stateFile        string
+	state            *stateStore // Shared with the other tailers of a Group, if any
+	checkpointPeriod time.Duration
+	mu               sync.Mutex
+	file             *os.File      // File the lines are read from, followed by forward
+	id               fileID        // Identity of the file the offset refers to
+	offset           int64         // Offset of the end of the last line delivered
+	lastTime         time.Time     // Log time of the last line processed, see Processed
+	forwardedChan    chan struct{} // Closed when all the lines have been forwarded
+	doneChan         chan struct{} // Closed when the last checkpoint has been taken
+	// Rotated files read before the file, oldest first, if backfill is enabled
+	backfillEnabled bool
+	backfillFiles   []string
+	backfillOffset  int64         // Offset the first rotated file is read from, when resuming in it
+	quitChan        chan struct{} // Closed when the tailer is stopped
+	log             *log.Logger
+}
+
+// Option configures an optional setting of the tailer
+type Option func(*Tailer)
+
+// WithCheckpoint makes the tailer persist its read position in the file (ie. its identity, the
+// offset of the last line delivered and the log time of the last line processed, see Processed) to
+// the state file every period and when stopped, and resume from it when started, unless the file
+// has been rotated or truncated in the meantime. Lines delivered but not yet processed when the
+// process crashes are not read again. The tailers of a Group share the same state file.
+// By default tailing starts from the beginning of the file
+func WithCheckpoint(stateFile string, period time.Duration) Option {
+	return func(t *Tailer) {
+		t.stateFile = stateFile
+		t.checkpointPeriod = period
+	}
+}
+
+// WithBackfill makes the tailer read the whole rotated versions of the file (eg. access.log.2.gz and
+// access.log.1 for access.log, see RotatedFiles), oldest first and decompressed if needed (see Open),
+// before the file itself. Backfill is skipped when resuming from a checkpoint of the file, since the
+// rotated files have already been read. If the checkpointed file has been rotated since, backfill
+// resumes from it instead then
+func WithBackfill() Option {
+	return func(t *Tailer) {
+		t.backfillEnabled = true
+	}
 }
 
 // New returns a tailer for the given file. Cannot return nil.
-func New(fileName string) *Tailer {
-	return &Tailer{
+func New(fileName string, opts ...Option) *Tailer {
+	t := &Tailer{
 		fileName: fileName,
 		tailConf: tail.Config{
 			MustExist: true, // Fail early if the file does not exist
 			Follow:    true, // Continue looking for new lines (tail -f)
 			ReOpen:    true, // Reopen recreated/truncated files (tail -F)
 		},
+		forwardedChan: make(chan struct{}),
+		doneChan:      make(chan struct{}),
+		quitChan:      make(chan struct{}),
+		log:           log.New(os.Stderr, "", log.LstdFlags),
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 // Start starts the tailing process in a separate goroutine.
@@ -32,14 +90,53 @@ func (t *Tailer) Start() (<-chan *tail.Line, error) {
 	if t.started {
 		return nil, fmt.Errorf("tailer can be started only once")
 	}
+	if t.backfillEnabled {
+		files, err := RotatedFiles(t.fileName)
+		if err != nil {
+			return nil, err
+		}
+		t.backfillFiles = files
+	}
+	if t.stateFile == "" {
+		tf, err := tail.TailFile(t.fileName, t.tailConf)
+		if err != nil {
+			return nil, err
+		}
+		t.started = true
+		t.tail = tf
+		close(t.doneChan)
+		return t.withBackfill(tf.Lines), nil
+	}
 
+	if t.state == nil {
+		t.state = newStateStore(t.stateFile)
+	}
+	if err := t.resume(); err != nil {
+		return nil, err
+	}
 	tf, err := tail.TailFile(t.fileName, t.tailConf)
 	if err != nil {
+		t.file.Close()
 		return nil, err
 	}
 	t.started = true
 	t.tail = tf
-	return tf.Lines, nil
+
+	lines := make(chan *tail.Line)
+	go t.forward(tf.Lines, lines)
+	go t.checkpointLoop()
+	return t.withBackfill(lines), nil
+}
+
+// withBackfill returns the lines of the rotated files followed by the given ones, if there's any
+// file to backfill
+func (t *Tailer) withBackfill(lines <-chan *tail.Line) <-chan *tail.Line {
+	if len(t.backfillFiles) == 0 {
+		return lines
+	}
+	out := make(chan *tail.Line)
+	go t.backfill(lines, out)
+	return out
 }
 
 // Stop stops the tailing process, gracefully exiting the background goroutines
@@ -47,7 +144,12 @@ func (t *Tailer) Stop() error {
 	if !t.started {
 		return fmt.Errorf("tailer can be stopped only after start")
 	}
-	return t.tail.Stop()
+	if !t.stopped() {
+		close(t.quitChan) // Interrupt the backfill, if any
+	}
+	err := t.tail.Stop()
+	<-t.doneChan // Last checkpoint, if any, taken
+	return err
 }
 
 // Wait blocks until the tailer goroutine is in a dead state.
@@ -58,3 +160,170 @@ func (t *Tailer) Wait() error {
 	}
 	return fmt.Errorf("tailer cannot wait if not started")
 }
+
+// Processed records the log time of the last line processed (eg. its date once parsed), saved with
+// the checkpoint
+func (t *Tailer) Processed(date time.Time) {
+	t.mu.Lock()
+	t.lastTime = date
+	t.mu.Unlock()
+}
+
+// resume sets the location tailing starts from according to the checkpoint in the state file, and
+// opens the file to follow. An invalid state file is ignored, so that it cannot prevent the tailer
+// from starting
+func (t *Tailer) resume() error {
+	f, err := os.Open(t.fileName)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	c, err := t.state.get(t.fileName)
+	if err != nil {
+		t.log.Println("[WARN] ignoring checkpoint:", err)
+	}
+	id := getFileID(info)
+	offset, err := resumeOffset(f, id, info.Size(), c)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if offset > 0 {
+		t.tailConf.Location = &tail.SeekInfo{Offset: offset, Whence: io.SeekStart}
+		t.backfillFiles = nil
+		t.lastTime = c.Time
+	} else if c != nil && len(t.backfillFiles) > 0 {
+		if err := t.resumeBackfill(c); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	t.file, t.id, t.offset = f, id, offset
+	return nil
+}
+
+// forward sends the lines read by the tailer to out, keeping track of the file they're read from
+// and of the offset of the last one.
+// The tail package reopens the file by name when it's rotated or truncated without telling it, so
+// every line is checked against the content of the file the previous ones were read from. A line
+// that doesn't follow them has been read from the beginning of the file now at the path
+func (t *Tailer) forward(in <-chan *tail.Line, out chan<- *tail.Line) {
+	defer close(t.forwardedChan)
+	defer close(out)
+	defer func() {
+		if t.file != nil {
+			t.file.Close()
+		}
+	}()
+	r := bufio.NewReader(t.file)
+	lost := false // Whether the file the lines are read from is unknown
+	for l := range in {
+		f, id, offset := t.file, t.id, t.offset
+		if l.Err == nil && !lost {
+			if !followsLine(r, l.Text) {
+				var err error
+				if f, id, r, err = reopenAt(t.fileName, l.Text); err != nil {
+					t.log.Printf("[WARN] cannot checkpoint %s until restarted: %v\n", t.fileName, err)
+					f, id, lost = nil, fileID{}, true
+				}
+				offset = 0
+			}
+			if !lost {
+				offset += int64(len(l.Text)) + 1 // Newline included
+			}
+		}
+		out <- l
+
+		t.mu.Lock()
+		if f != t.file {
+			t.file.Close()
+		}
+		t.file, t.id, t.offset = f, id, offset
+		t.mu.Unlock()
+	}
+}
+
+// followsLine tells whether the line, followed by a newline, is the next content of the reader
+func followsLine(r *bufio.Reader, text string) bool {
+	for {
+		b, err := r.ReadSlice('\n')
+		switch {
+		case err == bufio.ErrBufferFull: // Line longer than the buffer, compared a chunk at a time
+			if len(b) > len(text) || string(b) != text[:len(b)] {
+				return false
+			}
+			text = text[len(b):]
+		case err != nil:
+			return false
+		default:
+			return len(b) == len(text)+1 && string(b[:len(text)]) == text
+		}
+	}
+}
+
+// reopenAt opens the file, which must start with the line, returning its identity and a reader
+// positioned after the line
+func reopenAt(fileName, text string) (*os.File, fileID, *bufio.Reader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fileID{}, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fileID{}, nil, err
+	}
+	r := bufio.NewReader(f)
+	if !followsLine(r, text) {
+		f.Close()
+		return nil, fileID{}, nil, fmt.Errorf("line not found at the beginning of the reopened file")
+	}
+	return f, getFileID(info), r, nil
+}
+
+// checkpointLoop saves a checkpoint every period and when the tailer is stopped, once all the lines
+// have been forwarded
+func (t *Tailer) checkpointLoop() {
+	defer close(t.doneChan)
+	ticker := time.NewTicker(t.checkpointPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.checkpoint(); err != nil {
+				t.log.Println("[ERROR]", err)
+			}
+		case <-t.forwardedChan:
+			if err := t.checkpoint(); err != nil {
+				t.log.Println("[ERROR]", err)
+			}
+			return
+		}
+	}
+}
+
+// checkpoint saves the offset of the last line delivered to the state file. If the file has been
+// rotated and none of the lines of the new one has been delivered yet, the rotated one is
+// checkpointed, so that the new one is read from its beginning when resuming
+func (t *Tailer) checkpoint() error {
+	t.mu.Lock()
+	c := &checkpoint{
+		FileName: t.fileName,
+		Device:   t.id.device,
+		Inode:    t.id.inode,
+		Offset:   t.offset,
+		Time:     t.lastTime,
+	}
+	t.mu.Unlock()
+
+	return t.state.set(c)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/GianlucaBortoli/httpd-log-monitor/internal/fileutils"
 	"github.com/stretchr/testify/assert"
@@ -17,6 +18,19 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, true, tailer.tailConf.ReOpen)
 }
 
+func TestNew_WithCheckpoint(t *testing.T) {
+	tailer := New("asd", WithCheckpoint("asd.state", time.Second))
+	assert.Equal(t, "asd.state", tailer.stateFile)
+	assert.Equal(t, time.Second, tailer.checkpointPeriod)
+}
+
+func TestNew_WithBackfill(t *testing.T) {
+	tailer := New("asd")
+	assert.False(t, tailer.backfillEnabled)
+	tailer = New("asd", WithBackfill())
+	assert.True(t, tailer.backfillEnabled)
+}
+
 func TestTailer_Start(t *testing.T) {
 	f, err := fileutils.CreateTestFile()
 	assert.NoError(t, err)
@@ -31,7 +45,6 @@ func TestTailer_Start(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer tailer.Stop() // Stop tailer when the last line is written
 
 		for i := 0; i < linesToWrite; i++ {
 			_, err := f.WriteString(fmt.Sprintf("Line %d\n", i))
@@ -52,6 +65,9 @@ func TestTailer_Start(t *testing.T) {
 			linesCnt += 1
 			fmt.Println(l.Text)
 			assert.NotEmpty(t, l)
+			if linesCnt == linesToWrite {
+				tailer.Stop() // Stop tailer when the last line is read, the ones written later would be lost
+			}
 		}
 	}()
 
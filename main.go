@@ -2,33 +2,278 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/logparser"
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/rotate"
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/tailer"
 	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/logmonitor"
+	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/manager"
 )
 
 var (
-	logFile        = flag.String("logFile", "/tmp/access.log", "The path to the log file")
+	logFile        = flag.String("logFile", "/tmp/access.log", "Comma-separated paths or glob patterns (eg. /var/log/httpd/*-access.log) of the log files, tailed together")
+	input          = flag.String("input", "", "The path to a named pipe, or '-' for the standard input (eg. as an Apache httpd piped logger), the log lines are read from until its end instead of tailing -logFile")
+	tee            = flag.String("tee", "", "The path to the file where the log lines read from -input are copied, to keep the raw log. It's a strftime pattern (eg. /var/log/httpd/access_log.%Y%m%d) like the ones of Apache httpd's rotatelogs")
+	teeSize        = flag.Int64("teeSize", 0, "The size in bytes the -tee file is rotated at, 0 to disable")
+	teeInterval    = flag.Duration("teeInterval", 0, "How often the -tee file is rotated (eg. 24h for daily files), 0 to disable")
+	teeGzip        = flag.Bool("teeGzip", false, "Whether to compress the rotated -tee files with gzip")
+	teeKeep        = flag.Int("teeKeep", 0, "The number of rotated -tee files to keep, 0 to keep them all")
+	teeBlock       = flag.Bool("teeBlock", false, "Whether reading -input waits for the -tee file to be written when it falls behind, instead of dropping the lines from the copy")
 	statsPeriod    = flag.Duration("statsPeriod", 10*time.Second, "The length of the period for computing all the metrics and displaying them on the console")
 	statsK         = flag.Int("statsK", 5, "The maximum number of values to output when displaying topK metrics (eg. sections)")
 	alertPeriod    = flag.Duration("alertPeriod", 2*time.Minute, "The length of the period for computing the request rate metric used for alerting about high traffic conditions")
 	alertThreshold = flag.Float64("alertThreshold", 10, "The threshold on the request rate metric for alerting about high traffic conditions")
+	format         = flag.String("format", logparser.DefaultFormat, "The format of the log lines, one of: "+strings.Join(logparser.Formats(), ", "))
+	logFormat      = flag.String("logFormat", "", "The Apache httpd LogFormat string of the log lines (eg. '%h %l %u %t \"%r\" %>s %b %D'). Overrides -format if not empty")
+	nginxLogFormat = flag.String("nginxLogFormat", "", "The nginx log_format string of the log lines (eg. '$remote_addr [$time_local] \"$request\" $status $request_time'). Overrides -format if not empty")
+	jsonMapping    = flag.String("jsonMapping", "", "The comma-separated name=key pairs mapping the fields of JSON log lines to their (dotted) keys (eg. 'time=ts,time_layout=unix,path=request.path'). Overrides -format if not empty")
+	syslog         = flag.Bool("syslog", false, "Whether the log lines are framed as syslog messages (RFC 3164 or RFC 5424), whose header is stripped before parsing them with the configured format")
+	autoSampleSize = flag.Int("autoSampleSize", logparser.DefaultSampleSize, "The number of log lines used to detect their format when -format is "+logparser.AutoFormat)
+	sectionDepth   = flag.Int("sectionDepth", 1, "The number of leading path segments making up the section of a request (eg. '/api/v1' for '/api/v1/users' with depth 2)")
+	sectionRules   = flag.String("sectionRules", "", "The path to a file of ordered rules mapping request paths to sections, one per line as either 'prefix <prefix> <section>' or 'regexp <regexp> <template>'")
+	queryStats     = flag.Bool("queryStats", false, "Whether to display the topK query string parameter names")
+	queryValues    = flag.String("queryValues", "", "The comma-separated allow-list of query string parameters whose topK values are displayed (eg. 'utm_source,q'). Implies -queryStats")
+	botPatterns    = flag.String("botPatterns", "", "The path to a file of ordered user agent patterns, matched before the built-in ones, one per line as '<bot|monitoring> <name> <regexp>'")
+	humanAlerts    = flag.Bool("humanAlerts", false, "Whether the high traffic alerts consider only the requests of human clients, as classified by their user agent")
+	clientIPField  = flag.String("clientIPField", "", "The field of the log lines with the addresses the requests were forwarded for, as named by the log format (eg. '%{X-Forwarded-For}i'), used to resolve the client IPs behind proxies")
+	trustedProxies = flag.String("trustedProxies", "", "The comma-separated IP addresses or CIDR networks of the proxies skipped when resolving the client IPs (eg. '10.0.0.0/8,192.0.2.1')")
+	geoIPDBs       = flag.String("geoipDB", "", "The comma-separated paths of the local MaxMind DB files (eg. GeoLite2-City.mmdb,GeoLite2-ASN.mmdb) used to display the topK countries and ASNs of the clients")
+	lookupTables   = flag.String("lookupTables", "", "The comma-separated name=field:match:file lookup tables labelling the log lines, whose topK labels are displayed (eg. 'team=user:exact:teams.csv,office=client_ip:cidr:offices.json')")
+	vhostAlerts    = flag.String("vhostAlertThresholds", "", "The comma-separated vhost=threshold pairs of the per-vhost high traffic alerts (eg. 'example.com=50,quiet.org=2'), where the '*' vhost sets the threshold of the unlisted ones")
+	stateFile      = flag.String("stateFile", "", "The path to the file where the read position in the log files is saved, so that a restart resumes from it instead of reading the whole file")
+	statePeriod    = flag.Duration("checkpointPeriod", 10*time.Second, "How often the read position in the log file is saved to the state file")
+	backfill       = flag.Bool("backfill", false, "Whether to read the rotated log files (eg. access.log.2.gz, access.log.1), decompressing gzip, bzip2 and zstd ones, and the whole log files before following them, including the lines older than the start of the tool")
+	quarantine     = flag.String("quarantine", "", "The path to the file where rejected log lines are written with the reason, instead of being logged as errors")
+	quarantineSize = flag.Int64("quarantineSize", 10*1024*1024, "The size in bytes the quarantine file is rotated at")
+	quarantineKeep = flag.Int("quarantineKeep", 3, "The number of rotated quarantine files to keep")
 )
 
+// teeBufferSize is the number of log lines buffered while writing the tee file
+const teeBufferSize = 4096
+
+// newParser returns the log line parser configured via command line parameters
+func newParser() (logparser.Parser, error) {
+	if *logFormat != "" {
+		return logparser.NewWithFormat(*logFormat)
+	}
+	if *nginxLogFormat != "" {
+		return logparser.NewNginxWithFormat(*nginxLogFormat)
+	}
+	if *jsonMapping != "" {
+		mapping, err := logparser.ParseJSONMapping(*jsonMapping)
+		if err != nil {
+			return nil, err
+		}
+		return logparser.NewJSONWithMapping(mapping)
+	}
+	if *format == logparser.AutoFormat {
+		return logparser.NewAuto(*autoSampleSize, nil)
+	}
+	return logparser.Get(*format)
+}
+
+// newSections returns the section rules configured via command line parameters, or nil to keep
+// the sections computed by the parser
+func newSections() (*logparser.Sections, error) {
+	if *sectionRules != "" {
+		return logparser.LoadSections(*sectionDepth, *sectionRules)
+	}
+	if *sectionDepth != 1 {
+		return logparser.NewSections(*sectionDepth)
+	}
+	return nil, nil
+}
+
+// newClassifier returns the user agent classifier configured via command line parameters
+func newClassifier() (*logparser.Classifier, error) {
+	if *botPatterns != "" {
+		return logparser.LoadClassifier(*botPatterns)
+	}
+	return logparser.NewClassifier(), nil
+}
+
+// newTee returns the writer of the raw log lines read from the input, configured via command line
+// parameters. Unless -teeBlock is set, writes never block reading the input, lines are dropped
+// instead
+func newTee() (*rotate.AsyncWriter, error) {
+	opts := []rotate.Option{rotate.WithMaxSize(*teeSize), rotate.WithInterval(*teeInterval)}
+	if *teeKeep != 0 {
+		opts = append(opts, rotate.WithMaxFiles(*teeKeep))
+	}
+	if *teeGzip {
+		opts = append(opts, rotate.WithCompression())
+	}
+	w, err := rotate.NewPattern(*tee, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var asyncOpts []rotate.AsyncOption
+	if *teeBlock {
+		asyncOpts = append(asyncOpts, rotate.WithBlocking())
+	}
+	a, err := rotate.NewAsync(w, teeBufferSize, asyncOpts...)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// splitList returns the non-empty elements of a comma-separated list
+func splitList(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// parseThresholds parses the comma-separated vhost=threshold pairs of the per-vhost alerts.
+// Returns the threshold of the '*' vhost (0 if missing) and the ones of the other vhosts
+func parseThresholds(s string) (float64, map[string]float64, error) {
+	var defaultThreshold float64
+	thresholds := make(map[string]float64)
+	for _, pair := range splitList(s) {
+		split := strings.SplitN(pair, "=", 2)
+		if len(split) != 2 {
+			return 0, nil, fmt.Errorf("invalid vhost threshold %q, expected vhost=threshold", pair)
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(split[1]), 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid threshold of vhost %s: %v", split[0], err)
+		}
+		if vhost := strings.TrimSpace(split[0]); vhost == "*" {
+			defaultThreshold = t
+		} else {
+			thresholds[vhost] = t
+		}
+	}
+	return defaultThreshold, thresholds, nil
+}
+
 func main() {
 	flag.Parse()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	m, err := logmonitor.New(*logFile, *alertPeriod, *statsPeriod, *statsK, *alertThreshold)
+// run runs the monitor until the end of the input, if any. Returns instead of exiting on error, so
+// that the deferred closing of the files (eg. flushing the tee) is not skipped
+func run() error {
+	p, err := newParser()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if *syslog {
+		p = logparser.NewSyslog(p)
+	}
+
+	opts := []logmonitor.Option{logmonitor.WithParser(p)}
+	s, err := newSections()
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		opts = append(opts, logmonitor.WithSections(s))
+	}
+	c, err := newClassifier()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, logmonitor.WithClassifier(c))
+	r, err := logparser.NewClientIPResolver(*clientIPField, splitList(*trustedProxies)...)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, logmonitor.WithClientIPResolver(r))
+	if *geoIPDBs != "" {
+		// GeoIP is an optional enrichment, so the monitor runs without it
+		g, err := logparser.OpenGeoIP(splitList(*geoIPDBs)...)
+		if err != nil {
+			log.Println("[WARN] GeoIP enrichment disabled:", err)
+		} else {
+			defer g.Close()
+			opts = append(opts, logmonitor.WithGeoIP(g))
+		}
+	}
+	if *lookupTables != "" {
+		tables, err := logparser.ParseLookupTables(*lookupTables)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, logmonitor.WithLookupTables(tables...))
+	}
+	if *stateFile != "" {
+		opts = append(opts, logmonitor.WithTailerOptions(tailer.WithCheckpoint(*stateFile, *statePeriod)))
+	}
+	if *backfill {
+		opts = append(opts, logmonitor.WithBackfill())
+	}
+	if *quarantine != "" {
+		w, err := rotate.New(*quarantine, *quarantineSize, *quarantineKeep)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		opts = append(opts, logmonitor.WithQuarantine(w))
+	}
+	if *queryStats || *queryValues != "" {
+		opts = append(opts, logmonitor.WithStatsOptions(manager.WithQueryParams(splitList(*queryValues)...)))
+	}
+	if *humanAlerts {
+		opts = append(opts, logmonitor.WithStatsOptions(manager.WithAlertClasses(logparser.ClassHuman)))
+	}
+	if *vhostAlerts != "" {
+		defaultThreshold, thresholds, err := parseThresholds(*vhostAlerts)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, logmonitor.WithStatsOptions(manager.WithVHostAlerts(defaultThreshold, thresholds)))
+	}
+
+	if *input != "" {
+		var pipeOpts []tailer.PipeOption
+		if *tee != "" {
+			w, err := newTee()
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			pipeOpts = append(pipeOpts, tailer.WithTee(w))
+			opts = append(opts, logmonitor.WithStatsOptions(manager.WithDropCounter("tee", w.Dropped)))
+		}
+		opts = append(opts, logmonitor.WithPipe(tailer.NewPipe(*input, pipeOpts...)))
+	}
+	files := splitList(*logFile)
+	if len(files) == 0 {
+		return fmt.Errorf("no log file to tail")
+	}
+	if len(files) > 1 {
+		opts = append(opts, logmonitor.WithFiles(files[1:]...))
+	}
+
+	m, err := logmonitor.New(files[0], *alertPeriod, *statsPeriod, *statsK, *alertThreshold, opts...)
+	if err != nil {
+		return err
 	}
 
 	if err = m.Start(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	if err = m.Wait(); err != nil {
-		log.Fatal(err)
+	// Only the end of the input, if any, gets here. The monitor is stopped in any case, before the
+	// files it writes to are closed
+	waitErr := m.Wait()
+	if err = m.Stop(); err != nil {
+		return err
 	}
+	return waitErr
 }
@@ -2,6 +2,7 @@ package logmonitor
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -14,36 +15,188 @@ import (
 
 // Monitor scrapes log files and derives statistics from it
 type Monitor struct {
-	parser       *logparser.HTTPd
-	tailer       *tailer.Tailer
+	parser       logparser.Parser
+	sections     *logparser.Sections
+	classifier   *logparser.Classifier
+	geoIP        *logparser.GeoIP
+	clientIP     *logparser.ClientIPResolver
+	lookups      []*logparser.LookupTable
+	files        []string
+	input        input
+	perFile      bool // Whether the statistics of each file are observed
+	tailerOpts   []tailer.Option
 	statsManager *manager.Manager
+	statsOpts    []manager.Option
+	quarantine   io.Writer
+	backfill     bool
 	log          *log.Logger
 	quitChan     chan struct{}
 	startTime    time.Time
 }
 
-// New creates a monitor
-func New(fileName string, alertPeriod, statsPeriod time.Duration, k int, threshold float64) (*Monitor, error) {
-	l := log.New(os.Stderr, "", log.LstdFlags)
+// input is the source of the log lines, either the tailed log files or a pipe
+type input interface {
+	Start() (<-chan *tailer.Line, error)
+	Stop() error
+	Wait() error
+}
+
+// lookupReloadPeriod is how often the files of the lookup tables are checked for changes
+const lookupReloadPeriod = 10 * time.Second
+
+// Reasons for rejecting a log line
+const (
+	reasonParseError = "parse_error"
+	reasonBadSection = "bad_section"
+	reasonOldLine    = "old_line"
+)
+
+// rejectError is the error for a log line rejected by the monitor
+type rejectError struct {
+	reason string
+	err    error
+	date   time.Time // Log time of the line, zero if it cannot be parsed
+}
+
+func (e *rejectError) Error() string {
+	return e.err.Error()
+}
+
+// Option configures an optional setting of the monitor
+type Option func(*Monitor)
+
+// WithParser sets the parser used for the log lines.
+// Defaults to the parser for the Common and Combined Log Formats
+func WithParser(p logparser.Parser) Option {
+	return func(m *Monitor) {
+		m.parser = p
+	}
+}
+
+// WithSections sets the rules deriving the section of the log lines from their path.
+// Defaults to the section computed by the parser, ie. the first segment of the path
+func WithSections(s *logparser.Sections) Option {
+	return func(m *Monitor) {
+		m.sections = s
+	}
+}
+
+// WithClassifier sets the classifier tagging the log lines with the class of the client (eg. human
+// or bot), whose statistics are then observed. Lines are not classified by default
+func WithClassifier(c *logparser.Classifier) Option {
+	return func(m *Monitor) {
+		m.classifier = c
+	}
+}
+
+// WithGeoIP sets the databases enriching the log lines with the location and the autonomous
+// system of the client, whose statistics are then observed. Lines are not enriched by default
+func WithGeoIP(g *logparser.GeoIP) Option {
+	return func(m *Monitor) {
+		m.geoIP = g
+	}
+}
+
+// WithClientIPResolver sets the resolver of the address of the clients behind proxies.
+// Defaults to the remote host of the log lines
+func WithClientIPResolver(r *logparser.ClientIPResolver) Option {
+	return func(m *Monitor) {
+		m.clientIP = r
+	}
+}
 
-	m, err := manager.New(alertPeriod, statsPeriod, k, threshold, l)
+// WithLookupTables sets the tables labelling the log lines (eg. with the team of the user), whose
+// labels are observed as dimensions named after the tables. The tables are reloaded when their
+// files change
+func WithLookupTables(tables ...*logparser.LookupTable) Option {
+	return func(m *Monitor) {
+		m.lookups = append(m.lookups, tables...)
+	}
+}
+
+// WithFiles adds more log files to tail besides the one given to New, as paths or glob patterns.
+// The statistics of each file are then observed besides the global ones
+func WithFiles(patterns ...string) Option {
+	return func(m *Monitor) {
+		m.files = append(m.files, patterns...)
+	}
+}
+
+// WithPipe makes the monitor read the log lines from the pipe (eg. the standard input of an Apache
+// httpd piped logger) instead of tailing the log files
+func WithPipe(p *tailer.Pipe) Option {
+	return func(m *Monitor) {
+		m.input = p
+	}
+}
+
+// WithTailerOptions enables optional features of the tailer of every file (eg. tailer.WithCheckpoint)
+func WithTailerOptions(opts ...tailer.Option) Option {
+	return func(m *Monitor) {
+		m.tailerOpts = append(m.tailerOpts, opts...)
+	}
+}
+
+// WithBackfill makes the monitor read the rotated versions of the log files (eg. access.log.2.gz and
+// access.log.1) and the whole log files before following them, see tailer.WithBackfill. Lines older
+// than the start of the monitor are then accepted
+func WithBackfill() Option {
+	return func(m *Monitor) {
+		m.backfill = true
+		m.tailerOpts = append(m.tailerOpts, tailer.WithBackfill())
+	}
+}
+
+// WithStatsOptions enables optional statistics of the stats manager (eg. manager.WithQueryParams)
+func WithStatsOptions(opts ...manager.Option) Option {
+	return func(m *Monitor) {
+		m.statsOpts = append(m.statsOpts, opts...)
+	}
+}
+
+// WithQuarantine sets the sink where rejected log lines are written together with the reason, one
+// per line as '<time>\t<reason>\t<error>\t<line>', instead of being logged as errors
+func WithQuarantine(w io.Writer) Option {
+	return func(m *Monitor) {
+		m.quarantine = w
+	}
+}
+
+// New creates a monitor of the given log file, or of the ones matching the given glob pattern (eg.
+// /var/log/httpd/*-access.log). New files matching the pattern are picked up while running
+func New(fileName string, alertPeriod, statsPeriod time.Duration, k int, threshold float64, opts ...Option) (*Monitor, error) {
+	l := log.New(os.Stderr, "", log.LstdFlags)
+	r, err := logparser.NewClientIPResolver("")
 	if err != nil {
 		return nil, err
 	}
 
-	return &Monitor{
-		parser:       logparser.New(),
-		tailer:       tailer.New(fileName),
-		statsManager: m,
-		log:          l,
-		quitChan:     make(chan struct{}),
-		startTime:    time.Now(),
-	}, nil
+	mon := &Monitor{
+		parser:    logparser.New(),
+		clientIP:  r,
+		log:       l,
+		quitChan:  make(chan struct{}),
+		startTime: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(mon)
+	}
+
+	if mon.input == nil {
+		g := tailer.NewGroup(append([]string{fileName}, mon.files...), tailer.WithTailers(mon.tailerOpts...))
+		mon.input, mon.perFile = g, g.Multiple()
+	}
+	m, err := manager.New(alertPeriod, statsPeriod, k, threshold, l, mon.statsOpts...)
+	if err != nil {
+		return nil, err
+	}
+	mon.statsManager = m
+	return mon, nil
 }
 
-// Start starts tailing and processing the log file in a separate goroutine
+// Start starts tailing and processing the log files in separate goroutines
 func (m *Monitor) Start() error {
-	lines, err := m.tailer.Start()
+	lines, err := m.input.Start()
 	if err != nil {
 		return fmt.Errorf("monitor start error: %v", err)
 	}
@@ -55,7 +208,7 @@ func (m *Monitor) Start() error {
 
 // Stop stops the tailer and the processing of new log lines
 func (m *Monitor) Stop() error {
-	if err := m.tailer.Stop(); err != nil {
+	if err := m.input.Stop(); err != nil {
 		return err
 	}
 	close(m.quitChan)
@@ -63,29 +216,100 @@ func (m *Monitor) Stop() error {
 	return nil
 }
 
-// Wait blocks until the tailer goroutine is in a dead state. Returns the reason for its death.
+// Wait blocks until the tailers are stopped or the end of the pipe, if any. Returns the reason for
+// the pipe to end, nil at its end.
 // If the main process is abruptly killed, this function never returns and the tailer may leak inotify
 // watches in the Linux kernel. See https://godoc.org/github.com/hpcloud/tail#Tail.Cleanup) for more
 // information.
 func (m *Monitor) Wait() error {
-	return m.tailer.Wait()
+	return m.input.Wait()
 }
 
 // startParsingTail is the loop where every log line is parsed, processed and new data point
 // for the statistics are observed.
-func (m *Monitor) startParsingTail(lines <-chan *tail.Line) {
+func (m *Monitor) startParsingTail(lines <-chan *tailer.Line) {
+	// Lookup tables are reloaded by this goroutine, the only one using them
+	var reload <-chan time.Time
+	if len(m.lookups) > 0 {
+		t := time.NewTicker(lookupReloadPeriod)
+		defer t.Stop()
+		reload = t.C
+	}
+
 	for {
 		select {
-		case l := <-lines:
-			logLine, err := m.checkLine(l)
+		case l, ok := <-lines:
+			if !ok { // Input stopped or ended, wait to quit
+				lines = nil
+				continue
+			}
+			logLine, err := m.checkLine(l.Line)
 			if err != nil {
-				m.log.Println("[ERROR]", err)
+				if rErr, ok := err.(*rejectError); ok && !rErr.date.IsZero() {
+					l.Processed(rErr.date)
+				}
+				m.reject(l.Line, err)
 				continue
 			}
+			if logLine == nil { // Directive line, with no request to observe
+				continue
+			}
+			l.Processed(logLine.Date)
+			logLine.Source = l.FileName
 			m.statsManager.ObserveSection(logLine.Section)
+			m.statsManager.ObserveRoute(logLine.Route)
 			m.statsManager.ObserveRequest()
 			m.statsManager.ObserveStatusCode(logLine.StatusCode)
 			m.statsManager.ObserveUser(logLine.User)
+			if logLine.ClientIP != "" {
+				m.statsManager.ObserveClientIP(logLine.ClientIP)
+			}
+			// Referer and user agent are only available in the Combined Log Format
+			if logLine.Referer != "" {
+				m.statsManager.ObserveReferer(logLine.Referer)
+			}
+			if logLine.UserAgent != "" {
+				m.statsManager.ObserveUserAgent(logLine.UserAgent)
+			}
+			if logLine.Query != nil {
+				m.statsManager.ObserveQuery(logLine.Query)
+			}
+			if logLine.HasDuration {
+				m.statsManager.ObserveLatency(logLine.Section, logLine.Duration)
+			}
+			if logLine.Class != "" {
+				m.statsManager.ObserveClass(logLine.Class, logLine.Section, logLine.StatusCode)
+			}
+			if logLine.BotName != "" {
+				m.statsManager.ObserveDimension("bot", logLine.BotName, logLine.StatusCode)
+			}
+			// Location and autonomous system are only available for public IP addresses
+			if logLine.Country != "" {
+				m.statsManager.ObserveDimension("country", logLine.Country, logLine.StatusCode)
+			}
+			if logLine.ASN != 0 {
+				m.statsManager.ObserveDimension("asn", asnKey(logLine.ASN, logLine.ASOrg), logLine.StatusCode)
+			}
+			for name, label := range logLine.Labels {
+				m.statsManager.ObserveDimension(name, label, logLine.StatusCode)
+			}
+			// Per file statistics are redundant with a single file
+			if m.perFile {
+				m.statsManager.ObserveFile(logLine.Source, logLine.Section, logLine.StatusCode)
+			}
+			// Virtual host is only available if the log format records it (eg. vhost_combined)
+			if logLine.VHost != "" {
+				m.statsManager.ObserveVHost(logLine.VHost, logLine.Section, logLine.Class, logLine.StatusCode)
+			}
+			// Backend and server are only available in the proxies logs (eg. HAProxy)
+			if logLine.Backend != "" {
+				m.statsManager.ObserveDimension("backend", logLine.Backend, logLine.StatusCode)
+				if logLine.Server != "" {
+					m.statsManager.ObserveDimension("server", logLine.Backend+"/"+logLine.Server, logLine.StatusCode)
+				}
+			}
+		case <-reload:
+			m.reloadLookups()
 		case <-m.quitChan:
 			m.log.Println("[INFO] exiting monitor")
 			return
@@ -93,27 +317,104 @@ func (m *Monitor) startParsingTail(lines <-chan *tail.Line) {
 	}
 }
 
-// checkLine ensures the input line (coming directly from the tailer) respects the layout defined
-// in https://www.w3.org/Daemon/User/Config/Logging.html#common-logfile-format.
+// checkLine ensures the input line (coming directly from the tailer) respects the log format of the
+// monitor's parser, by default the one defined in
+// https://www.w3.org/Daemon/User/Config/Logging.html#common-logfile-format (or its Combined Log
+// Format extension).
 // It returns an error also in case log line contains a date preceding the time start time of the
 // monitor. This allows the caller to skip both malformed and old log lines.
+// Directive lines (eg. the '#Fields:' ones of W3C logs) return neither a line nor an error.
 func (m *Monitor) checkLine(line *tail.Line) (*logparser.Line, error) {
 	if line == nil {
-		return nil, fmt.Errorf("nil line")
+		return nil, &rejectError{reason: reasonParseError, err: fmt.Errorf("nil line")}
 	}
 	parsedLine, err := m.parser.ParseLine(line.Text)
+	if err == logparser.ErrDirective {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error parsing line: %v", err)
+		reason := reasonParseError
+		if _, ok := err.(*logparser.SectionError); ok {
+			reason = reasonBadSection
+		}
+		return nil, &rejectError{reason: reason, err: fmt.Errorf("error parsing line: %v", err)}
+	}
+	// Skip log lines whose date is before the start of the monitor, unless backfilling, before
+	// enriching them. This avoids to consider stale data for any later usage (eg. stats)
+	if !m.backfill && m.isOldLine(parsedLine) {
+		return nil, &rejectError{reason: reasonOldLine, err: fmt.Errorf("old log line detected. log time: %s, monitor start time: %s",
+			parsedLine.Date.String(), m.startTime.String()), date: parsedLine.Date}
+	}
+	if m.sections != nil {
+		parsedLine.Section = m.sections.Section(parsedLine.Path)
+	}
+	if m.classifier != nil {
+		parsedLine.Class, parsedLine.BotName = m.classifier.Classify(parsedLine.UserAgent)
+	}
+	parsedLine.ClientIP = m.clientIP.Resolve(parsedLine)
+	if m.geoIP != nil {
+		g := m.geoIP.Lookup(parsedLine.ClientIP)
+		parsedLine.Country, parsedLine.City, parsedLine.ASN, parsedLine.ASOrg = g.Country, g.City, g.ASN, g.ASOrg
 	}
-	// Skip log lines whose date is before the start of the monitor.
-	// This avoids to consider stale data for any later usage (eg. stats)
-	if m.isOldLine(parsedLine) {
-		return nil, fmt.Errorf("old log line detected. log time: %s, monitor start time: %s",
-			parsedLine.Date.String(), m.startTime.String())
+	for _, t := range m.lookups {
+		if label := t.Lookup(parsedLine); label != "" {
+			if parsedLine.Labels == nil {
+				parsedLine.Labels = make(map[string]string)
+			}
+			parsedLine.Labels[t.Name()] = label
+		}
 	}
 	return parsedLine, nil
 }
 
+// reloadLookups reloads the lookup tables whose file changed. Tables that cannot be reloaded keep
+// their previous content
+func (m *Monitor) reloadLookups() {
+	for _, t := range m.lookups {
+		reloaded, err := t.Reload()
+		if err != nil {
+			m.log.Println("[ERROR]", err)
+			continue
+		}
+		if reloaded {
+			m.log.Printf("[INFO] reloaded lookup table %s\n", t.Name())
+		}
+	}
+}
+
+// reject counts the line rejected by checkLine and either writes it to the quarantine sink, if
+// any, or logs the error. Old lines are well-formed, so they're only counted when quarantining
+func (m *Monitor) reject(line *tail.Line, err error) {
+	reason := reasonParseError
+	if rErr, ok := err.(*rejectError); ok {
+		reason = rErr.reason
+	}
+	m.statsManager.ObserveRejected(reason)
+
+	if m.quarantine == nil {
+		m.log.Println("[ERROR]", err)
+		return
+	}
+	if reason == reasonOldLine {
+		return
+	}
+	text := ""
+	if line != nil {
+		text = line.Text
+	}
+	if _, wErr := fmt.Fprintf(m.quarantine, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), reason, err, text); wErr != nil {
+		m.log.Println("[ERROR] cannot write to quarantine:", wErr)
+	}
+}
+
+// asnKey returns the name of an autonomous system in the statistics, eg. 'AS15169 Google LLC'
+func asnKey(asn uint, org string) string {
+	if org == "" {
+		return fmt.Sprintf("AS%d", asn)
+	}
+	return fmt.Sprintf("AS%d %s", asn, org)
+}
+
 // isOldLine returns false if the date in the log line is after the monitor's start time true otherwise
 func (m *Monitor) isOldLine(line *logparser.Line) bool {
 	if line == nil {
@@ -1,12 +1,18 @@
 package logmonitor
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/GianlucaBortoli/httpd-log-monitor/internal/fileutils"
 	"github.com/GianlucaBortoli/httpd-log-monitor/internal/logparser"
+	"github.com/GianlucaBortoli/httpd-log-monitor/internal/tailer"
+	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/manager"
 	"github.com/hpcloud/tail"
 	"github.com/stretchr/testify/assert"
 )
@@ -28,6 +34,95 @@ func TestNew(t *testing.T) {
 	assert.IsType(t, &Monitor{}, m)
 }
 
+func TestNew_WithParser(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	p, err := logparser.NewWithFormat(`%h %l %u %t "%r" %>s %b %D`)
+	assert.NoError(t, err)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithParser(p))
+	assert.NoError(t, err)
+	assert.NotNil(t, m)
+	assert.Equal(t, p, m.parser)
+}
+
+func TestNew_WithStatsOptions(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithStatsOptions(manager.WithQueryParams("q")))
+	assert.NoError(t, err)
+	assert.NotNil(t, m)
+	assert.Len(t, m.statsOpts, 1)
+	assert.NotNil(t, m.statsManager)
+}
+
+func TestNew_WithTailerOptions(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithTailerOptions(tailer.WithCheckpoint(f.Name()+".state", time.Second)))
+	assert.NoError(t, err)
+	assert.NotNil(t, m)
+	assert.Len(t, m.tailerOpts, 1)
+	assert.NotNil(t, m.input)
+}
+
+func TestNew_WithFiles(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10)
+	assert.NoError(t, err)
+	assert.False(t, m.perFile)
+
+	m, err = New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithFiles(f.Name()+"*"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{f.Name() + "*"}, m.files)
+	assert.True(t, m.perFile)
+}
+
+func TestMonitor_StartStopWithFiles(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	g, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(g)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithFiles(g.Name()))
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start())
+	_, err = g.WriteString("127.0.0.1 - - [09/May/2018:16:00:39 +0000] \"GET /report HTTP/1.0\" 200 123\n")
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, m.Stop())
+	assert.NoError(t, m.Wait())
+}
+
+func TestMonitor_WithPipe(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	_, err = f.WriteString("127.0.0.1 - - [09/May/2099:16:00:39 +0000] \"GET /report HTTP/1.0\" 200 123\n")
+	assert.NoError(t, err)
+
+	// The monitor stops waiting at the end of the pipe
+	p := tailer.NewPipe(f.Name())
+	m, err := New("nope", 10*time.Second, 10*time.Second, 10, 10, WithPipe(p))
+	assert.NoError(t, err)
+	assert.Equal(t, p, m.input)
+	assert.False(t, m.perFile)
+	assert.NoError(t, m.Start())
+	assert.NoError(t, m.Wait())
+	assert.NoError(t, m.Stop())
+}
+
 func TestNew_Err(t *testing.T) {
 	f, err := fileutils.CreateTestFile()
 	assert.NoError(t, err)
@@ -138,14 +233,42 @@ func TestMonitor_FilterLine(t *testing.T) {
 			},
 			&logparser.Line{
 				RemoteHost:    "127.0.0.1",
+				ClientIP:      "127.0.0.1",
+				RemoteLogName: "asd",
+				User:          "james",
+				Date:          futureDateTime,
+				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
+				Section:       "/report",
+				Protocol:      "HTTP/1.0",
+				StatusCode:    200,
+				ContentLength: 123,
+			},
+			false,
+		},
+		{
+			// Date in the future, Combined Log Format
+			&tail.Line{
+				Text: `127.0.0.1 asd james [` + futureDate + `] "GET /report HTTP/1.0" 200 123 "-" "curl/7.58.0"`,
+				Err:  nil,
+				Time: time.Now(),
+			},
+			&logparser.Line{
+				RemoteHost:    "127.0.0.1",
+				ClientIP:      "127.0.0.1",
 				RemoteLogName: "asd",
 				User:          "james",
 				Date:          futureDateTime,
 				Method:        "GET",
+				Path:          "/report",
+				Route:         "/report",
 				Section:       "/report",
 				Protocol:      "HTTP/1.0",
 				StatusCode:    200,
 				ContentLength: 123,
+				Referer:       "-",
+				UserAgent:     "curl/7.58.0",
 			},
 			false,
 		},
@@ -160,6 +283,248 @@ func TestMonitor_FilterLine(t *testing.T) {
 	}
 }
 
+func TestMonitor_FilterLine_WithSections(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	s, err := logparser.NewSections(2)
+	assert.NoError(t, err)
+	assert.NoError(t, s.AddRegexpRule(`^/api/v(\d+)/(\w+)`, "/api/v$1/$2"))
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithSections(s))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		resource   string
+		expPath    string
+		expSection string
+	}{
+		{"/api/v2/orders/42", "/api/v2/orders/42", "/api/v2/orders"},
+		{"/report/foo/bar", "/report/foo/bar", "/report/foo"},
+		{"/report", "/report", "/report"},
+	}
+
+	for _, tt := range testCases {
+		line := &tail.Line{
+			Text: `127.0.0.1 - james [09/May/2099:16:00:39 +0000] "GET ` + tt.resource + ` HTTP/1.0" 200 123`,
+			Time: time.Now(),
+		}
+		parsed, err := m.checkLine(line)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expPath, parsed.Path)
+		assert.Equal(t, tt.expSection, parsed.Section)
+	}
+}
+
+func TestMonitor_FilterLine_WithClassifier(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithClassifier(logparser.NewClassifier()))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		userAgent  string
+		expClass   string
+		expBotName string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64)", logparser.ClassHuman, ""},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", logparser.ClassBot, "Googlebot"},
+		{"-", logparser.ClassUnknown, ""},
+	}
+
+	for _, tt := range testCases {
+		line := &tail.Line{
+			Text: `127.0.0.1 - james [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "-" "` + tt.userAgent + `"`,
+			Time: time.Now(),
+		}
+		parsed, err := m.checkLine(line)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expClass, parsed.Class)
+		assert.Equal(t, tt.expBotName, parsed.BotName)
+	}
+}
+
+func TestMonitor_FilterLine_WithGeoIP(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	db, err := fileutils.CreateTestMMDB(map[string]map[string]interface{}{
+		"81.2.69.0/24": {
+			"country":                        map[string]interface{}{"iso_code": "GB"},
+			"city":                           map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+			"autonomous_system_number":       uint32(20712),
+			"autonomous_system_organization": "Andrews & Arnold Ltd",
+		},
+	})
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(db)
+	g, err := logparser.OpenGeoIP(db.Name())
+	assert.NoError(t, err)
+	defer g.Close()
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithGeoIP(g))
+	assert.NoError(t, err)
+
+	parsed, err := m.checkLine(&tail.Line{Text: `81.2.69.160 - james [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`})
+	assert.NoError(t, err)
+	assert.Equal(t, "GB", parsed.Country)
+	assert.Equal(t, "London", parsed.City)
+	assert.Equal(t, uint(20712), parsed.ASN)
+	assert.Equal(t, "Andrews & Arnold Ltd", parsed.ASOrg)
+
+	parsed, err = m.checkLine(&tail.Line{Text: `127.0.0.1 - james [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`})
+	assert.NoError(t, err)
+	assert.Empty(t, parsed.Country)
+	assert.Zero(t, parsed.ASN)
+}
+
+func TestMonitor_FilterLine_WithClientIPResolver(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	p, err := logparser.NewWithFormat(`%h %l %u %t "%r" %>s %b "%{X-Forwarded-For}i"`)
+	assert.NoError(t, err)
+	r, err := logparser.NewClientIPResolver("%{X-Forwarded-For}i", "10.0.0.0/8")
+	assert.NoError(t, err)
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithParser(p), WithClientIPResolver(r))
+	assert.NoError(t, err)
+
+	parsed, err := m.checkLine(&tail.Line{Text: `10.0.0.1 - - [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123 "2001:db8:0::7, 10.0.0.2"`})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", parsed.RemoteHost)
+	assert.Equal(t, "2001:db8::7", parsed.ClientIP)
+}
+
+func TestMonitor_FilterLine_WithLookupTables(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+	teams, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(teams)
+	_, err = teams.WriteString("james,payments\n")
+	assert.NoError(t, err)
+	assert.NoError(t, teams.Close())
+
+	team, err := logparser.LoadLookupTable("team", "user", logparser.MatchExact, teams.Name())
+	assert.NoError(t, err)
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithLookupTables(team))
+	assert.NoError(t, err)
+
+	parsed, err := m.checkLine(&tail.Line{Text: `127.0.0.1 - james [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments"}, parsed.Labels)
+
+	parsed, err = m.checkLine(&tail.Line{Text: `127.0.0.1 - frank [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`})
+	assert.NoError(t, err)
+	assert.Nil(t, parsed.Labels)
+
+	// Reloaded table
+	assert.NoError(t, ioutil.WriteFile(teams.Name(), []byte("frank,search\n"), 0644))
+	assert.NoError(t, os.Chtimes(teams.Name(), time.Now(), time.Now().Add(time.Second)))
+	m.reloadLookups()
+	parsed, err = m.checkLine(&tail.Line{Text: `127.0.0.1 - frank [09/May/2099:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "search"}, parsed.Labels)
+}
+
+func TestMonitor_FilterLine_WithBackfill(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithBackfill())
+	assert.NoError(t, err)
+	assert.Len(t, m.tailerOpts, 1)
+
+	// Old lines accepted
+	parsed, err := m.checkLine(&tail.Line{Text: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`})
+	assert.NoError(t, err)
+	assert.Equal(t, "/report", parsed.Section)
+}
+
+func TestAsnKey(t *testing.T) {
+	assert.Equal(t, "AS15169 Google LLC", asnKey(15169, "Google LLC"))
+	assert.Equal(t, "AS15169", asnKey(15169, ""))
+}
+
+func TestMonitor_FilterLine_Directive(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithParser(logparser.NewW3C()))
+	assert.NoError(t, err)
+
+	parsed, err := m.checkLine(&tail.Line{Text: "#Fields: date time cs-uri-stem sc-status"})
+	assert.NoError(t, err)
+	assert.Nil(t, parsed)
+
+	parsed, err = m.checkLine(&tail.Line{Text: "2099-05-09 16:00:39 /report 200"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/report", parsed.Section)
+}
+
+func TestMonitor_FilterLine_RejectReason(t *testing.T) {
+	testCases := []struct {
+		line      *tail.Line
+		expReason string
+	}{
+		{nil, reasonParseError},
+		{&tail.Line{Text: "asd"}, reasonParseError},
+		{&tail.Line{Text: `127.0.0.1 - james [09/May/2099:16:00:39 +0000] "GET report HTTP/1.0" 200 123`}, reasonBadSection},
+		{&tail.Line{Text: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`}, reasonOldLine},
+	}
+
+	m, f := getTestMonitor()
+	defer fileutils.RemoveTestFile(f)
+
+	for _, tt := range testCases {
+		parsed, err := m.checkLine(tt.line)
+		assert.Nil(t, parsed)
+		if assert.IsType(t, &rejectError{}, err) {
+			assert.Equal(t, tt.expReason, err.(*rejectError).reason)
+			// Only old lines have been parsed, their date is saved with the checkpoint
+			assert.Equal(t, tt.expReason == reasonOldLine, !err.(*rejectError).date.IsZero())
+		}
+	}
+}
+
+func TestMonitor_Reject(t *testing.T) {
+	f, err := fileutils.CreateTestFile()
+	assert.NoError(t, err)
+	defer fileutils.RemoveTestFile(f)
+
+	var buf bytes.Buffer
+	m, err := New(f.Name(), 10*time.Second, 10*time.Second, 10, 10, WithQuarantine(&buf))
+	assert.NoError(t, err)
+
+	line := &tail.Line{Text: `127.0.0.1 - james [09/May/2099:16:00:39 +0000] "GET report HTTP/1.0" 200 123`}
+	_, err = m.checkLine(line)
+	m.reject(line, err)
+	// Old lines are not quarantined
+	oldLine := &tail.Line{Text: `127.0.0.1 - james [09/May/2018:16:00:39 +0000] "GET /report HTTP/1.0" 200 123`}
+	_, err = m.checkLine(oldLine)
+	assert.Equal(t, reasonOldLine, err.(*rejectError).reason)
+	m.reject(oldLine, err)
+	m.reject(nil, fmt.Errorf("nil line"))
+
+	rows := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, rows, 2)
+	fields := strings.SplitN(rows[0], "\t", 4)
+	assert.Len(t, fields, 4)
+	_, err = time.Parse(time.RFC3339, fields[0])
+	assert.NoError(t, err)
+	assert.Equal(t, reasonBadSection, fields[1])
+	assert.Equal(t, "error parsing line: cannot get section from path report", fields[2])
+	assert.Equal(t, line.Text, fields[3])
+	assert.True(t, strings.HasSuffix(rows[1], "\tparse_error\tnil line\t"))
+}
+
 func TestMonitor_IsOldLine(t *testing.T) {
 	testCases := []struct {
 		line     *logparser.Line
@@ -13,17 +13,30 @@ import (
 type Alert struct {
 	ticker    *time.Ticker
 	log       *log.Logger
+	name      string // What the requests are for (eg. a virtual host), empty for all of them
 	metric    *rate.Rate
 	threshold float64
 	firing    bool
 	started   bool
 	incrChan  chan float64
+	countChan chan chan float64 // Requests of the count, answered by the loop
 	quitChan  chan struct{}
 	Alerts    chan *msg // Alerts are sent here
 }
 
+// Option configures an optional setting of the alert
+type Option func(*Alert)
+
+// WithName names what the watched requests are for (eg. a virtual host), so that it's reported
+// in the alert messages
+func WithName(name string) Option {
+	return func(a *Alert) {
+		a.name = name
+	}
+}
+
 // New returns the alert manager with the specified alerting period and threshold
-func New(period time.Duration, threshold float64, l *log.Logger) (*Alert, error) {
+func New(period time.Duration, threshold float64, l *log.Logger, opts ...Option) (*Alert, error) {
 	if period == 0 {
 		return nil, fmt.Errorf("cannot create alert with time window of width 0")
 	}
@@ -36,15 +49,20 @@ func New(period time.Duration, threshold float64, l *log.Logger) (*Alert, error)
 		return nil, fmt.Errorf("cannot create rate metric for alert: %v", err)
 	}
 
-	return &Alert{
+	a := &Alert{
 		ticker:    time.NewTicker(period),
 		log:       l,
 		metric:    m,
 		threshold: threshold,
 		incrChan:  make(chan float64),
+		countChan: make(chan chan float64),
 		quitChan:  make(chan struct{}),
 		Alerts:    make(chan *msg, 100),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
 }
 
 // Start starts watching the requests per second metric
@@ -73,7 +91,19 @@ func (a *Alert) IncrBy(i float64) {
 	a.incrChan <- i
 }
 
+// Count returns the number of requests observed in the current period. While started, it's read by
+// the event loop, so that it's safe to call from any goroutine
+func (a *Alert) Count() float64 {
+	if !a.started {
+		return a.metric.Count()
+	}
+	c := make(chan float64)
+	a.countChan <- c
+	return <-c
+}
+
 func (a *Alert) loop() {
+	defer a.ticker.Stop()
 	for {
 		select {
 		case <-a.ticker.C:
@@ -85,8 +115,11 @@ func (a *Alert) loop() {
 			if err := a.metric.IncrBy(i); err != nil {
 				a.log.Println("[ERROR]", err)
 			}
+		case c := <-a.countChan:
+			c <- a.metric.Count()
 		case <-a.quitChan:
 			a.log.Println("[INFO] alert event loop exit")
+			return
 		}
 	}
 }
@@ -99,6 +132,7 @@ func (a *Alert) checkThreshold() {
 	if !a.firing && avg >= a.threshold {
 		a.Alerts <- &msg{
 			Type:  highTraffic,
+			Name:  a.name,
 			Value: avg,
 			When:  time.Now(),
 		}
@@ -107,6 +141,7 @@ func (a *Alert) checkThreshold() {
 	if a.firing && avg < a.threshold {
 		a.Alerts <- &msg{
 			Type:  resolved,
+			Name:  a.name,
 			Value: avg,
 			When:  time.Now(),
 		}
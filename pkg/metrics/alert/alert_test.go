@@ -22,6 +22,12 @@ func TestNew(t *testing.T) {
 	assert.False(t, a.firing)
 }
 
+func TestNew_WithName(t *testing.T) {
+	a, err := New(time.Second, 100, nil, WithName("example.com"))
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", a.name)
+}
+
 func TestNew_WrongPeriod(t *testing.T) {
 	a, err := New(0, 100, nil)
 	assert.Error(t, err)
@@ -84,6 +90,17 @@ func TestAlert_IncrByStarted(t *testing.T) {
 	a.IncrBy(1)
 }
 
+func TestAlert_Count(t *testing.T) {
+	a, _ := New(time.Hour, 100, nil) // Not reset while counting
+	assert.Equal(t, float64(0), a.Count())
+
+	a.Start()
+	a.IncrBy(1)
+	a.IncrBy(2)
+	assert.Equal(t, float64(3), a.Count())
+	a.Stop()
+}
+
 func TestAlert_IncrByStopped(t *testing.T) {
 	a := getTestAlert()
 	a.IncrBy(1)
@@ -117,3 +134,21 @@ func TestAlert_checkThresholdWithAlerts(t *testing.T) {
 	a.IncrBy(10)
 	wg.Wait()
 }
+
+func TestMsg_String(t *testing.T) {
+	when := time.Date(2018, time.May, 9, 16, 0, 39, 0, time.UTC)
+	testCases := []struct {
+		m   *msg
+		exp string
+	}{
+		{&msg{Type: highTraffic, Value: 12, When: when}, "High traffic generated an alert - hits = 12.00, triggered at 2018-05-09T16:00:39Z"},
+		{&msg{Type: resolved, Value: 2, When: when}, "High traffic alert resolved - hits = 2.00, triggered at 2018-05-09T16:00:39Z"},
+		{&msg{Type: highTraffic, Name: "example.com", Value: 12, When: when}, "High traffic on example.com generated an alert - hits = 12.00, triggered at 2018-05-09T16:00:39Z"},
+		{&msg{Type: resolved, Name: "example.com", Value: 2, When: when}, "High traffic alert on example.com resolved - hits = 2.00, triggered at 2018-05-09T16:00:39Z"},
+		{&msg{Type: 42}, "unknown alert type 42"},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.exp, tt.m.String())
+	}
+}
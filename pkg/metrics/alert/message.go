@@ -12,21 +12,26 @@ const (
 
 type msg struct {
 	Type  int
+	Name  string // Empty for the alerts on all the requests
 	Value float64
 	When  time.Time
 }
 
 func (a *msg) String() string {
+	on := ""
+	if a.Name != "" {
+		on = " on " + a.Name
+	}
 	switch a.Type {
 	case highTraffic:
 		return fmt.Sprintf(
-			"High traffic generated an alert - hits = %.2f, triggered at %s",
-			a.Value, a.When.Format(time.RFC3339),
+			"High traffic%s generated an alert - hits = %.2f, triggered at %s",
+			on, a.Value, a.When.Format(time.RFC3339),
 		)
 	case resolved:
 		return fmt.Sprintf(
-			"High traffic alert resolved - hits = %.2f, triggered at %s",
-			a.Value, a.When.Format(time.RFC3339),
+			"High traffic alert%s resolved - hits = %.2f, triggered at %s",
+			on, a.Value, a.When.Format(time.RFC3339),
 		)
 	default:
 		return fmt.Sprintf("unknown alert type %d", a.Type)
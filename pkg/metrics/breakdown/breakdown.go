@@ -0,0 +1,87 @@
+package breakdown
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Breakdown implements a metric that counts the requests and the errors for each value of a
+// dimension (eg. the backend serving the requests) over a time frame of a given size
+type Breakdown struct {
+	counts     map[string]*Entry
+	windowSize time.Duration
+}
+
+// Entry holds the counters of a single value of the dimension
+type Entry struct {
+	Key      string
+	Requests int64
+	Errors   int64
+}
+
+// New returns a breakdown metric object
+func New(t time.Duration) (*Breakdown, error) {
+	if t == 0 {
+		return nil, fmt.Errorf("cannot have time window of width 0")
+	}
+	return &Breakdown{counts: make(map[string]*Entry), windowSize: t}, nil
+}
+
+// Observe counts a request for key, which is also counted as an error if isError is true
+func (b *Breakdown) Observe(key string, isError bool) {
+	e, ok := b.counts[key]
+	if !ok {
+		e = &Entry{Key: key}
+		b.counts[key] = e
+	}
+	e.Requests++
+	if isError {
+		e.Errors++
+	}
+}
+
+// TopK returns at maximum k entries with the most requests, sorted by decreasing number of
+// requests and then by key
+func (b *Breakdown) TopK(k int) []Entry {
+	out := make([]Entry, 0, len(b.counts))
+	for _, e := range b.counts {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests == out[j].Requests {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].Requests > out[j].Requests
+	})
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// Count returns the number of distinct keys observed in the time window
+func (b *Breakdown) Count() int {
+	return len(b.counts)
+}
+
+// Reset deletes all the counters
+func (b *Breakdown) Reset() {
+	b.counts = make(map[string]*Entry)
+}
+
+// GetWindowSize returns the size of the time window
+func (b *Breakdown) GetWindowSize() time.Duration {
+	return b.windowSize
+}
+
+// String returns the per-second averages of the requests and the errors of the entry over the
+// window size and its error ratio
+func (e Entry) String(windowSize time.Duration) string {
+	errRatio := 0.0
+	if e.Requests > 0 {
+		errRatio = float64(e.Errors) * 100 / float64(e.Requests)
+	}
+	return fmt.Sprintf("key:%s, %.2f req/s, %.2f err/s, errors:%.2f%%", e.Key,
+		float64(e.Requests)/windowSize.Seconds(), float64(e.Errors)/windowSize.Seconds(), errRatio)
+}
@@ -0,0 +1,74 @@
+package breakdown
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	b, err := New(10 * time.Second)
+	assert.NoError(t, err)
+	assert.NotNil(t, b)
+	assert.Equal(t, 10*time.Second, b.GetWindowSize())
+	assert.Equal(t, 0, b.Count())
+}
+
+func TestNew_Err(t *testing.T) {
+	b, err := New(0)
+	assert.Error(t, err)
+	assert.Nil(t, b)
+}
+
+func TestBreakdown_Observe(t *testing.T) {
+	b, _ := New(10 * time.Second)
+	b.Observe("static", false)
+	b.Observe("api", false)
+	b.Observe("api", true)
+	b.Observe("static", false)
+	b.Observe("api", true)
+	b.Observe("admin", false)
+
+	assert.Equal(t, 3, b.Count())
+	assert.Equal(t, []Entry{
+		{Key: "api", Requests: 3, Errors: 2},
+		{Key: "static", Requests: 2},
+		{Key: "admin", Requests: 1},
+	}, b.TopK(5))
+	assert.Equal(t, []Entry{{Key: "api", Requests: 3, Errors: 2}}, b.TopK(1))
+}
+
+func TestBreakdown_TopKTies(t *testing.T) {
+	b, _ := New(10 * time.Second)
+	b.Observe("b", false)
+	b.Observe("c", false)
+	b.Observe("a", false)
+
+	top := b.TopK(2)
+	assert.Equal(t, "a", top[0].Key)
+	assert.Equal(t, "b", top[1].Key)
+}
+
+func TestBreakdown_Reset(t *testing.T) {
+	b, _ := New(10 * time.Second)
+	b.Observe("api", true)
+	b.Reset()
+	assert.Equal(t, 0, b.Count())
+	assert.Empty(t, b.TopK(5))
+}
+
+func TestEntry_String(t *testing.T) {
+	testCases := []struct {
+		e   Entry
+		exp string
+	}{
+		{Entry{Key: "api", Requests: 40, Errors: 10}, "key:api, 4.00 req/s, 1.00 err/s, errors:25.00%"},
+		{Entry{Key: "static", Requests: 5}, "key:static, 0.50 req/s, 0.00 err/s, errors:0.00%"},
+		{Entry{Key: "empty"}, "key:empty, 0.00 req/s, 0.00 err/s, errors:0.00%"},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.exp, tt.e.String(10*time.Second))
+	}
+}
@@ -0,0 +1,77 @@
+package latency
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Latency implements a metric that returns quantiles of the durations observed in a time frame
+type Latency struct {
+	durations []time.Duration
+	sorted    bool
+}
+
+// New returns a latency metric object. Cannot return nil
+func New() *Latency {
+	return &Latency{}
+}
+
+// Observe adds a duration to the observed ones
+func (l *Latency) Observe(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("cannot observe negative duration")
+	}
+	l.durations = append(l.durations, d)
+	l.sorted = false
+	return nil
+}
+
+// Quantile returns the q-quantile (0 < q <= 1) of the observed durations using the nearest-rank
+// method. Returns 0 if there's no observed duration.
+// The time complexity of this method is O(N * log(N)) the first time it's called after an
+// observation and O(1) afterwards
+func (l *Latency) Quantile(q float64) time.Duration {
+	if len(l.durations) == 0 || q <= 0 {
+		return 0
+	}
+	if q > 1 {
+		q = 1
+	}
+	l.sort()
+	rank := int(math.Ceil(q * float64(len(l.durations))))
+	return l.durations[rank-1]
+}
+
+// Max returns the maximum observed duration, 0 if there's no observed duration
+func (l *Latency) Max() time.Duration {
+	return l.Quantile(1)
+}
+
+// Count returns the number of observed durations
+func (l *Latency) Count() int {
+	return len(l.durations)
+}
+
+// Reset deletes all the observed durations
+func (l *Latency) Reset() {
+	l.durations = nil
+	l.sorted = false
+}
+
+// String returns the most relevant quantiles of the observed durations
+func (l *Latency) String() string {
+	return fmt.Sprintf("p50=%s, p90=%s, p99=%s, max=%s",
+		l.Quantile(0.5), l.Quantile(0.9), l.Quantile(0.99), l.Max())
+}
+
+func (l *Latency) sort() {
+	if l.sorted {
+		return
+	}
+	sort.Slice(l.durations, func(i, j int) bool {
+		return l.durations[i] < l.durations[j]
+	})
+	l.sorted = true
+}
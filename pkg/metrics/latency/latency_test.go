@@ -0,0 +1,86 @@
+package latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	l := New()
+	assert.NotNil(t, l)
+	assert.Equal(t, 0, l.Count())
+}
+
+func TestLatency_Observe(t *testing.T) {
+	l := New()
+
+	err := l.Observe(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Count())
+
+	err = l.Observe(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, l.Count())
+
+	err = l.Observe(-time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, 2, l.Count())
+}
+
+func TestLatency_Quantile(t *testing.T) {
+	l := New()
+	// Observe 1ms...100ms in reverse order
+	for i := 100; i > 0; i-- {
+		err := l.Observe(time.Duration(i) * time.Millisecond)
+		assert.NoError(t, err)
+	}
+
+	testCases := []struct {
+		q   float64
+		exp time.Duration
+	}{
+		{0, 0},
+		{0.01, time.Millisecond},
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.exp, l.Quantile(tt.q))
+	}
+	assert.Equal(t, 100*time.Millisecond, l.Max())
+
+	// New observations are considered
+	err := l.Observe(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, l.Max())
+}
+
+func TestLatency_QuantileEmpty(t *testing.T) {
+	l := New()
+	assert.Equal(t, time.Duration(0), l.Quantile(0.5))
+	assert.Equal(t, time.Duration(0), l.Max())
+}
+
+func TestLatency_Reset(t *testing.T) {
+	l := New()
+	err := l.Observe(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Count())
+
+	l.Reset()
+	assert.Equal(t, 0, l.Count())
+	assert.Equal(t, time.Duration(0), l.Max())
+}
+
+func TestLatency_String(t *testing.T) {
+	l := New()
+	err := l.Observe(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "p50=1s, p90=1s, p99=1s, max=1s", l.String())
+}
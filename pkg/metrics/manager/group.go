@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/breakdown"
+	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/topk"
+)
+
+// group keeps track of the requests, the errors and the TopK sections of each value of a
+// grouping of the requests (eg. by virtual host)
+type group struct {
+	name     string // Name of the grouping, eg. vhost
+	plural   string
+	k        int
+	requests *breakdown.Breakdown
+	sections map[string]*topk.TopK
+}
+
+// newGroup returns the statistics of the grouping with the given singular and plural names, over
+// a time window of the given size
+func newGroup(name, plural string, windowSize time.Duration, k int) (*group, error) {
+	b, err := breakdown.New(windowSize)
+	if err != nil {
+		return nil, err
+	}
+	return &group{
+		name:     name,
+		plural:   plural,
+		k:        k,
+		requests: b,
+		sections: make(map[string]*topk.TopK),
+	}, nil
+}
+
+// observe counts the request in the statistics of its group
+func (g *group) observe(i *groupItem) error {
+	g.requests.Observe(i.key, i.isError)
+
+	t, ok := g.sections[i.key]
+	if !ok {
+		t = topk.New(g.k)
+		g.sections[i.key] = t
+	}
+	if ok := t.IncrBy(&topk.Item{Key: i.section, Score: 1}); !ok {
+		return fmt.Errorf("cannot incremet key %s by %d", i.section, 1)
+	}
+	return nil
+}
+
+// print prints the K groups with the most requests, along with their request and error rates,
+// and the TopK sections of each of them. Nothing is printed if no group has been observed
+func (g *group) print(l *log.Logger) {
+	top := g.requests.TopK(g.k)
+	if len(top) == 0 {
+		return
+	}
+	l.Printf("TopK %s:", g.plural)
+	for _, e := range top {
+		l.Println(e.String(g.requests.GetWindowSize()))
+	}
+	for _, e := range top {
+		l.Printf("TopK sections of %s %s:", g.name, e.Key)
+		for _, s := range g.sections[e.Key].TopK() {
+			l.Println(s.String())
+		}
+	}
+}
+
+// reset deletes all the statistics
+func (g *group) reset() {
+	g.requests.Reset()
+	g.sections = make(map[string]*topk.TopK)
+}
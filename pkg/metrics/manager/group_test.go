@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGroup(t *testing.T) {
+	g, err := newGroup("vhost", "vhosts", 10*time.Second, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "vhost", g.name)
+	assert.Equal(t, 5, g.k)
+
+	g, err = newGroup("vhost", "vhosts", 0, 5)
+	assert.Error(t, err)
+	assert.Nil(t, g)
+}
+
+func TestGroup_Print(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.New(&buf, "", 0)
+	g, _ := newGroup("vhost", "vhosts", 10*time.Second, 2)
+
+	// Nothing observed
+	g.print(l)
+	assert.Empty(t, buf.String())
+
+	for _, i := range []*groupItem{
+		{key: "example.com", section: "/api", isError: true},
+		{key: "example.com", section: "/api"},
+		{key: "example.com", section: "/static"},
+		{key: "example.org", section: "/"},
+		{key: "example.net", section: "/"},
+	} {
+		assert.NoError(t, g.observe(i))
+	}
+	g.print(l)
+	assert.Equal(t, `TopK vhosts:
+key:example.com, 0.30 req/s, 0.10 err/s, errors:33.33%
+key:example.net, 0.10 req/s, 0.00 err/s, errors:0.00%
+TopK sections of vhost example.com:
+key:/api, score:2
+key:/static, score:1
+TopK sections of vhost example.net:
+key:/, score:1
+`, buf.String())
+
+	g.reset()
+	assert.Equal(t, 0, g.requests.Count())
+	assert.Empty(t, g.sections)
+}
@@ -2,17 +2,24 @@ package manager
 
 import (
 	"log"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/alert"
+	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/breakdown"
+	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/latency"
 	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/rate"
 	"github.com/GianlucaBortoli/httpd-log-monitor/pkg/metrics/topk"
 )
 
+// maxVHostAlerts is the maximum number of virtual hosts alerted with the default threshold
+const maxVHostAlerts = 100
+
 // Manager keeps track of all the statistics computed from logs
 type Manager struct {
 	metricsTicker *time.Ticker
@@ -21,15 +28,64 @@ type Manager struct {
 	log           *log.Logger
 	started       int32 // 0 stopped, 1 started
 	quitChan      chan struct{}
+	k             int // Max number of values printed by per-key statistics
 	// TopK sections metric
 	sectionsTopK *topk.TopK
 	sectionsChan chan *topk.Item
+	// TopK routes
+	routesTopK *topk.TopK
+	routesChan chan *topk.Item
 	// TopK status codes
 	statusCodesTopK *topk.TopK
 	statusCodesChan chan *topk.Item
 	// TopK users
 	usersTopK *topk.TopK
 	usersChan chan *topk.Item
+	// TopK referers
+	referersTopK *topk.TopK
+	referersChan chan *topk.Item
+	// TopK user agents
+	userAgentsTopK *topk.TopK
+	userAgentsChan chan *topk.Item
+	// TopK client IPs
+	clientIPsTopK *topk.TopK
+	clientIPsChan chan *topk.Item
+	// TopK query parameter names and, for the allowed ones, values. Disabled if queryParamsTopK is nil
+	queryParamsTopK  *topk.TopK
+	queryValuesTopK  map[string]*topk.TopK
+	queryValueParams []string // Allowed parameters, in printing order
+	queryChan        chan url.Values
+	// Latency overall and per section
+	latency          *latency.Latency
+	sectionLatencies map[string]*latency.Latency
+	latencyChan      chan *latencyItem
+	// Requests and errors per value of each dimension (eg. backend), created when first observed
+	dimensions     map[string]*breakdown.Breakdown
+	dimensionsChan chan *dimensionItem
+	// Requests, errors and TopK sections per virtual host
+	vhosts    *group
+	vhostChan chan *groupItem
+	// Requests, errors and TopK sections per client class (eg. human or bot)
+	classes   *group
+	classChan chan *groupItem
+	// Requests, errors and TopK sections per tailed log file
+	files    *group
+	fileChan chan *groupItem
+	// Classes of the requests watched by the alerts, nil for all the requests
+	alertClasses map[string]bool
+	// Req/sec alerts per virtual host, created when first observed. Disabled if vhostThresholds is nil
+	alertPeriod           time.Duration
+	vhostAlerts           map[string]*alert.Alert // Nil values for the virtual hosts without alert
+	vhostThresholds       map[string]float64
+	vhostDefaultThreshold float64
+	vhostDefaultAlerts    int  // Number of alerts with the default threshold
+	vhostAlertsCapped     bool // Whether the limit of alerts with the default threshold was hit
+	// Accepted and rejected (per reason) log lines
+	acceptedLines int
+	rejectedLines map[string]int
+	rejectedChan  chan string
+	// Lines dropped by the components reporting them (eg. the tee of the input)
+	dropCounters []*dropCounter
 	// Req/sec metric
 	reqSec     *rate.Rate
 	reqSecChan chan float64
@@ -40,8 +96,89 @@ type Manager struct {
 	reqSecAlert *alert.Alert
 }
 
+// latencyItem represents a data point for the latency statistics
+type latencyItem struct {
+	section  string
+	duration time.Duration
+}
+
+// dimensionItem represents a data point for the per-dimension statistics
+type dimensionItem struct {
+	dimension string
+	value     string
+	isError   bool
+}
+
+// groupItem represents a data point for the statistics of a group of requests (eg. the ones of a
+// virtual host)
+type groupItem struct {
+	key     string
+	section string
+	class   string
+	isError bool
+}
+
+// dropCounter is the total number of lines dropped by a component, as of the last time printed
+type dropCounter struct {
+	name    string
+	dropped func() int64
+	last    int64
+}
+
+// Option configures an optional statistic of the manager
+type Option func(*Manager)
+
+// WithQueryParams enables the TopK statistics of the query parameter names and, only for the
+// parameters in the allow-list, of their values (eg. 'utm_source' or 'q')
+func WithQueryParams(allowed ...string) Option {
+	return func(m *Manager) {
+		m.queryParamsTopK = topk.New(m.k)
+		m.queryValuesTopK = make(map[string]*topk.TopK)
+		m.queryValueParams = nil
+		for _, p := range allowed {
+			if _, ok := m.queryValuesTopK[p]; ok {
+				continue
+			}
+			m.queryValuesTopK[p] = topk.New(m.k)
+			m.queryValueParams = append(m.queryValueParams, p)
+		}
+	}
+}
+
+// WithVHostAlerts enables the high traffic alerts of each virtual host, whose threshold is the one
+// in thresholds or defaultThreshold if it's not there. Virtual hosts whose threshold is not positive
+// have no alert
+func WithVHostAlerts(defaultThreshold float64, thresholds map[string]float64) Option {
+	return func(m *Manager) {
+		m.vhostDefaultThreshold = defaultThreshold
+		m.vhostThresholds = make(map[string]float64)
+		for v, t := range thresholds {
+			m.vhostThresholds[v] = t
+		}
+	}
+}
+
+// WithAlertClasses makes both the global and the per virtual host alerts watch only the requests
+// of clients in the given classes (eg. human), as observed by ObserveClass
+func WithAlertClasses(classes ...string) Option {
+	return func(m *Manager) {
+		m.alertClasses = make(map[string]bool)
+		for _, c := range classes {
+			m.alertClasses[c] = true
+		}
+	}
+}
+
+// WithDropCounter prints the number of lines dropped over each period by the named component (eg.
+// the tee of the input), whose total is returned by dropped. It must be safe for concurrent use
+func WithDropCounter(name string, dropped func() int64) Option {
+	return func(m *Manager) {
+		m.dropCounters = append(m.dropCounters, &dropCounter{name: name, dropped: dropped})
+	}
+}
+
 // New returns a new manager
-func New(alertPeriod, statsPeriod time.Duration, k int, threshold float64, l *log.Logger) (*Manager, error) {
+func New(alertPeriod, statsPeriod time.Duration, k int, threshold float64, l *log.Logger, opts ...Option) (*Manager, error) {
 	if l == nil {
 		l = log.New(os.Stderr, "", log.LstdFlags)
 	}
@@ -61,22 +198,66 @@ func New(alertPeriod, statsPeriod time.Duration, k int, threshold float64, l *lo
 		return nil, aErr
 	}
 
-	return &Manager{
-		metricsTicker:   time.NewTicker(statsPeriod),
-		quitChan:        make(chan struct{}),
-		log:             l,
-		sectionsTopK:    topk.New(k),
-		sectionsChan:    make(chan *topk.Item),
-		statusCodesTopK: topk.New(k),
-		statusCodesChan: make(chan *topk.Item),
-		usersTopK:       topk.New(k),
-		usersChan:       make(chan *topk.Item),
-		reqSec:          reqSec,
-		reqSecChan:      make(chan float64),
-		errSec:          errSec,
-		errSecChan:      make(chan float64),
-		reqSecAlert:     a,
-	}, nil
+	vhosts, vErr := newGroup("vhost", "vhosts", statsPeriod, k)
+	if vErr != nil {
+		return nil, vErr
+	}
+
+	classes, cErr := newGroup("class", "classes", statsPeriod, k)
+	if cErr != nil {
+		return nil, cErr
+	}
+
+	files, fErr := newGroup("file", "files", statsPeriod, k)
+	if fErr != nil {
+		return nil, fErr
+	}
+
+	m := &Manager{
+		metricsTicker:    time.NewTicker(statsPeriod),
+		quitChan:         make(chan struct{}),
+		log:              l,
+		k:                k,
+		sectionsTopK:     topk.New(k),
+		sectionsChan:     make(chan *topk.Item),
+		routesTopK:       topk.New(k),
+		routesChan:       make(chan *topk.Item),
+		statusCodesTopK:  topk.New(k),
+		statusCodesChan:  make(chan *topk.Item),
+		usersTopK:        topk.New(k),
+		usersChan:        make(chan *topk.Item),
+		referersTopK:     topk.New(k),
+		referersChan:     make(chan *topk.Item),
+		userAgentsTopK:   topk.New(k),
+		userAgentsChan:   make(chan *topk.Item),
+		clientIPsTopK:    topk.New(k),
+		clientIPsChan:    make(chan *topk.Item),
+		queryChan:        make(chan url.Values),
+		latency:          latency.New(),
+		sectionLatencies: make(map[string]*latency.Latency),
+		latencyChan:      make(chan *latencyItem),
+		dimensions:       make(map[string]*breakdown.Breakdown),
+		dimensionsChan:   make(chan *dimensionItem),
+		vhosts:           vhosts,
+		vhostChan:        make(chan *groupItem),
+		classes:          classes,
+		classChan:        make(chan *groupItem),
+		files:            files,
+		fileChan:         make(chan *groupItem),
+		alertPeriod:      alertPeriod,
+		vhostAlerts:      make(map[string]*alert.Alert),
+		rejectedLines:    make(map[string]int),
+		rejectedChan:     make(chan string),
+		reqSec:           reqSec,
+		reqSecChan:       make(chan float64),
+		errSec:           errSec,
+		errSecChan:       make(chan float64),
+		reqSecAlert:      a,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
 }
 
 // Start starts the stats manager
@@ -94,8 +275,7 @@ func (m *Manager) Stop() {
 		return
 	}
 	m.stopOnce.Do(func() {
-		close(m.quitChan)
-		m.reqSecAlert.Stop()
+		close(m.quitChan) // Alerts are stopped by the loop, the only goroutine using them
 	})
 }
 
@@ -107,6 +287,14 @@ func (m *Manager) ObserveSection(s string) {
 	m.sectionsChan <- &topk.Item{Key: s, Score: 1}
 }
 
+// ObserveRoute observes a data point for the routes TopK statistic
+func (m *Manager) ObserveRoute(s string) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.routesChan <- &topk.Item{Key: s, Score: 1}
+}
+
 // ObserveUser observes a data point for the users TopK statistic
 func (m *Manager) ObserveUser(s string) {
 	if atomic.LoadInt32(&m.started) == 0 {
@@ -115,6 +303,93 @@ func (m *Manager) ObserveUser(s string) {
 	m.usersChan <- &topk.Item{Key: s, Score: 1}
 }
 
+// ObserveReferer observes a data point for the referers TopK statistic
+func (m *Manager) ObserveReferer(s string) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.referersChan <- &topk.Item{Key: s, Score: 1}
+}
+
+// ObserveUserAgent observes a data point for the user agents TopK statistic
+func (m *Manager) ObserveUserAgent(s string) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.userAgentsChan <- &topk.Item{Key: s, Score: 1}
+}
+
+// ObserveClientIP observes a data point for the client IPs TopK statistic
+func (m *Manager) ObserveClientIP(s string) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.clientIPsChan <- &topk.Item{Key: s, Score: 1}
+}
+
+// ObserveQuery observes a data point for the query parameters TopK statistics.
+// It's a no-op if they're not enabled or the query is empty
+func (m *Manager) ObserveQuery(q url.Values) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	if m.queryParamsTopK == nil || len(q) == 0 {
+		return
+	}
+	m.queryChan <- q
+}
+
+// ObserveLatency observes a data point for the latency statistics, both overall and for
+// the section of the request
+func (m *Manager) ObserveLatency(section string, d time.Duration) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.latencyChan <- &latencyItem{section: section, duration: d}
+}
+
+// ObserveDimension observes a data point for the requests and errors statistics of the value of
+// a dimension (eg. the 'static' backend), where errors are the requests with an error status code
+func (m *Manager) ObserveDimension(dimension, value string, code int) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.dimensionsChan <- &dimensionItem{dimension: dimension, value: value, isError: isErrorStatusCode(code)}
+}
+
+// ObserveVHost observes a data point for the statistics and the alert of a virtual host. The
+// class of the client (eg. human), if any, is needed by the alerts watching only some classes
+func (m *Manager) ObserveVHost(vhost, section, class string, code int) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.vhostChan <- &groupItem{key: vhost, section: section, class: class, isError: isErrorStatusCode(code)}
+}
+
+// ObserveClass observes a data point for the statistics of a class of clients (eg. bot)
+func (m *Manager) ObserveClass(class, section string, code int) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.classChan <- &groupItem{key: class, section: section, class: class, isError: isErrorStatusCode(code)}
+}
+
+// ObserveFile observes a data point for the statistics of a tailed log file
+func (m *Manager) ObserveFile(file, section string, code int) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.fileChan <- &groupItem{key: file, section: section, isError: isErrorStatusCode(code)}
+}
+
+// ObserveRejected observes a log line rejected for the provided reason (eg. a parse error)
+func (m *Manager) ObserveRejected(reason string) {
+	if atomic.LoadInt32(&m.started) == 0 {
+		return
+	}
+	m.rejectedChan <- reason
+}
+
 // ObserveRequest observes a data point for the requests per second statistic
 func (m *Manager) ObserveRequest() {
 	if atomic.LoadInt32(&m.started) == 0 {
@@ -148,24 +423,67 @@ func (m *Manager) loop() {
 			if ok := m.sectionsTopK.IncrBy(i); !ok {
 				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", i.Key, i.Score)
 			}
+		case r := <-m.routesChan:
+			if ok := m.routesTopK.IncrBy(r); !ok {
+				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", r.Key, r.Score)
+			}
 		case u := <-m.usersChan:
 			if ok := m.usersTopK.IncrBy(u); !ok {
 				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", u.Key, u.Score)
 			}
+		case r := <-m.referersChan:
+			if ok := m.referersTopK.IncrBy(r); !ok {
+				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", r.Key, r.Score)
+			}
+		case u := <-m.userAgentsChan:
+			if ok := m.userAgentsTopK.IncrBy(u); !ok {
+				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", u.Key, u.Score)
+			}
+		case c := <-m.clientIPsChan:
+			if ok := m.clientIPsTopK.IncrBy(c); !ok {
+				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", c.Key, c.Score)
+			}
+		case q := <-m.queryChan:
+			m.observeQuery(q)
 		case c := <-m.statusCodesChan:
 			if ok := m.statusCodesTopK.IncrBy(c); !ok {
 				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", c.Key, c.Score)
 			}
+		case l := <-m.latencyChan:
+			if err := m.observeLatency(l); err != nil {
+				m.log.Println("[ERROR]", err)
+			}
+		case d := <-m.dimensionsChan:
+			if err := m.observeDimension(d); err != nil {
+				m.log.Println("[ERROR]", err)
+			}
+		case v := <-m.vhostChan:
+			m.observeVHost(v)
+		case c := <-m.classChan:
+			m.observeClass(c)
+		case f := <-m.fileChan:
+			m.observeFile(f)
+		case r := <-m.rejectedChan:
+			m.rejectedLines[r]++
 		case c := <-m.reqSecChan:
+			m.acceptedLines++
 			if err := m.reqSec.IncrBy(c); err != nil {
 				m.log.Println("[ERROR]", err)
 			}
-			m.reqSecAlert.IncrBy(c)
+			if m.alertClasses == nil {
+				m.reqSecAlert.IncrBy(c)
+			}
 		case c := <-m.errSecChan:
 			if err := m.errSec.IncrBy(c); err != nil {
 				m.log.Println("[ERROR]", err)
 			}
 		case <-m.quitChan:
+			m.reqSecAlert.Stop()
+			for _, a := range m.vhostAlerts {
+				if a != nil {
+					a.Stop()
+				}
+			}
 			m.log.Println("[INFO] exiting metrics manager event loop")
 			return
 		}
@@ -176,20 +494,52 @@ func (m *Manager) printAllMetrics() {
 	m.log.Println("------------------------------------------")
 	m.printReqSec()
 	m.printErrSec()
+	m.printLatency()
+	m.printRejected()
+	m.printDropped()
 	m.log.Println("TopK sections:")
 	m.printTopK(m.sectionsTopK)
+	m.log.Println("TopK routes:")
+	m.printTopK(m.routesTopK)
 	m.log.Println("TopK status codes:")
 	m.printTopK(m.statusCodesTopK)
 	m.log.Println("TopK users:")
 	m.printTopK(m.usersTopK)
+	m.log.Println("TopK referers:")
+	m.printTopK(m.referersTopK)
+	m.log.Println("TopK user agents:")
+	m.printTopK(m.userAgentsTopK)
+	m.log.Println("TopK client IPs:")
+	m.printTopK(m.clientIPsTopK)
+	m.printQuery()
+	m.printDimensions()
+	m.printGroups()
 }
 
 func (m *Manager) resetAllMetrics() {
 	m.reqSec.Reset()
 	m.errSec.Reset()
 	m.sectionsTopK.Reset()
+	m.routesTopK.Reset()
 	m.statusCodesTopK.Reset()
 	m.usersTopK.Reset()
+	m.referersTopK.Reset()
+	m.userAgentsTopK.Reset()
+	m.clientIPsTopK.Reset()
+	if m.queryParamsTopK != nil {
+		m.queryParamsTopK.Reset()
+		for _, t := range m.queryValuesTopK {
+			t.Reset()
+		}
+	}
+	m.latency.Reset()
+	m.sectionLatencies = make(map[string]*latency.Latency)
+	m.dimensions = make(map[string]*breakdown.Breakdown)
+	m.vhosts.reset()
+	m.classes.reset()
+	m.files.reset()
+	m.acceptedLines = 0
+	m.rejectedLines = make(map[string]int)
 }
 
 func (m *Manager) printReqSec() {
@@ -204,6 +554,222 @@ func (m *Manager) printErrSec() {
 	m.log.Printf("%.2f err/s over last %s", errSec, period)
 }
 
+// printRejected prints the fraction of log lines rejected overall and for each reason.
+// Nothing is printed if no line has been observed
+func (m *Manager) printRejected() {
+	rejected := 0
+	reasons := make([]string, 0, len(m.rejectedLines))
+	for r, c := range m.rejectedLines {
+		rejected += c
+		reasons = append(reasons, r)
+	}
+	total := m.acceptedLines + rejected
+	if total == 0 {
+		return
+	}
+	period := m.reqSec.GetWindowSize().String()
+	m.log.Printf("%.2f%% of lines rejected (%d/%d) over last %s", percent(rejected, total), rejected, total, period)
+
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		c := m.rejectedLines[r]
+		m.log.Printf("key:%s, count:%d (%.2f%%)", r, c, percent(c, total))
+	}
+}
+
+// printDropped prints the number of lines dropped over the period by each component reporting them
+func (m *Manager) printDropped() {
+	period := m.reqSec.GetWindowSize().String()
+	for _, c := range m.dropCounters {
+		total := c.dropped()
+		m.log.Printf("%d lines dropped by %s over last %s", total-c.last, c.name, period)
+		c.last = total
+	}
+}
+
+// observeLatency adds the duration to both the overall and the section latency metrics
+func (m *Manager) observeLatency(l *latencyItem) error {
+	if err := m.latency.Observe(l.duration); err != nil {
+		return err
+	}
+	sl, ok := m.sectionLatencies[l.section]
+	if !ok {
+		sl = latency.New()
+		m.sectionLatencies[l.section] = sl
+	}
+	return sl.Observe(l.duration)
+}
+
+// printLatency prints the overall latency and the one of the K sections with the most requests.
+// Nothing is printed if no latency has been observed
+func (m *Manager) printLatency() {
+	if m.latency.Count() == 0 {
+		return
+	}
+	period := m.reqSec.GetWindowSize().String()
+	m.log.Printf("latency over last %s: %s", period, m.latency.String())
+
+	sections := make([]string, 0, len(m.sectionLatencies))
+	for s := range m.sectionLatencies {
+		sections = append(sections, s)
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		ci, cj := m.sectionLatencies[sections[i]].Count(), m.sectionLatencies[sections[j]].Count()
+		if ci == cj {
+			return sections[i] < sections[j]
+		}
+		return ci > cj
+	})
+	if len(sections) > m.k {
+		sections = sections[:m.k]
+	}
+
+	m.log.Println("Latency per section:")
+	for _, s := range sections {
+		m.log.Printf("key:%s, %s", s, m.sectionLatencies[s].String())
+	}
+}
+
+// observeDimension counts the request in the breakdown of its dimension
+func (m *Manager) observeDimension(d *dimensionItem) error {
+	b, ok := m.dimensions[d.dimension]
+	if !ok {
+		var err error
+		if b, err = breakdown.New(m.reqSec.GetWindowSize()); err != nil {
+			return err
+		}
+		m.dimensions[d.dimension] = b
+	}
+	b.Observe(d.value, d.isError)
+	return nil
+}
+
+// printDimensions prints the K values with the most requests of each observed dimension, sorted
+// by name, along with their request and error rates
+func (m *Manager) printDimensions() {
+	names := make([]string, 0, len(m.dimensions))
+	for d := range m.dimensions {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+
+	for _, d := range names {
+		b := m.dimensions[d]
+		m.log.Printf("TopK %s:", d)
+		for _, e := range b.TopK(m.k) {
+			m.log.Println(e.String(b.GetWindowSize()))
+		}
+	}
+}
+
+// observeVHost adds the request to the statistics and the alert of its virtual host
+func (m *Manager) observeVHost(v *groupItem) {
+	if err := m.vhosts.observe(v); err != nil {
+		m.log.Println("[ERROR]", err)
+	}
+	m.observeVHostAlert(v)
+}
+
+// observeClass adds the request to the statistics of its client class and, if the class is
+// watched, to the global alert
+func (m *Manager) observeClass(c *groupItem) {
+	if err := m.classes.observe(c); err != nil {
+		m.log.Println("[ERROR]", err)
+	}
+	if m.alertClasses[c.class] {
+		m.reqSecAlert.IncrBy(1)
+	}
+}
+
+// observeFile adds the request to the statistics of its log file
+func (m *Manager) observeFile(f *groupItem) {
+	if err := m.files.observe(f); err != nil {
+		m.log.Println("[ERROR]", err)
+	}
+}
+
+// printGroups prints the statistics of the virtual hosts, the client classes and the log files
+func (m *Manager) printGroups() {
+	m.vhosts.print(m.log)
+	m.classes.print(m.log)
+	m.files.print(m.log)
+}
+
+// observeVHostAlert counts the request in the alert of its virtual host, creating it when the
+// virtual host is first observed. Only the first maxVHostAlerts unlisted virtual hosts get an alert
+// with the default threshold, since each alert has its own goroutine and ticker
+func (m *Manager) observeVHostAlert(v *groupItem) {
+	if m.vhostThresholds == nil {
+		return
+	}
+	a, ok := m.vhostAlerts[v.key]
+	if !ok {
+		threshold, found := m.vhostThresholds[v.key]
+		if !found {
+			// Unlisted virtual hosts without alert are not saved, they may be unbounded
+			if m.vhostDefaultThreshold <= 0 {
+				return
+			}
+			if m.vhostDefaultAlerts == maxVHostAlerts {
+				if !m.vhostAlertsCapped {
+					m.log.Printf("[WARN] more than %d unlisted virtual hosts, no alert for %s and the next ones\n", maxVHostAlerts, v.key)
+					m.vhostAlertsCapped = true
+				}
+				return
+			}
+			m.vhostDefaultAlerts++
+			threshold = m.vhostDefaultThreshold
+		}
+		if threshold > 0 {
+			var err error
+			if a, err = alert.New(m.alertPeriod, threshold, m.log, alert.WithName(v.key)); err != nil {
+				m.log.Println("[ERROR]", err)
+				return
+			}
+			a.Start()
+		}
+		m.vhostAlerts[v.key] = a
+	}
+	if a != nil && (m.alertClasses == nil || m.alertClasses[v.class]) {
+		a.IncrBy(1)
+	}
+}
+
+// observeQuery counts every parameter name once per request and every non-empty value of the
+// allowed parameters
+func (m *Manager) observeQuery(q url.Values) {
+	for name, values := range q {
+		if ok := m.queryParamsTopK.IncrBy(&topk.Item{Key: name, Score: 1}); !ok {
+			m.log.Printf("[ERROR] cannot incremet key %s by %d\n", name, 1)
+		}
+		t, ok := m.queryValuesTopK[name]
+		if !ok {
+			continue
+		}
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			if ok := t.IncrBy(&topk.Item{Key: v, Score: 1}); !ok {
+				m.log.Printf("[ERROR] cannot incremet key %s by %d\n", v, 1)
+			}
+		}
+	}
+}
+
+// printQuery prints the query parameters TopK statistics, if enabled
+func (m *Manager) printQuery() {
+	if m.queryParamsTopK == nil {
+		return
+	}
+	m.log.Println("TopK query parameters:")
+	m.printTopK(m.queryParamsTopK)
+	for _, p := range m.queryValueParams {
+		m.log.Printf("TopK values of query parameter %s:", p)
+		m.printTopK(m.queryValuesTopK[p])
+	}
+}
+
 func (m *Manager) printTopK(k *topk.TopK) {
 	topK := k.TopK()
 	if len(topK) == 0 {
@@ -214,6 +780,11 @@ func (m *Manager) printTopK(k *topk.TopK) {
 	}
 }
 
+// percent returns the percentage of part in total
+func percent(part, total int) float64 {
+	return float64(part) * 100 / float64(total)
+}
+
 // isErrorStatusCode returns false if the status code is between 200 (included) and 400 (excluded)
 // true otherwise
 func isErrorStatusCode(code int) bool {
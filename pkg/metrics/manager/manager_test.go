@@ -1,6 +1,10 @@
 package manager
 
 import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
 	"testing"
 	"time"
 
@@ -16,6 +20,7 @@ func TestNewManager(t *testing.T) {
 	m := getTestManager()
 	assert.NotNil(t, m)
 	assert.IsType(t, &Manager{}, m)
+	assert.Equal(t, 10, m.k)
 }
 
 func TestManager_ObserveSection(t *testing.T) {
@@ -61,6 +66,469 @@ func TestManager_ObserveUserNotStarted(t *testing.T) {
 	m.ObserveUser("1")
 }
 
+func TestManager_ObserveRoute(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	cnt := m.routesTopK.Count()
+	assert.Equal(t, 0, cnt)
+
+	m.ObserveRoute("/users/:id")
+	m.ObserveRoute("/users/:id/orders/:uuid")
+	m.ObserveRoute("/users/:id")
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveRouteNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveRoute("/users/:id")
+}
+
+func TestNewManager_WithQueryParams(t *testing.T) {
+	m, err := New(50*time.Millisecond, 50*time.Millisecond, 10, 10, nil, WithQueryParams("q", "utm_source", "q"))
+	assert.NoError(t, err)
+	assert.NotNil(t, m.queryParamsTopK)
+	assert.Equal(t, []string{"q", "utm_source"}, m.queryValueParams)
+	assert.Len(t, m.queryValuesTopK, 2)
+
+	// Disabled by default
+	m = getTestManager()
+	assert.Nil(t, m.queryParamsTopK)
+}
+
+func TestManager_ObserveQuery(t *testing.T) {
+	m, _ := New(50*time.Millisecond, 50*time.Millisecond, 10, 10, nil, WithQueryParams("q"))
+
+	m.observeQuery(url.Values{"q": {"shoes", "hats"}, "page": {"2"}})
+	m.observeQuery(url.Values{"q": {"shoes", ""}, "utm_source": {"news"}})
+
+	assert.Equal(t, 3, m.queryParamsTopK.Count())
+	assert.Equal(t, 2, m.queryValuesTopK["q"].Count())
+	top := m.queryParamsTopK.TopK()
+	assert.Equal(t, "q", top[0].Key)
+	assert.Equal(t, int64(2), top[0].Score)
+	top = m.queryValuesTopK["q"].TopK()
+	assert.Equal(t, "shoes", top[0].Key)
+	assert.Equal(t, int64(2), top[0].Score)
+
+	m.Start()
+	m.ObserveQuery(url.Values{"q": {"shoes"}})
+	m.ObserveQuery(nil)
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveQueryDisabled(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+	m.ObserveQuery(url.Values{"q": {"shoes"}})
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveQueryNotStarted(t *testing.T) {
+	m, _ := New(50*time.Millisecond, 50*time.Millisecond, 10, 10, nil, WithQueryParams("q"))
+	m.ObserveQuery(url.Values{"q": {"shoes"}})
+}
+
+func TestManager_ObserveDimension(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	m.ObserveDimension("backend", "static", 200)
+	m.ObserveDimension("backend", "api", 503)
+	m.ObserveDimension("server", "api/srv1", 503)
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveDimensionNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveDimension("backend", "static", 200)
+	assert.Empty(t, m.dimensions)
+}
+
+func TestManager_PrintDimensions(t *testing.T) {
+	var buf bytes.Buffer
+	m, _ := New(time.Minute, 10*time.Second, 2, 10, log.New(&buf, "", 0))
+
+	// Nothing observed
+	m.printDimensions()
+	assert.Empty(t, buf.String())
+
+	for _, d := range []*dimensionItem{
+		{"server", "api/srv1", true},
+		{"backend", "api", true},
+		{"backend", "api", false},
+		{"backend", "static", false},
+		{"backend", "static", false},
+		{"backend", "static", false},
+		{"backend", "admin", false},
+	} {
+		assert.NoError(t, m.observeDimension(d))
+	}
+	m.printDimensions()
+	assert.Equal(t, `TopK backend:
+key:static, 0.30 req/s, 0.00 err/s, errors:0.00%
+key:api, 0.20 req/s, 0.10 err/s, errors:50.00%
+TopK server:
+key:api/srv1, 0.10 req/s, 0.10 err/s, errors:100.00%
+`, buf.String())
+
+	m.resetAllMetrics()
+	assert.Empty(t, m.dimensions)
+}
+
+func TestManager_ObserveVHost(t *testing.T) {
+	var buf bytes.Buffer
+	m, _ := New(time.Minute, 10*time.Second, 2, 10, log.New(&buf, "", 0))
+	m.Start()
+	defer m.Stop()
+
+	m.ObserveVHost("example.com", "/api", "human", 500)
+	m.ObserveVHost("example.com", "/api", "bot", 200)
+	m.ObserveVHost("example.com", "/static", "bot", 200)
+	m.ObserveVHost("example.org", "/", "", 200)
+	m.ObserveVHost("example.net", "/", "", 200)
+	// The loop handles one data point at a time, so the vhosts are observed once this is received
+	m.ObserveSection("/")
+
+	m.vhosts.print(m.log)
+	assert.Equal(t, `TopK vhosts:
+key:example.com, 0.30 req/s, 0.10 err/s, errors:33.33%
+key:example.net, 0.10 req/s, 0.00 err/s, errors:0.00%
+TopK sections of vhost example.com:
+key:/api, score:2
+key:/static, score:1
+TopK sections of vhost example.net:
+key:/, score:1
+`, buf.String())
+	// Alerts are disabled
+	assert.Empty(t, m.vhostAlerts)
+}
+
+func TestManager_ObserveVHostNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveVHost("example.com", "/api", "human", 200)
+	assert.Equal(t, 0, m.vhosts.requests.Count())
+}
+
+func TestManager_PrintGroups(t *testing.T) {
+	var buf bytes.Buffer
+	m, _ := New(time.Minute, 10*time.Second, 2, 10, log.New(&buf, "", 0))
+
+	// Nothing observed
+	m.printGroups()
+	assert.Empty(t, buf.String())
+
+	for _, v := range []*groupItem{
+		{key: "example.com", section: "/api", class: "human", isError: true},
+		{key: "example.com", section: "/api", class: "human"},
+		{key: "example.com", section: "/static", class: "bot"},
+		{key: "example.org", section: "/", class: "human"},
+		{key: "example.net", section: "/static", class: "bot"},
+	} {
+		m.observeVHost(v)
+		m.observeClass(&groupItem{key: v.class, section: v.section, class: v.class, isError: v.isError})
+		m.observeFile(&groupItem{key: "/var/log/" + v.key + ".log", section: v.section, isError: v.isError})
+	}
+	m.printGroups()
+	assert.Equal(t, `TopK vhosts:
+key:example.com, 0.30 req/s, 0.10 err/s, errors:33.33%
+key:example.net, 0.10 req/s, 0.00 err/s, errors:0.00%
+TopK sections of vhost example.com:
+key:/api, score:2
+key:/static, score:1
+TopK sections of vhost example.net:
+key:/static, score:1
+TopK classes:
+key:human, 0.30 req/s, 0.10 err/s, errors:33.33%
+key:bot, 0.20 req/s, 0.00 err/s, errors:0.00%
+TopK sections of class human:
+key:/api, score:2
+key:/, score:1
+TopK sections of class bot:
+key:/static, score:2
+TopK files:
+key:/var/log/example.com.log, 0.30 req/s, 0.10 err/s, errors:33.33%
+key:/var/log/example.net.log, 0.10 req/s, 0.00 err/s, errors:0.00%
+TopK sections of file /var/log/example.com.log:
+key:/api, score:2
+key:/static, score:1
+TopK sections of file /var/log/example.net.log:
+key:/static, score:1
+`, buf.String())
+
+	m.resetAllMetrics()
+	assert.Equal(t, 0, m.vhosts.requests.Count())
+	assert.Equal(t, 0, m.classes.requests.Count())
+	assert.Equal(t, 0, m.files.requests.Count())
+	// Alerts are disabled
+	assert.Empty(t, m.vhostAlerts)
+}
+
+func TestManager_VHostAlerts(t *testing.T) {
+	testCases := []struct {
+		defaultThreshold float64
+		expAlerts        map[string]bool
+		expSaved         int // Unlisted virtual hosts without alert are not saved
+	}{
+		{0, map[string]bool{"busy.com": true, "quiet.com": true, "off.com": false, "other.com": false}, 3},
+		{5, map[string]bool{"busy.com": true, "quiet.com": true, "off.com": false, "other.com": true}, 4},
+	}
+
+	for _, tt := range testCases {
+		thresholds := map[string]float64{"busy.com": 100, "quiet.com": 1, "off.com": 0}
+		m, _ := New(time.Minute, time.Minute, 10, 10, nil, WithVHostAlerts(tt.defaultThreshold, thresholds))
+		for v := range tt.expAlerts {
+			m.observeVHostAlert(&groupItem{key: v, section: "/"})
+		}
+
+		assert.Len(t, m.vhostAlerts, tt.expSaved)
+		for v, exp := range tt.expAlerts {
+			assert.Equal(t, exp, m.vhostAlerts[v] != nil, v)
+			if a := m.vhostAlerts[v]; a != nil {
+				a.Stop()
+			}
+		}
+	}
+}
+
+func TestManager_VHostAlertsMax(t *testing.T) {
+	var buf bytes.Buffer
+	m, _ := New(time.Minute, time.Minute, 10, 10, log.New(&buf, "", 0), WithVHostAlerts(5, map[string]float64{"busy.com": 100}))
+	for i := 0; i <= maxVHostAlerts+1; i++ {
+		m.observeVHostAlert(&groupItem{key: fmt.Sprintf("%d.example.com", i), section: "/"})
+	}
+	// Listed virtual hosts always have an alert
+	m.observeVHostAlert(&groupItem{key: "busy.com", section: "/"})
+
+	assert.Len(t, m.vhostAlerts, maxVHostAlerts+1)
+	assert.NotNil(t, m.vhostAlerts["busy.com"])
+	assert.Nil(t, m.vhostAlerts[fmt.Sprintf("%d.example.com", maxVHostAlerts)])
+	assert.Equal(t, fmt.Sprintf("[WARN] more than %d unlisted virtual hosts, no alert for %d.example.com and the next ones\n", maxVHostAlerts, maxVHostAlerts), buf.String())
+	for _, a := range m.vhostAlerts {
+		a.Stop()
+	}
+}
+
+func TestManager_ObserveClass(t *testing.T) {
+	testCases := []struct {
+		classes  []string
+		expCount float64
+	}{
+		// All the requests are alerted
+		{nil, 3},
+		// Only the ones of human clients
+		{[]string{"human"}, 1},
+	}
+
+	for _, tt := range testCases {
+		opts := []Option{WithVHostAlerts(100, nil)}
+		if tt.classes != nil {
+			opts = append(opts, WithAlertClasses(tt.classes...))
+		}
+		m, _ := New(time.Minute, time.Minute, 10, 10, nil, opts...)
+		m.Start()
+
+		for _, class := range []string{"human", "bot", "monitoring"} {
+			m.ObserveRequest()
+			m.ObserveClass(class, "/api", 200)
+			m.ObserveVHost("example.com", "/api", class, 200)
+		}
+		// The loop handles one data point at a time, so the requests are observed once this is received
+		m.ObserveSection("/")
+
+		assert.Equal(t, tt.expCount, m.reqSecAlert.Count(), tt.classes)
+		assert.Equal(t, tt.expCount, m.vhostAlerts["example.com"].Count(), tt.classes)
+		assert.Equal(t, 3, m.classes.requests.Count())
+		m.Stop()
+	}
+}
+
+func TestManager_ObserveClassNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveClass("human", "/api", 200)
+	assert.Equal(t, 0, m.classes.requests.Count())
+}
+
+func TestManager_ObserveFile(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	m.ObserveFile("/var/log/httpd/a-access.log", "/api", 200)
+	m.ObserveFile("/var/log/httpd/b-access.log", "/", 500)
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveFileNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveFile("/var/log/httpd/a-access.log", "/api", 200)
+	assert.Equal(t, 0, m.files.requests.Count())
+}
+
+func TestNewManager_WithAlertClasses(t *testing.T) {
+	m := getTestManager()
+	assert.Nil(t, m.alertClasses)
+
+	m, _ = New(time.Minute, time.Minute, 10, 10, nil, WithAlertClasses("human", "unknown"))
+	assert.Equal(t, map[string]bool{"human": true, "unknown": true}, m.alertClasses)
+}
+
+func TestManager_ObserveRejected(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	m.ObserveRequest()
+	m.ObserveRequest()
+	m.ObserveRejected("parse_error")
+	m.ObserveRejected("old_line")
+	m.ObserveRejected("parse_error")
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveRejectedNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveRejected("parse_error")
+	assert.Empty(t, m.rejectedLines)
+}
+
+func TestManager_PrintRejected(t *testing.T) {
+	var buf bytes.Buffer
+	m, _ := New(time.Minute, time.Minute, 10, 10, log.New(&buf, "", 0))
+
+	// Nothing observed
+	m.printRejected()
+	assert.Empty(t, buf.String())
+
+	m.acceptedLines = 13
+	m.rejectedLines["parse_error"] = 5
+	m.rejectedLines["bad_section"] = 2
+	m.printRejected()
+	assert.Equal(t, `35.00% of lines rejected (7/20) over last 1m0s
+key:bad_section, count:2 (10.00%)
+key:parse_error, count:5 (25.00%)
+`, buf.String())
+}
+
+func TestManager_PrintDropped(t *testing.T) {
+	var buf bytes.Buffer
+	var dropped int64
+	m, _ := New(time.Minute, time.Minute, 10, 10, log.New(&buf, "", 0), WithDropCounter("tee", func() int64 { return dropped }))
+
+	m.printDropped()
+	dropped = 5
+	m.printDropped()
+	dropped = 7
+	m.printDropped()
+	assert.Equal(t, `0 lines dropped by tee over last 1m0s
+5 lines dropped by tee over last 1m0s
+2 lines dropped by tee over last 1m0s
+`, buf.String())
+}
+
+func TestManager_ObserveReferer(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	cnt := m.referersTopK.Count()
+	assert.Equal(t, 0, cnt)
+
+	m.ObserveReferer("http://example.com/")
+	m.ObserveReferer("http://example.com/")
+	m.ObserveReferer("-")
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveRefererNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveReferer("-")
+}
+
+func TestManager_ObserveUserAgent(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	cnt := m.userAgentsTopK.Count()
+	assert.Equal(t, 0, cnt)
+
+	m.ObserveUserAgent("Mozilla/5.0")
+	m.ObserveUserAgent("curl/7.58.0")
+	m.ObserveUserAgent("Mozilla/5.0")
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveUserAgentNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveUserAgent("curl/7.58.0")
+}
+
+func TestManager_ObserveClientIP(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	cnt := m.clientIPsTopK.Count()
+	assert.Equal(t, 0, cnt)
+
+	m.ObserveClientIP("203.0.113.7")
+	m.ObserveClientIP("2001:db8::1")
+	m.ObserveClientIP("203.0.113.7")
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveClientIPNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveClientIP("203.0.113.7")
+}
+
+func TestManager_ObserveLatency(t *testing.T) {
+	m := getTestManager()
+	m.Start()
+
+	cnt := m.latency.Count()
+	assert.Equal(t, 0, cnt)
+
+	m.ObserveLatency("/foo", 10*time.Millisecond)
+	m.ObserveLatency("/foo", 20*time.Millisecond)
+	m.ObserveLatency("/bar", time.Second)
+	// Give ticker some time to fire so I see console output
+	time.Sleep(70 * time.Millisecond)
+}
+
+func TestManager_ObserveLatencyNotStarted(t *testing.T) {
+	m := getTestManager()
+	m.ObserveLatency("/foo", time.Second)
+}
+
+func TestManager_observeLatency(t *testing.T) {
+	m := getTestManager()
+
+	err := m.observeLatency(&latencyItem{section: "/foo", duration: time.Second})
+	assert.NoError(t, err)
+	err = m.observeLatency(&latencyItem{section: "/foo", duration: 2 * time.Second})
+	assert.NoError(t, err)
+	err = m.observeLatency(&latencyItem{section: "/bar", duration: time.Second})
+	assert.NoError(t, err)
+	err = m.observeLatency(&latencyItem{section: "/bar", duration: -time.Second})
+	assert.Error(t, err)
+
+	assert.Equal(t, 3, m.latency.Count())
+	assert.Len(t, m.sectionLatencies, 2)
+	assert.Equal(t, 2, m.sectionLatencies["/foo"].Count())
+	assert.Equal(t, 2*time.Second, m.sectionLatencies["/foo"].Max())
+
+	m.printLatency()
+	m.resetAllMetrics()
+	assert.Equal(t, 0, m.latency.Count())
+	assert.Len(t, m.sectionLatencies, 0)
+}
+
 func TestManager_ObserveRequest(t *testing.T) {
 	m := getTestManager()
 	m.Start()